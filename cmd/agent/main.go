@@ -11,6 +11,7 @@ import (
 	datafetcher "github.com/BeInBloom/spanish-inquisition/internal/app/data-fetcher"
 	config "github.com/BeInBloom/spanish-inquisition/internal/config/client-config"
 	"github.com/BeInBloom/spanish-inquisition/internal/data-saver/httpsaver"
+	"github.com/BeInBloom/spanish-inquisition/internal/relabel"
 )
 
 func main() {
@@ -19,9 +20,57 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	fetcher := datafetcher.New(ctx, int64(cfg.PollInterval))
+	fetcher.AddFetcher("runtime", datafetcher.NewRuntimeFetcher(cfg.CollectorsConfig.Runtime), cfg.CollectorsConfig.Runtime.Schedule)
+
+	if cfg.CollectorsConfig.Net.Enabled {
+		netFetcher, err := datafetcher.NewNetFetcher(cfg.CollectorsConfig.Net)
+		if err != nil {
+			panic(err)
+		}
+
+		fetcher.AddFetcher("net", netFetcher, cfg.CollectorsConfig.Net.Schedule)
+	}
+
+	if cfg.CollectorsConfig.Cgroup.Enabled {
+		cgroupFetcher, err := datafetcher.NewCgroupFetcher(cfg.CollectorsConfig.Cgroup)
+		if err != nil {
+			panic(err)
+		}
+
+		fetcher.AddFetcher("cgroup", cgroupFetcher, cfg.CollectorsConfig.Cgroup.Schedule)
+	}
+
+	if len(cfg.CollectorsConfig.Process.Matchers) > 0 {
+		processFetcher, err := datafetcher.NewProcessFetcher(cfg.CollectorsConfig.Process)
+		if err != nil {
+			panic(err)
+		}
+
+		fetcher.AddFetcher("process", processFetcher, cfg.CollectorsConfig.Process.Schedule)
+	}
+
+	for _, script := range cfg.CollectorsConfig.Exec.Scripts {
+		execFetcher, err := datafetcher.NewExecFetcher(ctx, script)
+		if err != nil {
+			panic(err)
+		}
+
+		fetcher.AddFetcher("exec:"+script.ScriptName(), execFetcher, script.Schedule)
+	}
+
 	saver := httpsaver.New(cfg.SaverConfig)
 
-	app := app.New(saver, cfg.AppConfig, fetcher)
+	rules := make([]relabel.Rule, 0, len(cfg.Relabel))
+	for _, r := range cfg.Relabel {
+		rules = append(rules, relabel.Rule(r))
+	}
+
+	relabeler, err := relabel.New(rules)
+	if err != nil {
+		panic(err)
+	}
+
+	app := app.New(saver, cfg.AppConfig, fetcher, relabeler)
 	app.Init(ctx)
 
 	fmt.Println("Agent started")
@@ -9,8 +9,16 @@ import (
 
 	app "github.com/BeInBloom/spanish-inquisition/internal/app/server-app"
 	config "github.com/BeInBloom/spanish-inquisition/internal/config/server-config"
+	"github.com/BeInBloom/spanish-inquisition/internal/federation"
+	"github.com/BeInBloom/spanish-inquisition/internal/ingest"
+	"github.com/BeInBloom/spanish-inquisition/internal/limiter"
 	"github.com/BeInBloom/spanish-inquisition/internal/logger"
+	"github.com/BeInBloom/spanish-inquisition/internal/pubsub"
+	"github.com/BeInBloom/spanish-inquisition/internal/recording"
+	"github.com/BeInBloom/spanish-inquisition/internal/replication"
 	repositoryfactory "github.com/BeInBloom/spanish-inquisition/internal/repository/repository_factory"
+	"github.com/BeInBloom/spanish-inquisition/internal/retention"
+	"github.com/BeInBloom/spanish-inquisition/internal/webhooks"
 )
 
 func main() {
@@ -28,12 +36,51 @@ func main() {
 
 	logger.Info("Initializing repositories...")
 
-	repo := repositoryfactory.NewRepository(*cfg)
-	repo.Init(ctx)
+	storage := repositoryfactory.NewRepository(*cfg)
+	storage.Init(ctx)
 	logger.Info("Repositories initialized")
 
+	repo, err := replication.New(ctx, cfg.ReplicationConfig, storage)
+	if err != nil {
+		panic(err)
+	}
+	logger.Info(fmt.Sprintf("Replication role: %s", repo.Role()))
+
+	if _, err := retention.New(ctx, cfg.RetentionConfig, repo); err != nil {
+		panic(err)
+	}
+
+	hub := pubsub.New()
+
+	writer, err := ingest.New(ctx, pubsub.NewPublisher(repo, hub), cfg.IngestConfig)
+	if err != nil {
+		panic(err)
+	}
+
+	if _, err := recording.New(ctx, cfg.RecordingConfig, repo, writer); err != nil {
+		panic(err)
+	}
+
+	hooks, err := webhooks.New(ctx, cfg.WebhooksConfig, hub)
+	if err != nil {
+		panic(err)
+	}
+
+	var forwarder interface{ Close() error }
+	if cfg.FederationConfig.Upstream != "" {
+		if forwarder, err = federation.New(ctx, cfg.FederationConfig, hub); err != nil {
+			panic(err)
+		}
+		logger.Info(fmt.Sprintf("Forwarding writes to %s", cfg.FederationConfig.Upstream))
+	}
+
+	limits, err := limiter.New(ctx, cfg.LimitsConfig, repo, writer)
+	if err != nil {
+		panic(err)
+	}
+
 	logger.Info(fmt.Sprintf("Starting server on %s", cfg.ServerConfig.Address))
-	app := app.New(cfg.ServerConfig, logger, repo)
+	app := app.New(cfg.ServerConfig, logger, repo, writer, limits, hub, hooks, repo)
 	app.Init()
 	logger.Info("Server initialized")
 
@@ -50,5 +97,16 @@ func main() {
 		cansel()
 	}
 
+	// При закрытии кеш дописывает накопленное, а memrepository пишет бекап.
+	if err := repo.Close(); err != nil {
+		logger.Error(err.Error())
+	}
+
+	if forwarder != nil {
+		if err := forwarder.Close(); err != nil {
+			logger.Error(err.Error())
+		}
+	}
+
 	logger.Info("Server stopped")
 }
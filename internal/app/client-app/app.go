@@ -18,12 +18,21 @@ type saver interface {
 	Save(...models.Metrics) error
 }
 
+type relabeler interface {
+	Apply([]models.Metrics) []models.Metrics
+}
+
 type app struct {
 	ctx context.Context
 	// client         *http.Client
 	saver          saver
 	fetcher        dataFetcher
+	relabeler      relabeler
 	reportInterval int64
+	retry          func(func() error) error
+	// pending — дельты counter'ов, которые не удалось отправить. Fetch
+	// второй раз их не отдаст, поэтому они досылаются со следующей пачкой.
+	pending map[string]int64
 }
 
 func (a *app) Init(ctx context.Context) {
@@ -47,7 +56,7 @@ func (a *app) Run() error {
 			return a.ctx.Err()
 		case <-ticker.C:
 			fmt.Println("Sending data...")
-			if err := wrappers.RetryWrapper(a.sendData, 3, 2*time.Second); err != nil {
+			if err := a.sendData(); err != nil {
 				fmt.Printf("Error sending data: %v\n", err)
 			}
 		}
@@ -67,17 +76,73 @@ func (a *app) sendData() error {
 		return fmt.Errorf("%s: %v", fn, err)
 	}
 
-	if err := a.saver.Save(data...); err != nil {
+	data = a.relabeler.Apply(data)
+	if len(data) == 0 {
+		return nil
+	}
+
+	data = a.withPending(data)
+
+	// Fetch отдаёт накопленные дельты counter'ов только один раз,
+	// поэтому при ошибке повторяем отправку, а не сбор.
+	save := func() error {
+		return a.saver.Save(data...)
+	}
+
+	if err := a.retry(save); err != nil {
+		a.requeue(data)
 		return fmt.Errorf("%s: %v", fn, err)
 	}
 
 	return nil
 }
 
-func New(saver saver, config config.AppConfig, fetcher dataFetcher) *app {
+// withPending добавляет к пачке неотправленные ранее дельты. Они уже
+// прошли relabel, поэтому складываются с данными после него.
+func (a *app) withPending(data []models.Metrics) []models.Metrics {
+	if len(a.pending) == 0 {
+		return data
+	}
+
+	for i, m := range data {
+		delta, ok := a.pending[m.ID]
+		if !ok || m.MType != models.Counter || m.Delta == nil {
+			continue
+		}
+
+		sum := *m.Delta + delta
+		data[i].Delta = &sum
+		delete(a.pending, m.ID)
+	}
+
+	for id, delta := range a.pending {
+		data = append(data, models.Metrics{MType: models.Counter, ID: id, Delta: &delta})
+	}
+
+	a.pending = make(map[string]int64)
+
+	return data
+}
+
+// requeue откладывает дельты неотправленной пачки. Gauge'и не нужны:
+// к следующей отправке будут свежие.
+func (a *app) requeue(data []models.Metrics) {
+	for _, m := range data {
+		if m.MType == models.Counter && m.Delta != nil {
+			a.pending[m.ID] += *m.Delta
+		}
+	}
+}
+
+func New(saver saver, config config.AppConfig, fetcher dataFetcher, relabeler relabeler) *app {
 	return &app{
 		saver:          saver,
 		fetcher:        fetcher,
+		relabeler:      relabeler,
 		reportInterval: int64(config.ReportInterval),
+		retry: func(f func() error) error {
+			return wrappers.RetryWrapper(f, 3, 2*time.Second)
+		},
+		pending: make(map[string]int64),
 	}
 }
@@ -0,0 +1,86 @@
+package app
+
+import (
+	"errors"
+	"testing"
+
+	config "github.com/BeInBloom/spanish-inquisition/internal/config/client-config"
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+)
+
+type fetcherFunc func() ([]models.Metrics, error)
+
+func (f fetcherFunc) Fetch() ([]models.Metrics, error) { return f() }
+
+type saverFunc func(...models.Metrics) error
+
+func (f saverFunc) Save(m ...models.Metrics) error { return f(m...) }
+
+type noRelabel struct{}
+
+func (noRelabel) Apply(m []models.Metrics) []models.Metrics { return m }
+
+func TestSendData_RequeuesCounters(t *testing.T) {
+	fetch := fetcherFunc(func() ([]models.Metrics, error) {
+		delta, value := int64(2), 1.5
+
+		return []models.Metrics{
+			{MType: models.Counter, ID: "PollCount", Delta: &delta},
+			{MType: models.Gauge, ID: "Load", Value: &value},
+		}, nil
+	})
+
+	var (
+		fail  = true
+		saved []models.Metrics
+	)
+
+	save := saverFunc(func(m ...models.Metrics) error {
+		if fail {
+			return errors.New("server is down")
+		}
+
+		saved = m
+		return nil
+	})
+
+	a := New(save, config.AppConfig{}, fetch, noRelabel{})
+	a.retry = func(f func() error) error { return f() }
+
+	if err := a.sendData(); err == nil {
+		t.Fatal("expected error from failed save")
+	}
+
+	fail = false
+
+	if err := a.sendData(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]models.Metrics, len(saved))
+	for _, m := range saved {
+		if _, ok := got[m.ID]; ok {
+			t.Fatalf("%s sent twice in one batch", m.ID)
+		}
+
+		got[m.ID] = m
+	}
+
+	if m := got["PollCount"]; m.Delta == nil || *m.Delta != 4 {
+		t.Fatalf("PollCount: got %+v, want delta 4", m)
+	}
+
+	if m := got["Load"]; m.Value == nil || *m.Value != 1.5 {
+		t.Fatalf("Load: got %+v", m)
+	}
+
+	if err := a.sendData(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range saved {
+		if m.ID == "PollCount" && *m.Delta != 2 {
+			t.Fatalf("PollCount after a successful send: got %d, want 2", *m.Delta)
+		}
+	}
+}
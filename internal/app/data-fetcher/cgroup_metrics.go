@@ -0,0 +1,231 @@
+package datafetcher
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	config "github.com/BeInBloom/spanish-inquisition/internal/config/client-config"
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+)
+
+const (
+	defaultCgroupRoot = "/sys/fs/cgroup"
+	cgroupUnlimited   = "max"
+)
+
+var (
+	ErrNotCgroupV2 = errors.New("not a cgroup v2 directory")
+)
+
+var cpuStatMetrics = map[string]string{
+	"usage_usec":     "CgroupCPUUsageUsec",
+	"user_usec":      "CgroupCPUUserUsec",
+	"system_usec":    "CgroupCPUSystemUsec",
+	"nr_periods":     "CgroupCPUPeriods",
+	"nr_throttled":   "CgroupCPUThrottled",
+	"throttled_usec": "CgroupCPUThrottledUsec",
+}
+
+var ioStatMetrics = map[string]string{
+	"rbytes": "CgroupIOReadBytes",
+	"wbytes": "CgroupIOWriteBytes",
+	"rios":   "CgroupIOReads",
+	"wios":   "CgroupIOWrites",
+	"dbytes": "CgroupIODiscardBytes",
+	"dios":   "CgroupIODiscards",
+}
+
+type cgroupFetcher struct {
+	mutex sync.Mutex
+	root  string
+	prev  map[string]uint64
+}
+
+func NewCgroupFetcher(cfg config.CgroupConfig) (*cgroupFetcher, error) {
+	const fn = "datafetcher.NewCgroupFetcher"
+
+	root := cfg.Root
+	if root == "" {
+		root = defaultCgroupRoot
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", fn, root, ErrNotCgroupV2)
+	}
+
+	return &cgroupFetcher{
+		root: root,
+		prev: make(map[string]uint64),
+	}, nil
+}
+
+func (c *cgroupFetcher) Fetch() ([]models.Metrics, error) {
+	const fn = "cgroupFetcher.Fetch"
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var metrics []models.Metrics
+
+	for file, id := range map[string]string{
+		"memory.current": "CgroupMemoryCurrent",
+		"memory.max":     "CgroupMemoryMax",
+		"pids.current":   "CgroupPidsCurrent",
+		"pids.max":       "CgroupPidsMax",
+	} {
+		m, ok, err := c.readGauge(file, id)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fn, err)
+		}
+
+		if ok {
+			metrics = append(metrics, m)
+		}
+	}
+
+	cpu, err := c.readCPUStat()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn, err)
+	}
+
+	io, err := c.readIOStat()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn, err)
+	}
+
+	metrics = append(metrics, cpu...)
+	metrics = append(metrics, io...)
+
+	return metrics, nil
+}
+
+// readGauge читает файл с одним числом. Отсутствующий файл (например, memory.max
+// у корневой группы) и значение "max" (лимита нет) просто пропускаются.
+func (c *cgroupFetcher) readGauge(file, id string) (models.Metrics, bool, error) {
+	data, err := os.ReadFile(filepath.Join(c.root, file))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return models.Metrics{}, false, nil
+		}
+
+		return models.Metrics{}, false, err
+	}
+
+	raw := strings.TrimSpace(string(data))
+	if raw == cgroupUnlimited {
+		return models.Metrics{}, false, nil
+	}
+
+	value, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return models.Metrics{}, false, fmt.Errorf("%s: %v", file, err)
+	}
+
+	return models.Metrics{MType: Gauge, ID: id, Value: toFloat64Ptr(value)}, true, nil
+}
+
+func (c *cgroupFetcher) readCPUStat() ([]models.Metrics, error) {
+	var metrics []models.Metrics
+
+	err := c.scanFile("cpu.stat", func(fields []string) error {
+		if len(fields) != 2 {
+			return nil
+		}
+
+		id, ok := cpuStatMetrics[fields[0]]
+		if !ok {
+			return nil
+		}
+
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return err
+		}
+
+		if m, ok := c.counter(id, value); ok {
+			metrics = append(metrics, m)
+		}
+
+		return nil
+	})
+
+	return metrics, err
+}
+
+// Строки io.stat выглядят как "8:0 rbytes=1459200 wbytes=314773504 rios=192 ...".
+func (c *cgroupFetcher) readIOStat() ([]models.Metrics, error) {
+	var metrics []models.Metrics
+
+	err := c.scanFile("io.stat", func(fields []string) error {
+		if len(fields) < 2 {
+			return nil
+		}
+
+		labels := map[string]string{"device": fields[0]}
+
+		for _, field := range fields[1:] {
+			key, raw, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+
+			name, ok := ioStatMetrics[key]
+			if !ok {
+				continue
+			}
+
+			value, err := strconv.ParseUint(raw, 10, 64)
+			if err != nil {
+				return err
+			}
+
+			if m, ok := c.counter(models.SeriesID(name, labels), value); ok {
+				metrics = append(metrics, m)
+			}
+		}
+
+		return nil
+	})
+
+	return metrics, err
+}
+
+func (c *cgroupFetcher) scanFile(file string, f func(fields []string) error) error {
+	fd, err := os.Open(filepath.Join(c.root, file))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+	defer fd.Close()
+
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		if err := f(strings.Fields(scanner.Text())); err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// counter запоминает накопительное значение и отдаёт дельту с прошлого опроса.
+func (c *cgroupFetcher) counter(id string, value uint64) (models.Metrics, bool) {
+	prev, ok := c.prev[id]
+	c.prev[id] = value
+	if !ok {
+		return models.Metrics{}, false
+	}
+
+	delta := int64(counterDelta(prev, value))
+
+	return models.Metrics{MType: Counter, ID: id, Delta: &delta}, true
+}
@@ -0,0 +1,145 @@
+package datafetcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	config "github.com/BeInBloom/spanish-inquisition/internal/config/client-config"
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+)
+
+func copyFixture(t *testing.T, src string) string {
+	t.Helper()
+
+	dst := t.TempDir()
+
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range entries {
+		data, err := os.ReadFile(filepath.Join(src, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(filepath.Join(dst, e.Name()), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dst
+}
+
+func byID(metrics []models.Metrics) map[string]models.Metrics {
+	res := make(map[string]models.Metrics, len(metrics))
+	for _, m := range metrics {
+		res[m.ID] = m
+	}
+
+	return res
+}
+
+func TestCgroupFetcher_NotCgroupV2(t *testing.T) {
+	if _, err := NewCgroupFetcher(config.CgroupConfig{Root: t.TempDir()}); err == nil {
+		t.Fatal("expected error for directory without cgroup.controllers")
+	}
+}
+
+func TestCgroupFetcher_Gauges(t *testing.T) {
+	f, err := NewCgroupFetcher(config.CgroupConfig{Root: "testdata/cgroup"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metrics, err := f.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := byID(metrics)
+
+	for id, want := range map[string]float64{
+		"CgroupMemoryCurrent": 52428800,
+		"CgroupMemoryMax":     268435456,
+		"CgroupPidsCurrent":   12,
+	} {
+		m, ok := got[id]
+		if !ok {
+			t.Errorf("%s: missing", id)
+			continue
+		}
+
+		if m.MType != Gauge || *m.Value != want {
+			t.Errorf("%s: got %s %v, want gauge %v", id, m.MType, *m.Value, want)
+		}
+	}
+
+	if _, ok := got["CgroupPidsMax"]; ok {
+		t.Error("CgroupPidsMax: unlimited value must be skipped")
+	}
+
+	for _, m := range metrics {
+		if m.MType == Counter {
+			t.Errorf("%s: counters must not be reported on the first poll", m.ID)
+		}
+	}
+}
+
+func TestCgroupFetcher_CounterDeltas(t *testing.T) {
+	root := copyFixture(t, "testdata/cgroup")
+
+	f, err := NewCgroupFetcher(config.CgroupConfig{Root: root})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Fetch(); err != nil {
+		t.Fatal(err)
+	}
+
+	cpuStat := "usage_usec 1250000\nuser_usec 700000\nsystem_usec 550000\nnr_periods 15\nnr_throttled 2\nthrottled_usec 5000\n"
+	ioStat := "8:0 rbytes=1048576 wbytes=3145728 rios=100 wios=300 dbytes=0 dios=0\n"
+
+	if err := os.WriteFile(filepath.Join(root, "cpu.stat"), []byte(cpuStat), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "io.stat"), []byte(ioStat), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics, err := f.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := byID(metrics)
+
+	for id, want := range map[string]int64{
+		"CgroupCPUUsageUsec":                 250000,
+		"CgroupCPUPeriods":                   5,
+		"CgroupCPUThrottled":                 0,
+		`CgroupIOWriteBytes{device="8:0"}`:   1048576,
+		`CgroupIOWrites{device="8:0"}`:       100,
+		`CgroupIOReadBytes{device="8:0"}`:    0,
+		`CgroupIODiscardBytes{device="8:0"}`: 0,
+		`CgroupIOReads{device="8:0"}`:        0,
+		`CgroupIODiscards{device="8:0"}`:     0,
+		"CgroupCPUUserUsec":                  100000,
+		"CgroupCPUSystemUsec":                150000,
+		"CgroupCPUThrottledUsec":             0,
+	} {
+		m, ok := got[id]
+		if !ok {
+			t.Errorf("%s: missing", id)
+			continue
+		}
+
+		if m.MType != Counter || *m.Delta != want {
+			t.Errorf("%s: got %s %v, want counter %v", id, m.MType, *m.Delta, want)
+		}
+	}
+}
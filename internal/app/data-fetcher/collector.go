@@ -0,0 +1,217 @@
+package datafetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+)
+
+var (
+	ErrCollectorTimeout = errors.New("collector timed out")
+	ErrCollectorBusy    = errors.New("previous run is still in progress")
+)
+
+// collector опрашивает свой fetcher по собственному расписанию и хранит
+// последний результат: gauge'и последним значением, а дельты counter'ов копит
+// до ближайшего snapshot, так как сервер складывает присланные дельты.
+// Заодно ведётся статистика: последняя ошибка, длительность опроса
+// и число успешных и неудачных опросов.
+type collector struct {
+	name     string
+	fetcher  fetcher
+	interval time.Duration
+	timeout  time.Duration
+	busy     atomic.Bool
+
+	mutex        sync.Mutex
+	gauges       []models.Metrics
+	counters     map[string]int64
+	lastErr      error
+	lastDuration time.Duration
+	successes    uint64
+	failures     uint64
+	newSuccesses int64
+	newFailures  int64
+}
+
+func newCollector(name string, f fetcher, interval, timeout time.Duration) *collector {
+	if timeout <= 0 || timeout > interval {
+		timeout = interval
+	}
+
+	return &collector{
+		name:     name,
+		fetcher:  f,
+		interval: interval,
+		timeout:  timeout,
+		counters: make(map[string]int64),
+	}
+}
+
+// run стартует со случайной задержкой в пределах интервала, чтобы агенты
+// по всему парку не опрашивали и не отправляли всё одновременно.
+func (c *collector) run(ctx context.Context) {
+	jitter := time.NewTimer(rand.N(c.interval))
+
+	select {
+	case <-ctx.Done():
+		jitter.Stop()
+		return
+	case <-jitter.C:
+	}
+
+	c.collect()
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.collect()
+		}
+	}
+}
+
+func (c *collector) collect() {
+	start := time.Now()
+	data, err := c.fetch()
+	duration := time.Since(start)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.lastDuration = duration
+	c.lastErr = err
+
+	if err != nil {
+		fmt.Printf("collector %s: %v\n", c.name, err)
+		c.failures++
+		c.newFailures++
+		c.gauges = nil
+		return
+	}
+
+	c.successes++
+	c.newSuccesses++
+	c.gauges = c.gauges[:0]
+
+	for _, m := range data {
+		if m.MType != Counter {
+			c.gauges = append(c.gauges, m)
+		}
+	}
+
+	c.addCounters(data)
+}
+
+func (c *collector) addCounters(data []models.Metrics) {
+	for _, m := range data {
+		if m.MType == Counter && m.Delta != nil {
+			c.counters[m.ID] += *m.Delta
+		}
+	}
+}
+
+type fetchResult struct {
+	data []models.Metrics
+	err  error
+}
+
+// fetch ограничивает опрос таймаутом. Зависший fetcher дорабатывает в фоне,
+// а следующие запуски пропускаются, пока он не вернётся.
+func (c *collector) fetch() ([]models.Metrics, error) {
+	if !c.busy.CompareAndSwap(false, true) {
+		return nil, ErrCollectorBusy
+	}
+
+	done := make(chan fetchResult, 1)
+
+	go func() {
+		defer c.busy.Store(false)
+
+		data, err := c.fetcher.Fetch()
+		done <- fetchResult{data: data, err: err}
+	}()
+
+	timer := time.NewTimer(c.timeout)
+	defer timer.Stop()
+
+	select {
+	case r := <-done:
+		return r.data, r.err
+	case <-timer.C:
+		go c.late(done)
+		return nil, ErrCollectorTimeout
+	}
+}
+
+// late дожидается опроса, не уложившегося в таймаут. Gauge'и из него уже
+// устарели, а дельты counter'ов надо сохранить: fetcher отсчитал их от
+// своего прошлого значения и второй раз не отдаст.
+func (c *collector) late(done <-chan fetchResult) {
+	r := <-done
+	if r.err != nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.addCounters(r.data)
+}
+
+// snapshot отдаёт последние gauge'и и накопленные дельты counter'ов, обнуляя их.
+func (c *collector) snapshot() []models.Metrics {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	data := make([]models.Metrics, 0, len(c.gauges)+len(c.counters))
+	data = append(data, c.gauges...)
+
+	for id, delta := range c.counters {
+		data = append(data, models.Metrics{MType: Counter, ID: id, Delta: &delta})
+	}
+
+	c.counters = make(map[string]int64)
+
+	return data
+}
+
+func (c *collector) selfMetrics() []models.Metrics {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.successes+c.failures == 0 {
+		return nil
+	}
+
+	labels := map[string]string{"collector": c.name}
+
+	var up float64 = 1
+	if c.lastErr != nil {
+		up = 0
+	}
+
+	duration := c.lastDuration.Seconds()
+	successes := c.newSuccesses
+	failures := c.newFailures
+
+	c.newSuccesses = 0
+	c.newFailures = 0
+
+	return []models.Metrics{
+		{MType: Gauge, ID: models.SeriesID("AgentCollectorUp", labels), Value: &up},
+		{MType: Gauge, ID: models.SeriesID("AgentCollectorDurationSeconds", labels), Value: &duration},
+		{MType: Counter, ID: models.SeriesID("AgentCollectorSuccess", labels), Delta: &successes},
+		{MType: Counter, ID: models.SeriesID("AgentCollectorErrors", labels), Delta: &failures},
+	}
+}
@@ -3,12 +3,11 @@ package datafetcher
 import (
 	"context"
 	"errors"
-	"fmt"
 	"runtime"
 	"sync"
-	"sync/atomic"
 	"time"
 
+	config "github.com/BeInBloom/spanish-inquisition/internal/config/client-config"
 	h "github.com/BeInBloom/spanish-inquisition/internal/helpers"
 	"github.com/BeInBloom/spanish-inquisition/internal/models"
 	"github.com/shirou/gopsutil/v3/cpu"
@@ -36,145 +35,66 @@ type fetcher interface {
 
 type dataFetcher struct {
 	ctx          context.Context
-	data         []models.Metrics
 	timeToUpdate int64
 	mutex        sync.RWMutex
-	running      int64
-	fetchers     []fetcher
+	collectors   []*collector
 }
 
 func New(ctx context.Context, timeToUpdate int64) *dataFetcher {
 	fetcher := &dataFetcher{
 		ctx:          ctx,
 		timeToUpdate: timeToUpdate,
-		data:         make([]models.Metrics, 0),
-		running:      0,
 	}
 
-	fetcher.AddFetcher(fetcherFunc(specificMetrics))
-	fetcher.AddFetcher(fetcherFunc(gopsutilMetrics))
-	fetcher.AddFetcher(fetcherFunc(runtimeMetrics))
-
-	fetcher.start()
+	fetcher.AddFetcher("specific", fetcherFunc(specificMetrics), config.Schedule{})
+	fetcher.AddFetcher("gopsutil", fetcherFunc(gopsutilMetrics), config.Schedule{})
 
 	return fetcher
 }
 
+// Fetch собирает последние результаты всех сборщиков. Каждый сборщик работает
+// по своему расписанию, поэтому в выдаче могут быть данные разной свежести.
 func (d *dataFetcher) Fetch() ([]models.Metrics, error) {
-	d.mutex.Lock()
-	defer d.mutex.Unlock()
-
-	if d.data != nil {
-		returnedData := make([]models.Metrics, len(d.data))
-		copy(returnedData, d.data)
-		return returnedData, nil
-	}
+	d.mutex.RLock()
+	collectors := make([]*collector, len(d.collectors))
+	copy(collectors, d.collectors)
+	d.mutex.RUnlock()
 
-	return nil, ErrCantFetchData
-}
-
-func (d *dataFetcher) AddFetcher(fetcher fetcher) {
-	d.fetchers = append(d.fetchers, fetcher)
-}
+	data := make([]models.Metrics, 0)
 
-func (d *dataFetcher) start() {
-	const fn = "dataFetcher.start"
-
-	if atomic.CompareAndSwapInt64(&d.running, 1, 0) {
-		return
+	for _, c := range collectors {
+		data = append(data, c.snapshot()...)
+		data = append(data, c.selfMetrics()...)
 	}
 
-	data, err := d.fetchAll()
-	if err == nil {
-		d.data = data
+	if len(data) == 0 {
+		return nil, ErrCantFetchData
 	}
 
-	ticker := time.NewTicker(time.Duration(d.timeToUpdate) * time.Second)
-
-	go func() {
-		defer func() {
-			ticker.Stop()
-			atomic.StoreInt64(&d.running, 0)
-		}()
-
-		for {
-			select {
-			case <-d.ctx.Done():
-				return
-			case <-ticker.C:
-				data, err := d.fetchAll()
-
-				d.mutex.Lock()
-
-				if err != nil {
-					fmt.Printf("Error fetching data: %v\n", err)
-					d.data = nil
-				} else {
-					d.data = data
-				}
-
-				fmt.Printf("Data: %+v\n", d.data)
-
-				d.mutex.Unlock()
-			}
-		}
-	}()
+	return data, nil
 }
 
-func (d *dataFetcher) fetchAll() ([]models.Metrics, error) {
-	const fn = "dataFetcher.fetchAll"
-
-	var allData []models.Metrics
-	var allErrors []error
-	cData := make(chan []models.Metrics, len(d.fetchers))
-	cErr := make(chan error, len(d.fetchers))
-
-	go func() {
-		var wg sync.WaitGroup
-
-		for _, f := range d.fetchers {
-			wg.Add(1)
-
-			go func(fetcher fetcher) {
-				defer wg.Done()
-
-				data, err := fetcher.Fetch()
-				if err != nil {
-					cErr <- err
-					return
-				}
-
-				cData <- data
-			}(f)
-		}
-
-		wg.Wait()
-
-		defer func() {
-			close(cData)
-			close(cErr)
-		}()
-	}()
-
-	//Два синхронных чтения из канала. Пока мне проще мыслить из серии локнуть мутексом, добавить в слайс
-	//и возвращать его. С каналами пока как-то непонятное.
-	for data := range cData {
-		allData = append(allData, data...)
+// AddFetcher регистрирует сборщик и сразу запускает его опрос.
+// Незаданные интервал и таймаут берутся из интервала опроса агента.
+func (d *dataFetcher) AddFetcher(name string, fetcher fetcher, schedule config.Schedule) {
+	interval := time.Duration(schedule.Interval) * time.Second
+	if interval <= 0 {
+		interval = time.Duration(d.timeToUpdate) * time.Second
 	}
 
-	for err := range cErr {
-		if err != nil {
-			allErrors = append(allErrors, err)
-		}
+	if interval <= 0 {
+		interval = time.Second
 	}
 
-	if len(allErrors) > 0 {
-		return nil, fmt.Errorf("%s: %v", fn, allErrors)
-	}
+	c := newCollector(name, fetcher, interval, time.Duration(schedule.Timeout)*time.Second)
 
-	fmt.Printf("Fetched %d metrics\n", len(allData))
+	d.mutex.Lock()
+	d.collectors = append(d.collectors, c)
+	d.mutex.Unlock()
 
-	return allData, nil
+	if d.ctx != nil {
+		go c.run(d.ctx)
+	}
 }
 
 func specificMetrics() ([]models.Metrics, error) {
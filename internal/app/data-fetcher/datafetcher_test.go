@@ -0,0 +1,134 @@
+package datafetcher
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	config "github.com/BeInBloom/spanish-inquisition/internal/config/client-config"
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+)
+
+func collectAll(d *dataFetcher) {
+	for _, c := range d.collectors {
+		c.collect()
+	}
+}
+
+func TestFetch_PartialFailure(t *testing.T) {
+	value := 1.0
+
+	d := &dataFetcher{timeToUpdate: 1}
+	d.AddFetcher("ok", fetcherFunc(func() ([]models.Metrics, error) {
+		return []models.Metrics{{MType: Gauge, ID: "Alive", Value: &value}}, nil
+	}), config.Schedule{})
+	d.AddFetcher("broken", fetcherFunc(func() ([]models.Metrics, error) {
+		return nil, errors.New("boom")
+	}), config.Schedule{})
+
+	collectAll(d)
+
+	data, err := d.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := byID(data)
+
+	if _, ok := got["Alive"]; !ok {
+		t.Fatal("data of the healthy collector must be kept")
+	}
+
+	for id, want := range map[string]float64{
+		`AgentCollectorUp{collector="ok"}`:     1,
+		`AgentCollectorUp{collector="broken"}`: 0,
+	} {
+		if m, ok := got[id]; !ok || *m.Value != want {
+			t.Errorf("%s: got %+v, want %v", id, m, want)
+		}
+	}
+
+	for id, want := range map[string]int64{
+		`AgentCollectorErrors{collector="broken"}`: 1,
+		`AgentCollectorErrors{collector="ok"}`:     0,
+		`AgentCollectorSuccess{collector="ok"}`:    1,
+	} {
+		if m, ok := got[id]; !ok || *m.Delta != want {
+			t.Errorf("%s: got %+v, want %v", id, m, want)
+		}
+	}
+}
+
+func TestFetch_CountersAreSentOnce(t *testing.T) {
+	var step int64 = 1
+
+	d := &dataFetcher{timeToUpdate: 1}
+	d.AddFetcher("poll", fetcherFunc(func() ([]models.Metrics, error) {
+		return []models.Metrics{{MType: Counter, ID: "PollCount", Delta: &step}}, nil
+	}), config.Schedule{})
+
+	collectAll(d)
+	collectAll(d)
+
+	data, err := d.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m, ok := byID(data)["PollCount"]; !ok || *m.Delta != 2 {
+		t.Fatalf("PollCount: got %+v, want accumulated delta 2", m)
+	}
+
+	data, err = d.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m, ok := byID(data)["PollCount"]; ok {
+		t.Fatalf("PollCount: already sent delta must not be repeated, got %v", *m.Delta)
+	}
+}
+
+func TestCollector_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	c := newCollector("slow", fetcherFunc(func() ([]models.Metrics, error) {
+		<-release
+		return nil, nil
+	}), time.Second, 10*time.Millisecond)
+
+	if _, err := c.fetch(); !errors.Is(err, ErrCollectorTimeout) {
+		t.Fatalf("got %v, want %v", err, ErrCollectorTimeout)
+	}
+
+	if _, err := c.fetch(); !errors.Is(err, ErrCollectorBusy) {
+		t.Fatalf("got %v, want %v", err, ErrCollectorBusy)
+	}
+}
+
+func TestCollector_LateCountersAreKept(t *testing.T) {
+	release := make(chan struct{})
+	var delta int64 = 5
+
+	c := newCollector("slow", fetcherFunc(func() ([]models.Metrics, error) {
+		<-release
+		return []models.Metrics{{MType: Counter, ID: "Bytes", Delta: &delta}}, nil
+	}), time.Second, 10*time.Millisecond)
+
+	c.collect()
+	close(release)
+
+	// Дельта опоздавшего опроса попадает в один из следующих snapshot.
+	var got int64
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if m, ok := byID(c.snapshot())["Bytes"]; ok {
+			got += *m.Delta
+			break
+		}
+	}
+
+	if got != 5 {
+		t.Fatalf("Bytes: got %d, want 5", got)
+	}
+}
@@ -0,0 +1,148 @@
+package datafetcher
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	config "github.com/BeInBloom/spanish-inquisition/internal/config/client-config"
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+)
+
+const (
+	defaultExecTimeout = 10
+)
+
+var (
+	ErrEmptyExecCommand = errors.New("exec script has no command")
+	ErrBadExecLine      = errors.New("expected \"type name value\"")
+	ErrBadExecMetric    = errors.New("metric has no value for its type")
+)
+
+// execScript — сборщик одного внешнего скрипта. Расписанием, как и у
+// остальных сборщиков, управляет collector; сам скрипт убивается по
+// своему таймауту, чтобы зависший процесс не занимал сборщик навсегда.
+type execScript struct {
+	ctx     context.Context
+	command string
+	args    []string
+	timeout time.Duration
+}
+
+func NewExecFetcher(ctx context.Context, cfg config.ExecScript) (*execScript, error) {
+	const fn = "datafetcher.NewExecFetcher"
+
+	if cfg.Command == "" {
+		return nil, fmt.Errorf("%s: %w", fn, ErrEmptyExecCommand)
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = cfg.Interval
+	}
+
+	if timeout <= 0 {
+		timeout = defaultExecTimeout
+	}
+
+	return &execScript{
+		ctx:     ctx,
+		command: cfg.Command,
+		args:    cfg.Args,
+		timeout: time.Duration(timeout) * time.Second,
+	}, nil
+}
+
+func (s *execScript) Fetch() ([]models.Metrics, error) {
+	return runScript(s.ctx, s)
+}
+
+func runScript(ctx context.Context, s *execScript) ([]models.Metrics, error) {
+	const fn = "datafetcher.runScript"
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, s.command, s.args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %v: %s", fn, err, strings.TrimSpace(stderr.String()))
+	}
+
+	metrics, err := parseScriptOutput(stdout.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn, err)
+	}
+
+	return metrics, nil
+}
+
+func parseScriptOutput(out []byte) ([]models.Metrics, error) {
+	out = bytes.TrimSpace(out)
+
+	if bytes.HasPrefix(out, []byte("[")) {
+		var metrics []models.Metrics
+		if err := json.Unmarshal(out, &metrics); err != nil {
+			return nil, err
+		}
+
+		for _, m := range metrics {
+			if err := validateScriptMetric(m); err != nil {
+				return nil, err
+			}
+		}
+
+		return metrics, nil
+	}
+
+	var metrics []models.Metrics
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("line %d: %w", line, ErrBadExecLine)
+		}
+
+		m, err := models.CreateMetricsByType(fields[0], fields[1], fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		metrics = append(metrics, m)
+	}
+
+	return metrics, scanner.Err()
+}
+
+func validateScriptMetric(m models.Metrics) error {
+	switch m.MType {
+	case Gauge:
+		if m.Value == nil {
+			return fmt.Errorf("%s: %w", m.ID, ErrBadExecMetric)
+		}
+	case Counter:
+		if m.Delta == nil {
+			return fmt.Errorf("%s: %w", m.ID, ErrBadExecMetric)
+		}
+	default:
+		return fmt.Errorf("%s: %w", m.ID, models.ErrUnexpectedMetricType)
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package datafetcher
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/apperrors"
+	config "github.com/BeInBloom/spanish-inquisition/internal/config/client-config"
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+)
+
+func TestParseScriptOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		out     string
+		want    map[string]string
+		wantErr error
+	}{
+		{
+			name: "lines",
+			out:  "# comment\ngauge Temperature 36.6\n\n  counter Requests 3  \n",
+			want: map[string]string{"Temperature": Gauge, "Requests": Counter},
+		},
+		{
+			name: "json",
+			out:  ` [{"id":"Temperature","type":"gauge","value":36.6},{"id":"Requests","type":"counter","delta":3}]`,
+			want: map[string]string{"Temperature": Gauge, "Requests": Counter},
+		},
+		{
+			name: "empty",
+			out:  "\n",
+			want: map[string]string{},
+		},
+		{
+			name:    "wrong field count",
+			out:     "gauge Temperature\n",
+			wantErr: ErrBadExecLine,
+		},
+		{
+			name:    "bad value",
+			out:     "counter Requests 1.5\n",
+			wantErr: apperrors.ErrValidation,
+		},
+		{
+			name:    "json without value",
+			out:     `[{"id":"Temperature","type":"gauge","delta":1}]`,
+			wantErr: ErrBadExecMetric,
+		},
+		{
+			name:    "json with unknown type",
+			out:     `[{"id":"Temperature","type":"histogram","value":1}]`,
+			wantErr: models.ErrUnexpectedMetricType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics, err := parseScriptOutput([]byte(tt.out))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got %v, want %v", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := byID(metrics)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d metrics, want %d", len(got), len(tt.want))
+			}
+
+			for id, mtype := range tt.want {
+				if m, ok := got[id]; !ok || m.MType != mtype {
+					t.Errorf("%s: got %+v, want %s", id, m, mtype)
+				}
+			}
+		})
+	}
+}
+
+func TestExecFetcher(t *testing.T) {
+	if _, err := NewExecFetcher(context.Background(), config.ExecScript{Name: "empty"}); !errors.Is(err, ErrEmptyExecCommand) {
+		t.Fatalf("got %v, want %v", err, ErrEmptyExecCommand)
+	}
+
+	f, err := NewExecFetcher(context.Background(), config.ExecScript{
+		Command: "sh",
+		Args:    []string{"-c", "echo gauge Temperature 36.6"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metrics, err := f.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m, ok := byID(metrics)["Temperature"]; !ok || *m.Value != 36.6 {
+		t.Fatalf("got %+v", metrics)
+	}
+
+	f, err = NewExecFetcher(context.Background(), config.ExecScript{
+		Command:  "sh",
+		Args:     []string{"-c", "echo oops >&2; exit 1"},
+		Schedule: config.Schedule{Timeout: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Fetch(); err == nil {
+		t.Fatal("expected error for failed script")
+	}
+}
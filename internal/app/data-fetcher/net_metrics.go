@@ -0,0 +1,161 @@
+package datafetcher
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sync"
+
+	config "github.com/BeInBloom/spanish-inquisition/internal/config/client-config"
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+	"github.com/shirou/gopsutil/v3/net"
+)
+
+var tcpStates = []string{
+	"ESTABLISHED",
+	"SYN_SENT",
+	"SYN_RECV",
+	"FIN_WAIT1",
+	"FIN_WAIT2",
+	"TIME_WAIT",
+	"CLOSE",
+	"CLOSE_WAIT",
+	"LAST_ACK",
+	"LISTEN",
+	"CLOSING",
+}
+
+type netFetcher struct {
+	mutex      sync.Mutex
+	interfaces *regexp.Regexp
+	prev       map[string]net.IOCountersStat
+}
+
+func NewNetFetcher(cfg config.NetConfig) (*netFetcher, error) {
+	const fn = "datafetcher.NewNetFetcher"
+
+	var interfaces *regexp.Regexp
+
+	if cfg.Interfaces != "" {
+		re, err := regexp.Compile(cfg.Interfaces)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fn, err)
+		}
+
+		interfaces = re
+	}
+
+	return &netFetcher{
+		interfaces: interfaces,
+		prev:       make(map[string]net.IOCountersStat),
+	}, nil
+}
+
+func (n *netFetcher) Fetch() ([]models.Metrics, error) {
+	const fn = "netFetcher.Fetch"
+
+	ioCounters, err := net.IOCounters(true)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn, err)
+	}
+
+	connections, err := net.Connections("tcp")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn, err)
+	}
+
+	metrics := n.ioMetrics(ioCounters)
+	metrics = append(metrics, tcpMetrics(connections)...)
+
+	return metrics, nil
+}
+
+// ioMetrics превращает накопительные счётчики интерфейсов в дельты между опросами,
+// потому что сервер складывает присланные counter'ы. На первом опросе интерфейса
+// дельту посчитать не от чего, поэтому он только запоминается.
+func (n *netFetcher) ioMetrics(stats []net.IOCountersStat) []models.Metrics {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	var metrics []models.Metrics
+	seen := make(map[string]struct{}, len(stats))
+
+	for _, cur := range stats {
+		if n.interfaces != nil && !n.interfaces.MatchString(cur.Name) {
+			continue
+		}
+
+		seen[cur.Name] = struct{}{}
+
+		prev, ok := n.prev[cur.Name]
+		n.prev[cur.Name] = cur
+		if !ok {
+			continue
+		}
+
+		labels := map[string]string{"interface": cur.Name}
+
+		metrics = append(metrics,
+			netCounter("NetBytesSent", labels, prev.BytesSent, cur.BytesSent),
+			netCounter("NetBytesRecv", labels, prev.BytesRecv, cur.BytesRecv),
+			netCounter("NetPacketsSent", labels, prev.PacketsSent, cur.PacketsSent),
+			netCounter("NetPacketsRecv", labels, prev.PacketsRecv, cur.PacketsRecv),
+			netCounter("NetErrIn", labels, prev.Errin, cur.Errin),
+			netCounter("NetErrOut", labels, prev.Errout, cur.Errout),
+			netCounter("NetDropIn", labels, prev.Dropin, cur.Dropin),
+			netCounter("NetDropOut", labels, prev.Dropout, cur.Dropout),
+		)
+	}
+
+	for name := range n.prev {
+		if _, ok := seen[name]; !ok {
+			delete(n.prev, name)
+		}
+	}
+
+	return metrics
+}
+
+func tcpMetrics(connections []net.ConnectionStat) []models.Metrics {
+	counts := make(map[string]int, len(tcpStates))
+	for _, c := range connections {
+		counts[c.Status]++
+	}
+
+	metrics := make([]models.Metrics, 0, len(tcpStates))
+	for _, state := range tcpStates {
+		metrics = append(metrics, models.Metrics{
+			MType: Gauge,
+			ID:    models.SeriesID("TCPConnections", map[string]string{"state": state}),
+			Value: toFloat64Ptr(counts[state]),
+		})
+	}
+
+	return metrics
+}
+
+func netCounter(name string, labels map[string]string, prev, cur uint64) models.Metrics {
+	delta := int64(counterDelta(prev, cur))
+
+	return models.Metrics{
+		MType: Counter,
+		ID:    models.SeriesID(name, labels),
+		Delta: &delta,
+	}
+}
+
+// counterDelta считает прирост счётчика с учётом того, что он мог уменьшиться.
+// Если предыдущее значение было в верхней половине 32-битного диапазона, считаем,
+// что переполнился 32-битный счётчик ядра. Иначе это сброс (интерфейс пересоздали),
+// и весь текущий счётчик набежал уже после него.
+func counterDelta(prev, cur uint64) uint64 {
+	if cur >= prev {
+		return cur - prev
+	}
+
+	if prev <= math.MaxUint32 && prev > math.MaxUint32/2 && cur <= math.MaxUint32 {
+		return math.MaxUint32 - prev + cur + 1
+	}
+
+	return cur
+}
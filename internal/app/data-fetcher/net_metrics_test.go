@@ -0,0 +1,87 @@
+package datafetcher
+
+import (
+	"math"
+	"testing"
+
+	config "github.com/BeInBloom/spanish-inquisition/internal/config/client-config"
+	"github.com/shirou/gopsutil/v3/net"
+)
+
+func TestCounterDelta(t *testing.T) {
+	tests := []struct {
+		name      string
+		prev, cur uint64
+		want      uint64
+	}{
+		{"growth", 100, 250, 150},
+		{"unchanged", 42, 42, 0},
+		{"32-bit wrap", math.MaxUint32 - 9, 5, 15},
+		{"wrap at the boundary", math.MaxUint32, 0, 1},
+		{"reset", 1000, 30, 30},
+		{"reset of a 64-bit counter", math.MaxUint32 + 100, 7, 7},
+		{"reset to zero", 500, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := counterDelta(tt.prev, tt.cur); got != tt.want {
+				t.Fatalf("counterDelta(%d, %d) = %d, want %d", tt.prev, tt.cur, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNetFetcher_IOMetrics(t *testing.T) {
+	n, err := NewNetFetcher(config.NetConfig{Interfaces: "^eth"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := []net.IOCountersStat{
+		{Name: "eth0", BytesSent: 1000, BytesRecv: math.MaxUint32 - 1},
+		{Name: "lo", BytesSent: 5},
+	}
+
+	// Первый опрос только запоминает значения.
+	if got := n.ioMetrics(first); len(got) != 0 {
+		t.Fatalf("first poll: got %d metrics, want none", len(got))
+	}
+
+	second := []net.IOCountersStat{
+		{Name: "eth0", BytesSent: 400, BytesRecv: 3},
+		{Name: "eth1", BytesSent: 10},
+		{Name: "lo", BytesSent: 50},
+	}
+
+	got := byID(n.ioMetrics(second))
+
+	for id, want := range map[string]int64{
+		`NetBytesSent{interface="eth0"}`: 400,
+		`NetBytesRecv{interface="eth0"}`: 5,
+	} {
+		m, ok := got[id]
+		if !ok {
+			t.Errorf("%s: missing", id)
+			continue
+		}
+
+		if m.MType != Counter || *m.Delta != want {
+			t.Errorf("%s: got %s %d, want counter %d", id, m.MType, *m.Delta, want)
+		}
+	}
+
+	for id := range got {
+		if id == `NetBytesSent{interface="lo"}` || id == `NetBytesSent{interface="eth1"}` {
+			t.Errorf("%s: must not be reported", id)
+		}
+	}
+
+	if _, ok := n.prev["lo"]; ok {
+		t.Fatal("filtered interface must not be remembered")
+	}
+
+	if _, err := NewNetFetcher(config.NetConfig{Interfaces: "("}); err == nil {
+		t.Fatal("expected error for bad interface regexp")
+	}
+}
@@ -0,0 +1,276 @@
+package datafetcher
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	config "github.com/BeInBloom/spanish-inquisition/internal/config/client-config"
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+var (
+	ErrEmptyProcessMatcher = errors.New("process matcher has no conditions")
+	ErrNoProcessGroup      = errors.New("process matcher has no group name")
+)
+
+type processMatcher struct {
+	group   string
+	name    string
+	cmdline *regexp.Regexp
+	pidfile string
+}
+
+type processGroup struct {
+	count   int
+	cpu     float64
+	rss     uint64
+	fds     int32
+	threads int32
+}
+
+type processFetcher struct {
+	mutex    sync.Mutex
+	matchers []processMatcher
+	// Процессы кешируются между опросами: Percent(0) считает загрузку CPU
+	// относительно предыдущего вызова на том же объекте.
+	procs map[int32]*process.Process
+}
+
+func NewProcessFetcher(cfg config.ProcessConfig) (*processFetcher, error) {
+	const fn = "datafetcher.NewProcessFetcher"
+
+	matchers := make([]processMatcher, 0, len(cfg.Matchers))
+
+	for _, m := range cfg.Matchers {
+		if m.Name == "" && m.Cmdline == "" && m.Pidfile == "" {
+			return nil, fmt.Errorf("%s: %w", fn, ErrEmptyProcessMatcher)
+		}
+
+		group := m.Group
+		if group == "" {
+			group = m.Name
+		}
+
+		if group == "" {
+			return nil, fmt.Errorf("%s: %w", fn, ErrNoProcessGroup)
+		}
+
+		matcher := processMatcher{
+			group:   group,
+			name:    m.Name,
+			pidfile: m.Pidfile,
+		}
+
+		if m.Cmdline != "" {
+			re, err := regexp.Compile(m.Cmdline)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", fn, err)
+			}
+
+			matcher.cmdline = re
+		}
+
+		matchers = append(matchers, matcher)
+	}
+
+	return &processFetcher{
+		matchers: matchers,
+		procs:    make(map[int32]*process.Process),
+	}, nil
+}
+
+func (p *processFetcher) Fetch() ([]models.Metrics, error) {
+	const fn = "processFetcher.Fetch"
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	procs, err := p.refreshProcesses()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn, err)
+	}
+
+	groups := make(map[string]*processGroup, len(p.matchers))
+	for _, m := range p.matchers {
+		if _, ok := groups[m.group]; !ok {
+			groups[m.group] = &processGroup{}
+		}
+	}
+
+	for group, pids := range groupProcesses(p.matchers, p.pidfiles(), p.describe(procs)) {
+		for _, pid := range pids {
+			collectProcess(groups[group], procs[pid])
+		}
+	}
+
+	var metrics []models.Metrics
+
+	for name, g := range groups {
+		labels := map[string]string{"group": name}
+
+		metrics = append(metrics,
+			models.Metrics{MType: Gauge, ID: models.SeriesID("ProcessCount", labels), Value: toFloat64Ptr(g.count)},
+			models.Metrics{MType: Gauge, ID: models.SeriesID("ProcessCPUPercent", labels), Value: toFloat64Ptr(g.cpu)},
+			models.Metrics{MType: Gauge, ID: models.SeriesID("ProcessRSS", labels), Value: toFloat64Ptr(g.rss)},
+			models.Metrics{MType: Gauge, ID: models.SeriesID("ProcessOpenFDs", labels), Value: toFloat64Ptr(g.fds)},
+			models.Metrics{MType: Gauge, ID: models.SeriesID("ProcessThreads", labels), Value: toFloat64Ptr(g.threads)},
+		)
+	}
+
+	return metrics, nil
+}
+
+// refreshProcesses обновляет кеш процессов: новые добавляет, завершившиеся выкидывает.
+func (p *processFetcher) refreshProcesses() (map[int32]*process.Process, error) {
+	pids, err := process.Pids()
+	if err != nil {
+		return nil, err
+	}
+
+	alive := make(map[int32]*process.Process, len(pids))
+
+	for _, pid := range pids {
+		if proc, ok := p.procs[pid]; ok {
+			alive[pid] = proc
+			continue
+		}
+
+		proc, err := process.NewProcess(pid)
+		if err != nil {
+			continue
+		}
+
+		alive[pid] = proc
+	}
+
+	p.procs = alive
+
+	return alive, nil
+}
+
+// procInfo — то, по чему процесс сверяется с условиями. Имя и командная
+// строка читаются из /proc один раз за опрос и только если они кому-то нужны.
+type procInfo struct {
+	pid     int32
+	name    string
+	cmdline string
+}
+
+func (p *processFetcher) describe(procs map[int32]*process.Process) []procInfo {
+	var needName, needCmdline bool
+	for _, m := range p.matchers {
+		needName = needName || m.name != ""
+		needCmdline = needCmdline || m.cmdline != nil
+	}
+
+	infos := make([]procInfo, 0, len(procs))
+
+	for pid, proc := range procs {
+		info := procInfo{pid: pid}
+
+		if needName {
+			info.name, _ = proc.Name()
+		}
+
+		if needCmdline {
+			info.cmdline, _ = proc.Cmdline()
+		}
+
+		infos = append(infos, info)
+	}
+
+	return infos
+}
+
+// pidfiles читает pidfile'ы условий; для условий без pidfile или с
+// нечитаемым файлом там 0.
+func (p *processFetcher) pidfiles() []int32 {
+	pids := make([]int32, len(p.matchers))
+
+	for i, m := range p.matchers {
+		if m.pidfile == "" {
+			continue
+		}
+
+		if pid, err := readPidfile(m.pidfile); err == nil {
+			pids[i] = pid
+		}
+	}
+
+	return pids
+}
+
+func (m processMatcher) matches(info procInfo, pidfile int32) bool {
+	if m.pidfile != "" {
+		return pidfile != 0 && info.pid == pidfile
+	}
+
+	if m.name != "" && info.name != m.name {
+		return false
+	}
+
+	return m.cmdline == nil || m.cmdline.MatchString(info.cmdline)
+}
+
+// groupProcesses раскладывает процессы по группам. В группу процесс
+// попадает один раз, даже если подошёл под несколько её условий.
+func groupProcesses(matchers []processMatcher, pidfiles []int32, infos []procInfo) map[string][]int32 {
+	res := make(map[string][]int32)
+
+	for _, info := range infos {
+		added := make(map[string]bool)
+
+		for i, m := range matchers {
+			if added[m.group] || !m.matches(info, pidfiles[i]) {
+				continue
+			}
+
+			added[m.group] = true
+			res[m.group] = append(res[m.group], info.pid)
+		}
+	}
+
+	return res
+}
+
+// collectProcess добавляет показатели процесса в группу. Часть из них может быть
+// недоступна (например, чужие fd без прав root), такие просто пропускаются.
+func collectProcess(g *processGroup, proc *process.Process) {
+	g.count++
+
+	if cpu, err := proc.Percent(0); err == nil {
+		g.cpu += cpu
+	}
+
+	if mem, err := proc.MemoryInfo(); err == nil {
+		g.rss += mem.RSS
+	}
+
+	if fds, err := proc.NumFDs(); err == nil {
+		g.fds += fds
+	}
+
+	if threads, err := proc.NumThreads(); err == nil {
+		g.threads += threads
+	}
+}
+
+func readPidfile(path string) (int32, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	pid, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 32)
+	if err != nil {
+		return 0, err
+	}
+
+	return int32(pid), nil
+}
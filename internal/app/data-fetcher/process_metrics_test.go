@@ -0,0 +1,130 @@
+package datafetcher
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"testing"
+
+	config "github.com/BeInBloom/spanish-inquisition/internal/config/client-config"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+func TestNewProcessFetcher_Validation(t *testing.T) {
+	tests := []struct {
+		name    string
+		matcher config.ProcessMatcher
+		want    error
+	}{
+		{"no conditions", config.ProcessMatcher{Group: "web"}, ErrEmptyProcessMatcher},
+		{"no group", config.ProcessMatcher{Cmdline: "nginx"}, ErrNoProcessGroup},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewProcessFetcher(config.ProcessConfig{Matchers: []config.ProcessMatcher{tt.matcher}})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewProcessFetcher(config.ProcessConfig{Matchers: []config.ProcessMatcher{{Group: "x", Cmdline: "("}}}); err == nil {
+		t.Fatal("expected error for bad cmdline regexp")
+	}
+}
+
+func TestGroupProcesses(t *testing.T) {
+	matchers := []processMatcher{
+		{group: "web", name: "nginx"},
+		{group: "web", cmdline: regexp.MustCompile(`nginx|envoy`)},
+		{group: "db", name: "postgres", cmdline: regexp.MustCompile(`-D /data`)},
+		{group: "main", pidfile: "main.pid"},
+	}
+	pidfiles := []int32{0, 0, 0, 30}
+
+	infos := []procInfo{
+		{pid: 10, name: "nginx", cmdline: "nginx: master process"},
+		{pid: 11, name: "envoy", cmdline: "envoy -c envoy.yaml"},
+		{pid: 20, name: "postgres", cmdline: "postgres -D /data"},
+		{pid: 21, name: "postgres", cmdline: "postgres -D /tmp"},
+		{pid: 30, name: "nginx", cmdline: "nginx: worker process"},
+	}
+
+	got := groupProcesses(matchers, pidfiles, infos)
+
+	for group, want := range map[string][]int32{
+		"web":  {10, 11, 30},
+		"db":   {20},
+		"main": {30},
+	} {
+		pids := got[group]
+		slices.Sort(pids)
+
+		if !slices.Equal(pids, want) {
+			t.Errorf("%s: got %v, want %v", group, pids, want)
+		}
+	}
+
+	// Нечитаемый pidfile ни с чем не совпадает.
+	if got := groupProcesses(matchers[3:], []int32{0}, infos); len(got) != 0 {
+		t.Fatalf("unreadable pidfile: got %v", got)
+	}
+}
+
+func TestProcessFetcher_Self(t *testing.T) {
+	pid := os.Getpid()
+
+	self, err := process.NewProcess(int32(pid))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name, err := self.Name()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	pidfile := filepath.Join(t.TempDir(), "self.pid")
+	if err := os.WriteFile(pidfile, []byte(strconv.Itoa(pid)+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := NewProcessFetcher(config.ProcessConfig{Matchers: []config.ProcessMatcher{
+		{Group: "self", Pidfile: pidfile},
+		{Group: "self", Name: name},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metrics, err := f.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Под оба условия попадает как минимум этот процесс, но считается он один раз.
+	count, ok := byID(metrics)[`ProcessCount{group="self"}`]
+	if !ok || *count.Value < 1 {
+		t.Fatalf("ProcessCount: got %+v", count)
+	}
+
+	procs, err := process.Processes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sameName float64
+	for _, p := range procs {
+		if n, err := p.Name(); err == nil && n == name {
+			sameName++
+		}
+	}
+
+	if *count.Value > sameName {
+		t.Fatalf("ProcessCount: got %v, at most %v processes are named %q", *count.Value, sameName, name)
+	}
+}
@@ -0,0 +1,211 @@
+package datafetcher
+
+import (
+	"math"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	config "github.com/BeInBloom/spanish-inquisition/internal/config/client-config"
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+)
+
+var histogramQuantiles = []float64{0.5, 0.9, 0.99, 1}
+
+// NewRuntimeFetcher выбирает источник runtime-метрик. По умолчанию остаются
+// старые имена из runtime.MemStats, чтобы не ломать уже собранные серии.
+func NewRuntimeFetcher(cfg config.RuntimeConfig) fetcher {
+	if cfg.Source == config.RuntimeSourceMetrics {
+		return newRuntimeMetricsFetcher()
+	}
+
+	return fetcherFunc(runtimeMetrics)
+}
+
+// runtimeMetricsFetcher читает runtime/metrics, который, в отличие от
+// runtime.ReadMemStats, не останавливает мир.
+type runtimeMetricsFetcher struct {
+	mutex   sync.Mutex
+	samples []metrics.Sample
+	names   map[string]string
+	// cumulative — накопительные uint64-метрики, они отправляются
+	// counter'ами с приростом с прошлого опроса.
+	cumulative map[string]bool
+	prevTotals map[string]uint64
+	prev       map[string][]uint64
+}
+
+func newRuntimeMetricsFetcher() *runtimeMetricsFetcher {
+	var samples []metrics.Sample
+	names := make(map[string]string)
+	cumulative := make(map[string]bool)
+
+	for _, d := range metrics.All() {
+		switch d.Kind {
+		case metrics.KindUint64, metrics.KindFloat64:
+		case metrics.KindFloat64Histogram:
+			// Из гистограмм берём только задержки: паузы GC и планировщика.
+			if !strings.HasSuffix(d.Name, ":seconds") {
+				continue
+			}
+		default:
+			continue
+		}
+
+		samples = append(samples, metrics.Sample{Name: d.Name})
+		names[d.Name] = runtimeMetricName(d.Name)
+		cumulative[d.Name] = d.Cumulative && d.Kind == metrics.KindUint64
+	}
+
+	return &runtimeMetricsFetcher{
+		samples:    samples,
+		names:      names,
+		cumulative: cumulative,
+		prevTotals: make(map[string]uint64),
+		prev:       make(map[string][]uint64),
+	}
+}
+
+func (r *runtimeMetricsFetcher) Fetch() ([]models.Metrics, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	metrics.Read(r.samples)
+
+	result := make([]models.Metrics, 0, len(r.samples))
+
+	for _, s := range r.samples {
+		id := r.names[s.Name]
+
+		switch s.Value.Kind() {
+		case metrics.KindUint64:
+			if !r.cumulative[s.Name] {
+				result = append(result, models.Metrics{MType: Gauge, ID: id, Value: toFloat64Ptr(s.Value.Uint64())})
+				continue
+			}
+
+			if m, ok := r.total(s.Name, id, s.Value.Uint64()); ok {
+				result = append(result, m)
+			}
+		case metrics.KindFloat64:
+			value := s.Value.Float64()
+			if math.IsInf(value, 0) || math.IsNaN(value) {
+				continue
+			}
+
+			result = append(result, models.Metrics{MType: Gauge, ID: id, Value: &value})
+		case metrics.KindFloat64Histogram:
+			result = append(result, r.quantiles(s.Name, id, s.Value.Float64Histogram())...)
+		}
+	}
+
+	return result, nil
+}
+
+// total превращает накопительное значение в прирост с прошлого опроса.
+// На первом опросе прирост считать не от чего, значение только запоминается.
+func (r *runtimeMetricsFetcher) total(name, id string, cur uint64) (models.Metrics, bool) {
+	prev, ok := r.prevTotals[name]
+	r.prevTotals[name] = cur
+
+	if !ok || cur < prev {
+		return models.Metrics{}, false
+	}
+
+	delta := int64(cur - prev)
+
+	return models.Metrics{MType: Counter, ID: id, Delta: &delta}, true
+}
+
+// quantiles считает квантили по приросту гистограммы с прошлого опроса,
+// иначе они бы отражали всё время жизни процесса. Если новых событий не было,
+// серии не отправляются вовсе.
+func (r *runtimeMetricsFetcher) quantiles(name, id string, h *metrics.Float64Histogram) []models.Metrics {
+	counts := make([]uint64, len(h.Counts))
+	copy(counts, h.Counts)
+
+	prev := r.prev[name]
+	r.prev[name] = counts
+
+	var total uint64
+	window := make([]uint64, len(counts))
+
+	for i, c := range counts {
+		if len(prev) == len(counts) && c >= prev[i] {
+			c -= prev[i]
+		}
+
+		window[i] = c
+		total += c
+	}
+
+	if total == 0 {
+		return nil
+	}
+
+	result := make([]models.Metrics, 0, len(histogramQuantiles))
+
+	for _, q := range histogramQuantiles {
+		value := histogramQuantile(q, window, total, h.Buckets)
+		result = append(result, models.Metrics{
+			MType: Gauge,
+			ID:    models.SeriesID(id, map[string]string{"quantile": strconv.FormatFloat(q, 'f', -1, 64)}),
+			Value: &value,
+		})
+	}
+
+	return result
+}
+
+// histogramQuantile возвращает верхнюю границу бакета, в который попал квантиль.
+// Крайние бакеты бывают бесконечными, тогда берётся конечная граница.
+func histogramQuantile(q float64, counts []uint64, total uint64, buckets []float64) float64 {
+	rank := uint64(math.Ceil(q * float64(total)))
+	if rank == 0 {
+		rank = 1
+	}
+
+	var cumulative uint64
+
+	for i, c := range counts {
+		cumulative += c
+		if cumulative < rank {
+			continue
+		}
+
+		upper := buckets[i+1]
+		if math.IsInf(upper, 1) {
+			return buckets[i]
+		}
+
+		return upper
+	}
+
+	return buckets[len(buckets)-1]
+}
+
+// runtimeMetricName переводит имя вида /gc/heap/allocs:bytes в GoGcHeapAllocsBytes.
+func runtimeMetricName(name string) string {
+	var b strings.Builder
+
+	b.WriteString("Go")
+
+	upper := true
+	for _, r := range name {
+		if r == '/' || r == ':' || r == '-' || r == '*' {
+			upper = true
+			continue
+		}
+
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
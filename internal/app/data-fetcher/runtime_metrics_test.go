@@ -0,0 +1,90 @@
+package datafetcher
+
+import (
+	"math"
+	"runtime/metrics"
+	"testing"
+)
+
+func TestRuntimeMetricName(t *testing.T) {
+	for name, want := range map[string]string{
+		"/gc/heap/allocs:bytes":              "GoGcHeapAllocsBytes",
+		"/sched/latencies:seconds":           "GoSchedLatenciesSeconds",
+		"/memory/classes/heap/free:bytes":    "GoMemoryClassesHeapFreeBytes",
+		"/gc/cycles/forced:gc-cycles":        "GoGcCyclesForcedGcCycles",
+		"/sync/mutex/wait/total:seconds":     "GoSyncMutexWaitTotalSeconds",
+		"/cpu/classes/gc/mark/*:cpu-seconds": "GoCpuClassesGcMarkCpuSeconds",
+	} {
+		if got := runtimeMetricName(name); got != want {
+			t.Errorf("runtimeMetricName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	buckets := []float64{math.Inf(-1), 1, 2, 4, math.Inf(1)}
+
+	tests := []struct {
+		name   string
+		q      float64
+		counts []uint64
+		want   float64
+	}{
+		{"median", 0.5, []uint64{0, 2, 2, 0}, 2},
+		{"upper bucket", 0.9, []uint64{0, 2, 2, 0}, 4},
+		{"max in the infinite bucket", 1, []uint64{0, 1, 0, 1}, 4},
+		{"min in the infinite bucket", 0.5, []uint64{3, 0, 0, 0}, 1},
+		{"zero quantile", 0, []uint64{0, 0, 5, 0}, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var total uint64
+			for _, c := range tt.counts {
+				total += c
+			}
+
+			if got := histogramQuantile(tt.q, tt.counts, total, buckets); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuntimeMetricsFetcher_Deltas(t *testing.T) {
+	r := newRuntimeMetricsFetcher()
+	h := &metrics.Float64Histogram{
+		Buckets: []float64{0, 1, 2, 3},
+		Counts:  []uint64{10, 0, 0},
+	}
+
+	// Первый опрос: квантили по всему накопленному.
+	first := byID(r.quantiles("/x:seconds", "GoX", h))
+	if m := first[`GoX{quantile="0.99"}`]; m.Value == nil || *m.Value != 1 {
+		t.Fatalf("first poll p99: got %+v, want 1", m)
+	}
+
+	// Дальше — только по новым событиям: старые 10 в нижнем бакете не в счёт.
+	h.Counts = []uint64{10, 0, 4}
+	second := byID(r.quantiles("/x:seconds", "GoX", h))
+	if m := second[`GoX{quantile="0.5"}`]; m.Value == nil || *m.Value != 3 {
+		t.Fatalf("second poll p50: got %+v, want 3", m)
+	}
+
+	if got := r.quantiles("/x:seconds", "GoX", h); len(got) != 0 {
+		t.Fatalf("no new events: got %d series, want none", len(got))
+	}
+
+	if _, ok := r.total("/gc/cycles/total:gc-cycles", "GoGcCyclesTotalGcCycles", 7); ok {
+		t.Fatal("first poll of a cumulative metric must only be remembered")
+	}
+
+	m, ok := r.total("/gc/cycles/total:gc-cycles", "GoGcCyclesTotalGcCycles", 12)
+	if !ok || m.MType != Counter || *m.Delta != 5 {
+		t.Fatalf("cumulative metric: got %+v, want counter delta 5", m)
+	}
+
+	if !r.cumulative["/gc/cycles/total:gc-cycles"] || r.cumulative["/gc/heap/live:bytes"] {
+		t.Fatal("cumulative flags are not taken from the metric descriptions")
+	}
+}
@@ -0,0 +1,115 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	config "github.com/BeInBloom/spanish-inquisition/internal/config/server-config"
+	"github.com/BeInBloom/spanish-inquisition/internal/limiter"
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+	"github.com/BeInBloom/spanish-inquisition/internal/pubsub"
+	"github.com/BeInBloom/spanish-inquisition/internal/replication"
+	"github.com/BeInBloom/spanish-inquisition/internal/repository/memrepository"
+	"github.com/BeInBloom/spanish-inquisition/internal/webhooks"
+	"go.uber.org/zap"
+)
+
+// denyAll отклоняет любую запись и запоминает, что у него спрашивали.
+type denyAll struct {
+	mutex    sync.Mutex
+	admitted [][]models.Metrics
+}
+
+func (d *denyAll) Admit(_ string, metrics []models.Metrics) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.admitted = append(d.admitted, metrics)
+
+	return limiter.ErrSeriesLimit
+}
+
+func (d *denyAll) Usage() limiter.Usage {
+	return limiter.Usage{}
+}
+
+func TestWriteRoutesAreLimited(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	repoCfg := config.Config{}
+	repoCfg.BakConfig.Path = filepath.Join(t.TempDir(), "bak.json")
+	repoCfg.StoreInterval = 300
+
+	storage := memrepository.New(repoCfg)
+	if err := storage.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err := replication.New(ctx, config.ReplicationConfig{}, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	hub := pubsub.New()
+
+	hooks, err := webhooks.New(ctx, config.WebhooksConfig{}, hub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limits := &denyAll{}
+
+	a := New(config.ServerConfig{Timeout: time.Second}, zap.NewNop(), repo, repo, limits, hub, hooks, repo)
+	a.Init()
+
+	srv := httptest.NewServer(a.server.Handler)
+	defer srv.Close()
+
+	requests := []struct {
+		path, contentType, body string
+		want                    string
+	}{
+		{"/update/gauge/load/0.5", "text/plain", "", "load"},
+		{"/update/", "application/json", `{"id":"requests","type":"counter","delta":1}`, "requests"},
+		{"/updates/", "application/json", `[{"id":"temp","type":"gauge","value":36.6}]`, "temp"},
+	}
+
+	for i, tt := range requests {
+		resp, err := http.Post(srv.URL+tt.path, tt.contentType, strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusTooManyRequests {
+			t.Errorf("%s: got %d, want 429", tt.path, resp.StatusCode)
+		}
+
+		if len(limits.admitted) != i+1 || len(limits.admitted[i]) != 1 || limits.admitted[i][0].ID != tt.want {
+			t.Fatalf("%s: limiter saw %+v, want series %s", tt.path, limits.admitted, tt.want)
+		}
+	}
+
+	// Ошибочная запись до лимитера не доходит: её отклонит ручка.
+	resp, err := http.Post(srv.URL+"/update/counter/requests/1.5", "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest || len(limits.admitted) != len(requests) {
+		t.Fatalf("invalid write: got %d, limiter called %d times", resp.StatusCode, len(limits.admitted))
+	}
+
+	if _, err := repo.Get(models.Metrics{ID: "load", MType: models.Gauge}); err == nil {
+		t.Fatal("rejected write was stored")
+	}
+}
@@ -0,0 +1,190 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	config "github.com/BeInBloom/spanish-inquisition/internal/config/server-config"
+	"github.com/BeInBloom/spanish-inquisition/internal/limiter"
+	"github.com/BeInBloom/spanish-inquisition/internal/middlewares"
+	"github.com/BeInBloom/spanish-inquisition/internal/pubsub"
+	"github.com/BeInBloom/spanish-inquisition/internal/relabel"
+	"github.com/BeInBloom/spanish-inquisition/internal/replication"
+	"github.com/BeInBloom/spanish-inquisition/internal/repository/memrepository"
+	"github.com/BeInBloom/spanish-inquisition/internal/webhooks"
+	"go.uber.org/zap"
+)
+
+const testKey = "secret"
+
+func startNode(t *testing.T, ctx context.Context, cfg config.ReplicationConfig) *httptest.Server {
+	t.Helper()
+
+	repoCfg := config.Config{}
+	repoCfg.BakConfig.Path = filepath.Join(t.TempDir(), "bak.json")
+	repoCfg.StoreInterval = 300
+
+	storage := memrepository.New(repoCfg)
+	if err := storage.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err := replication.New(ctx, cfg, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hub := pubsub.New()
+
+	rules, err := relabel.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limits, err := limiter.New(ctx, config.LimitsConfig{}, repo, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hooks, err := webhooks.New(ctx, config.WebhooksConfig{}, hub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := New(config.ServerConfig{Key: testKey, Timeout: time.Second}, zap.NewNop(), repo, repo, limits, hub, hooks, repo)
+	a.Init()
+
+	srv := httptest.NewServer(a.server.Handler)
+	t.Cleanup(func() {
+		close(a.streamsDone)
+		srv.Close()
+		repo.Close()
+	})
+
+	return srv
+}
+
+func post(t *testing.T, url string, sign bool) int {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "text/plain")
+
+	if sign {
+		middlewares.SignRequest(req, nil, testKey)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode
+}
+
+func get(t *testing.T, url string) (int, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "text/plain")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	return resp.StatusCode, string(body)
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReplication(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	primary := startNode(t, ctx, config.ReplicationConfig{Role: replication.RolePrimary})
+
+	// Часть записей приходит до подключения реплики и доезжает снимком.
+	if code := post(t, primary.URL+"/update/counter/requests/5", false); code != http.StatusOK {
+		t.Fatalf("primary write: got %d", code)
+	}
+
+	secondary := startNode(t, ctx, config.ReplicationConfig{
+		Role:    replication.RoleSecondary,
+		Primary: strings.TrimPrefix(primary.URL, "http://"),
+	})
+
+	post(t, primary.URL+"/update/counter/requests/7", false)
+	post(t, primary.URL+"/update/gauge/load/0.5", false)
+
+	waitFor(t, "counter on secondary", func() bool {
+		code, body := get(t, secondary.URL+"/value/counter/requests")
+		return code == http.StatusOK && body == "12"
+	})
+
+	waitFor(t, "gauge on secondary", func() bool {
+		code, body := get(t, secondary.URL+"/value/gauge/load")
+		return code == http.StatusOK && body == "0.5"
+	})
+
+	if code := post(t, secondary.URL+"/update/counter/requests/1", false); code != http.StatusServiceUnavailable {
+		t.Errorf("write to passive secondary: got %d, want 503", code)
+	}
+
+	var status replication.Status
+	waitFor(t, "secondary to catch up", func() bool {
+		_, body := get(t, secondary.URL+"/replication/status")
+		if err := json.Unmarshal([]byte(body), &status); err != nil {
+			t.Fatal(err)
+		}
+		return status.Connected && status.LagOps == 0 && status.Seq == 3
+	})
+
+	if code := post(t, secondary.URL+"/replication/promote", true); code != http.StatusOK {
+		t.Fatalf("promote: got %d", code)
+	}
+
+	if code := post(t, secondary.URL+"/update/counter/requests/1", false); code != http.StatusOK {
+		t.Errorf("write to promoted secondary: got %d, want 200", code)
+	}
+
+	if _, body := get(t, secondary.URL+"/value/counter/requests"); body != "13" {
+		t.Errorf("counter after promote: got %s, want 13", body)
+	}
+
+	_, body := get(t, secondary.URL+"/replication/status")
+	if err := json.Unmarshal([]byte(body), &status); err != nil {
+		t.Fatal(err)
+	}
+
+	if status.Role != replication.RolePrimary || status.Seq != 4 {
+		t.Errorf("status after promote: got %+v", status)
+	}
+}
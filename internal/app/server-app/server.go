@@ -10,8 +10,13 @@ import (
 
 	config "github.com/BeInBloom/spanish-inquisition/internal/config/server-config"
 	"github.com/BeInBloom/spanish-inquisition/internal/handlers"
+	"github.com/BeInBloom/spanish-inquisition/internal/limiter"
 	"github.com/BeInBloom/spanish-inquisition/internal/middlewares"
 	"github.com/BeInBloom/spanish-inquisition/internal/models"
+	"github.com/BeInBloom/spanish-inquisition/internal/pubsub"
+	"github.com/BeInBloom/spanish-inquisition/internal/query"
+	"github.com/BeInBloom/spanish-inquisition/internal/replication"
+	"github.com/BeInBloom/spanish-inquisition/internal/webhooks"
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
@@ -28,18 +33,61 @@ type repository interface {
 	CreateOrUpdate(models.Metrics) error
 	Get(models.Metrics) (models.Metrics, error)
 	Dump() ([]models.Metrics, error)
+	List(query.Filter) (query.Page, error)
+	Aggregate(query.Aggregation) ([]query.Sample, error)
+	Select(query.Selector) ([]query.Sample, error)
+	History(item models.Metrics, since time.Time) ([]models.Point, error)
+	Delete(models.Metrics) error
+	Reset(models.Metrics) error
 	Check() error
 }
 
+// writer отвечает за путь записи: все ручки, которые пишут метрики,
+// должны ходить через него, а не напрямую в repo.
+type writer interface {
+	CreateOrUpdate(models.Metrics) error
+}
+
+// seriesLimiter ограничивает число серий, которые могут создать клиенты.
+type seriesLimiter interface {
+	Admit(source string, metrics []models.Metrics) error
+	Usage() limiter.Usage
+}
+
+type hub interface {
+	Subscribe(f pubsub.Filter, buffer int) *pubsub.Subscription
+	Unsubscribe(s *pubsub.Subscription)
+}
+
+type webhookRegistry interface {
+	List() []webhooks.Subscription
+	Add(webhooks.Subscription) error
+	Remove(id string) error
+}
+
+type replicator interface {
+	Writable() bool
+	Status() replication.Status
+	Promote() error
+	Follow(ctx context.Context, done <-chan struct{}, logID string, after uint64, send func(replication.Op) error) error
+}
+
 type app struct {
-	server *http.Server
-	repo   repository
-	log    *zap.Logger
-	key    string
+	server  *http.Server
+	repo    repository
+	writer  writer
+	limiter seriesLimiter
+	hub     hub
+	hooks   webhookRegistry
+	repl    replicator
+	log     *zap.Logger
+	key     string
+
+	streamsDone chan struct{}
 }
 
-func New(config config.ServerConfig, log *zap.Logger, repo repository) *app {
-	return &app{
+func New(config config.ServerConfig, log *zap.Logger, repo repository, writer writer, limiter seriesLimiter, hub hub, hooks webhookRegistry, repl replicator) *app {
+	a := &app{
 		server: &http.Server{
 			Addr:         config.Address,
 			Handler:      nil,
@@ -47,10 +95,23 @@ func New(config config.ServerConfig, log *zap.Logger, repo repository) *app {
 			WriteTimeout: config.Timeout,
 			IdleTimeout:  config.IdleTimeout,
 		},
-		repo: repo,
-		log:  log,
-		key:  config.Key,
+		repo:    repo,
+		writer:  writer,
+		limiter: limiter,
+		hub:     hub,
+		hooks:   hooks,
+		repl:    repl,
+		log:     log,
+		key:     config.Key,
+
+		streamsDone: make(chan struct{}),
 	}
+
+	a.server.RegisterOnShutdown(func() {
+		close(a.streamsDone)
+	})
+
+	return a
 }
 
 func (a *app) Run() error {
@@ -86,8 +147,29 @@ func (a *app) Init() {
 }
 
 func (a *app) initHandlers() {
-	r := chi.NewRouter()
+	root := chi.NewRouter()
+
+	// Стриму не подходят сжатие и логгер с буферизацией: их обёртки
+	// не дают снять WriteTimeout и сбрасывать события сразу.
+	root.Group(func(r chi.Router) {
+		r.Use(
+			middleware.RequestID,
+			middleware.RealIP,
+			middleware.Recoverer,
+		)
+
+		r.Get("/stream", handlers.Stream(a.hub, a.streamsDone))
+		r.Get(replication.OplogPath, handlers.ReplicationLog(a.repl, a.streamsDone))
+	})
+
+	root.Group(func(r chi.Router) {
+		a.initAPIHandlers(r)
+	})
 
+	a.server.Handler = root
+}
+
+func (a *app) initAPIHandlers(r chi.Router) {
 	r.Use(
 		middleware.Compress(5, "application/json", "text/html"),
 		middlewares.Decomp,
@@ -111,15 +193,41 @@ func (a *app) initHandlers() {
 			r.With(middleware.AllowContentType("application/json")).Get("/", handlers.GetDataByJSON(a.repo, a.key))
 			r.With(middleware.AllowContentType("application/json")).Post("/", handlers.GetDataByJSON(a.repo, a.key))
 			r.With(middleware.AllowContentType("text/plain")).Get("/{type}/{name}", handlers.GetData(a.repo))
+			r.With(middlewares.RequireWritable(a.repl), middlewares.RequireHash(a.key)).Delete("/{type}/{name}", handlers.DeleteData(a.repo))
+		})
+		r.Route("/deletes", func(r chi.Router) {
+			r.Use(middlewares.RequireWritable(a.repl))
+			r.With(middleware.AllowContentType("application/json"), middlewares.RequireHash(a.key)).Post("/", handlers.DeleteDataByJSONBatch(a.repo))
+		})
+		r.Route("/rate", func(r chi.Router) {
+			r.Get("/counter/{name}", handlers.GetRate(a.repo))
+		})
+		r.Route("/reset", func(r chi.Router) {
+			r.Use(middlewares.RequireWritable(a.repl))
+			r.With(middlewares.RequireHash(a.key)).Post("/counter/{name}", handlers.ResetCounter(a.repo))
 		})
 		r.Route("/update", func(r chi.Router) {
-			r.With(middleware.AllowContentType("application/json")).Post("/", handlers.CreateOrUpdateByJSON(a.repo))
-			r.With(middleware.AllowContentType("text/plain")).Post("/{type}/{name}/{value}", handlers.CreateOrUpdate(a.repo))
+			r.Use(middlewares.RequireWritable(a.repl))
+			r.With(middleware.AllowContentType("application/json"), middlewares.LimitSeries(a.limiter)).Post("/", handlers.CreateOrUpdateByJSON(a.writer))
+			r.With(middleware.AllowContentType("text/plain"), middlewares.LimitSeries(a.limiter)).Post("/{type}/{name}/{value}", handlers.CreateOrUpdate(a.writer))
 		})
 		r.Route("/updates", func(r chi.Router) {
-			r.With(middleware.AllowContentType("application/json")).Post("/", handlers.CreateOrUpdateByJSONBatch(a.repo))
+			r.Use(middlewares.RequireWritable(a.repl))
+			r.With(middleware.AllowContentType("application/json"), middlewares.LimitSeries(a.limiter)).Post("/", handlers.CreateOrUpdateByJSONBatch(a.writer))
+		})
+		r.Route("/api", func(r chi.Router) {
+			r.Get("/metrics", handlers.ListMetrics(a.repo))
+			r.Get("/query", handlers.Query(a.repo))
+		})
+		r.Route("/admin", func(r chi.Router) {
+			r.Get("/limits", handlers.GetLimits(a.limiter))
+			r.Get("/webhooks", handlers.ListWebhooks(a.hooks))
+			r.With(middleware.AllowContentType("application/json"), middlewares.RequireHash(a.key)).Post("/webhooks", handlers.AddWebhook(a.hooks))
+			r.With(middlewares.RequireHash(a.key)).Delete("/webhooks/{id}", handlers.DeleteWebhook(a.hooks))
+		})
+		r.Route("/replication", func(r chi.Router) {
+			r.Get("/status", handlers.ReplicationStatus(a.repl))
+			r.With(middlewares.RequireHash(a.key)).Post("/promote", handlers.PromoteReplica(a.repl))
 		})
 	})
-
-	a.server.Handler = r
 }
@@ -0,0 +1,47 @@
+// Package apperrors — общие ошибки предметной области. Пакеты объявляют
+// свои ошибки через New поверх одного из видов ниже, а ручки по виду
+// выбирают HTTP-статус ответа.
+package apperrors
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrValidation  = errors.New("validation failed")
+	ErrNotFound    = errors.New("not found")
+	ErrConflict    = errors.New("conflict")
+	ErrUnavailable = errors.New("unavailable")
+	ErrRateLimited = errors.New("rate limited")
+	ErrForbidden   = errors.New("forbidden")
+)
+
+// Error — ошибка одного из видов со своим кодом для ответа API.
+// Ошибка без вида (kind == nil) — внутренняя.
+type Error struct {
+	kind error
+	code string
+	msg  string
+}
+
+func New(kind error, code, msg string) *Error {
+	return &Error{kind: kind, code: code, msg: msg}
+}
+
+func (e *Error) Error() string {
+	return e.msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.kind
+}
+
+func (e *Error) Code() string {
+	return e.code
+}
+
+// Wrap относит чужую ошибку (разбора, базы, диска) к одному из видов.
+func Wrap(kind, err error) error {
+	return fmt.Errorf("%w: %w", kind, err)
+}
@@ -0,0 +1,70 @@
+package apperrors
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// Body — тело ответа с ошибкой.
+type Body struct {
+	Code  string `json:"code"`
+	Error string `json:"error"`
+}
+
+var kinds = []struct {
+	kind   error
+	status int
+	code   string
+}{
+	{ErrValidation, http.StatusBadRequest, "validation_failed"},
+	{ErrForbidden, http.StatusForbidden, "forbidden"},
+	{ErrNotFound, http.StatusNotFound, "not_found"},
+	{ErrConflict, http.StatusConflict, "conflict"},
+	{ErrRateLimited, http.StatusTooManyRequests, "rate_limited"},
+	{ErrUnavailable, http.StatusServiceUnavailable, "unavailable"},
+}
+
+// Status возвращает HTTP-статус и код ответа для ошибки. Код берётся
+// из *Error, если он есть в цепочке, иначе — код вида. Ошибка без
+// вида — внутренняя.
+func Status(err error) (int, string) {
+	status, code := http.StatusInternalServerError, "internal"
+
+	for _, k := range kinds {
+		if errors.Is(err, k.kind) {
+			status, code = k.status, k.code
+			break
+		}
+	}
+
+	var e *Error
+	if errors.As(err, &e) && e.code != "" {
+		code = e.code
+	}
+
+	return status, code
+}
+
+// Write отвечает ошибкой в JSON. Текст ошибок 5xx наружу не отдаётся —
+// в нём бывают адреса и подробности хранилища, — кроме объявленных
+// через New.
+func Write(w http.ResponseWriter, err error) {
+	status, code := Status(err)
+
+	msg := err.Error()
+	if status >= http.StatusInternalServerError {
+		msg = http.StatusText(status)
+
+		var e *Error
+		if errors.As(err, &e) {
+			msg = e.Error()
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Del("Content-Length")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(Body{Code: code, Error: msg})
+}
@@ -0,0 +1,43 @@
+package apperrors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	readOnly := New(ErrUnavailable, "read_only", "node is a passive secondary")
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		body   Body
+	}{
+		{"declared", fmt.Errorf("node.CreateOrUpdate: %w", readOnly), http.StatusServiceUnavailable, Body{"read_only", "node is a passive secondary"}},
+		{"kind", fmt.Errorf("repo.Get: %w", ErrNotFound), http.StatusNotFound, Body{"not_found", "repo.Get: not found"}},
+		{"wrapped", Wrap(ErrValidation, errors.New("bad json")), http.StatusBadRequest, Body{"validation_failed", "validation failed: bad json"}},
+		{"hidden", Wrap(ErrUnavailable, errors.New("dial tcp 10.0.0.1:5432")), http.StatusServiceUnavailable, Body{"unavailable", "Service Unavailable"}},
+		{"internal", errors.New("boom"), http.StatusInternalServerError, Body{"internal", "Internal Server Error"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			Write(w, tt.err)
+
+			var body Body
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+
+			if w.Code != tt.status || body != tt.body {
+				t.Fatalf("got %d %+v, want %d %+v", w.Code, body, tt.status, tt.body)
+			}
+		})
+	}
+}
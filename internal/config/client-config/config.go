@@ -13,18 +13,47 @@ import (
 )
 
 var (
-	ErrUnexpectedFlag = errors.New("unexpected flag")
+	ErrUnexpectedFlag       = errors.New("unexpected flag")
+	ErrUnknownRuntimeSource = errors.New("unknown runtime metrics source")
+	ErrDuplicateExecScript  = errors.New("exec script name is not unique")
 )
 
 const (
 	ConfigEnv         = "CONFIG_PATH"
 	DefaultConfigPath = "./config/client-config.yaml"
+
+	RuntimeSourceMemStats = "memstats"
+	RuntimeSourceMetrics  = "runtime"
 )
 
 type Config struct {
-	SaverConfig  SaverConfig `yaml:"saver" json:"saver"`
-	PollInterval int         `yaml:"polling" json:"polling" env:"POLL_INTERVAL"`
-	AppConfig    AppConfig   `yaml:"app" json:"app"`
+	SaverConfig      SaverConfig      `yaml:"saver" json:"saver"`
+	PollInterval     int              `yaml:"polling" json:"polling" env:"POLL_INTERVAL"`
+	AppConfig        AppConfig        `yaml:"app" json:"app"`
+	CollectorsConfig CollectorsConfig `yaml:"collectors" json:"collectors"`
+	Relabel          []RelabelRule    `yaml:"relabel" json:"relabel"`
+}
+
+// RelabelRule применяется к метрикам, имя которых целиком совпадает с Match
+// (пустой Match совпадает со всеми), а тип с Type, если он задан.
+//
+//   - keep: оставить только совпавшие метрики;
+//   - drop: выкинуть совпавшие метрики;
+//   - reject: отклонить совпавшие метрики как ошибочные (агент их просто выкидывает);
+//   - rename: заменить имя на Replacement, в нём доступны группы $1, $2...;
+//   - label: добавить метки Labels;
+//   - prefix: дописать Replacement перед именем;
+//   - coerce: сделать counter gauge'ем (To: gauge).
+//
+// В префиксе и значениях Labels раскрываются переменные окружения,
+// $HOSTNAME по умолчанию берётся из os.Hostname.
+type RelabelRule struct {
+	Action      string            `yaml:"action" json:"action"`
+	Match       string            `yaml:"match" json:"match"`
+	Type        string            `yaml:"type" json:"type"`
+	Replacement string            `yaml:"replacement" json:"replacement"`
+	Labels      map[string]string `yaml:"labels" json:"labels"`
+	To          string            `yaml:"to" json:"to"`
 }
 
 // // TODO: переделать это говно
@@ -38,9 +67,89 @@ type AppConfig struct {
 	ReportInterval int `yaml:"report_interval" json:"report_interval" env:"REPORT_INTERVAL"`
 }
 
+type CollectorsConfig struct {
+	Net     NetConfig     `yaml:"net" json:"net"`
+	Process ProcessConfig `yaml:"process" json:"process"`
+	Cgroup  CgroupConfig  `yaml:"cgroup" json:"cgroup"`
+	Runtime RuntimeConfig `yaml:"runtime" json:"runtime"`
+	Exec    ExecConfig    `yaml:"exec" json:"exec"`
+}
+
+type ExecConfig struct {
+	Scripts []ExecScript `yaml:"scripts" json:"scripts"`
+}
+
+// Скрипт должен печатать в stdout либо JSON-массив метрик,
+// либо строки вида "gauge Temperature 36.6". Без имени скрипт
+// называется своей командой целиком.
+type ExecScript struct {
+	Name     string   `yaml:"name" json:"name"`
+	Command  string   `yaml:"command" json:"command"`
+	Args     []string `yaml:"args" json:"args"`
+	Schedule `yaml:",inline"`
+}
+
+func (s ExecScript) ScriptName() string {
+	if s.Name != "" {
+		return s.Name
+	}
+
+	return s.Command
+}
+
+// Source: "memstats" (имена из runtime.MemStats) или "runtime" (пакет runtime/metrics).
+type RuntimeConfig struct {
+	Source   string `yaml:"source" json:"source" env:"RUNTIME_METRICS"`
+	Schedule `yaml:",inline"`
+}
+
+// Schedule задаёт свой интервал опроса и таймаут сборщика в секундах.
+// Нулевые значения означают интервал опроса агента.
+type Schedule struct {
+	Interval int `yaml:"interval" json:"interval"`
+	Timeout  int `yaml:"timeout" json:"timeout"`
+}
+
+type NetConfig struct {
+	Enabled    bool   `yaml:"enabled" json:"enabled" env:"NET_METRICS"`
+	Interfaces string `yaml:"interfaces" json:"interfaces" env:"NET_INTERFACES"`
+	Schedule   `yaml:",inline"`
+}
+
+type CgroupConfig struct {
+	Enabled  bool   `yaml:"enabled" json:"enabled" env:"CGROUP_METRICS"`
+	Root     string `yaml:"root" json:"root" env:"CGROUP_ROOT"`
+	Schedule `yaml:",inline"`
+}
+
+type ProcessConfig struct {
+	Matchers []ProcessMatcher `yaml:"matchers" json:"matchers"`
+	Schedule `yaml:",inline"`
+}
+
+// Процесс попадает в группу, если совпали все заданные условия.
+// Если задан pidfile, остальные условия не проверяются.
+type ProcessMatcher struct {
+	Group   string `yaml:"group" json:"group"`
+	Name    string `yaml:"name" json:"name"`
+	Cmdline string `yaml:"cmdline" json:"cmdline"`
+	Pidfile string `yaml:"pidfile" json:"pidfile"`
+}
+
 func New() *Config {
 	const fn = "cfg.New"
 
+	config := load()
+	if err := config.validate(); err != nil {
+		panic(fmt.Sprintf("%v: %v", fn, err))
+	}
+
+	return config
+}
+
+func load() *Config {
+	const fn = "cfg.load"
+
 	configPath := os.Getenv(ConfigEnv)
 	if configPath == "" {
 		return getEnvAndFlagConfig()
@@ -60,6 +169,25 @@ func New() *Config {
 	}
 }
 
+func (c *Config) validate() error {
+	switch c.CollectorsConfig.Runtime.Source {
+	case "", RuntimeSourceMemStats, RuntimeSourceMetrics:
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownRuntimeSource, c.CollectorsConfig.Runtime.Source)
+	}
+
+	scripts := make(map[string]struct{}, len(c.CollectorsConfig.Exec.Scripts))
+	for _, s := range c.CollectorsConfig.Exec.Scripts {
+		if _, ok := scripts[s.ScriptName()]; ok {
+			return fmt.Errorf("%w: %q", ErrDuplicateExecScript, s.ScriptName())
+		}
+
+		scripts[s.ScriptName()] = struct{}{}
+	}
+
+	return nil
+}
+
 func parseConfigFromJSON(configPath string) *Config {
 	const fn = "cfg.parseConfigFromJSON"
 
@@ -100,6 +228,11 @@ func parseConfigFromFlags() *Config {
 	pflag.IntVarP(&config.PollInterval, "poll-interval", "p", 10, "polling interval")
 	pflag.IntVarP(&config.SaverConfig.Timeout, "timeout", "t", 10, "timeout")
 	pflag.StringVarP(&config.SaverConfig.Key, "key", "k", "", "key")
+	pflag.BoolVar(&config.CollectorsConfig.Net.Enabled, "net-metrics", false, "collect network interface metrics")
+	pflag.StringVar(&config.CollectorsConfig.Net.Interfaces, "net-interfaces", "", "network interfaces regexp")
+	pflag.StringVar(&config.CollectorsConfig.Runtime.Source, "runtime-metrics", RuntimeSourceMemStats, "runtime metrics source: memstats or runtime")
+	pflag.BoolVar(&config.CollectorsConfig.Cgroup.Enabled, "cgroup-metrics", false, "collect cgroup v2 container metrics")
+	pflag.StringVar(&config.CollectorsConfig.Cgroup.Root, "cgroup-root", "/sys/fs/cgroup", "cgroup v2 root")
 	pflag.Parse()
 
 	if pflag.NArg() > 0 {
@@ -142,4 +275,24 @@ func checkEnvConfig(config *Config) {
 	if envConfig.SaverConfig.Key != "" {
 		config.SaverConfig.Key = envConfig.SaverConfig.Key
 	}
+
+	if envConfig.CollectorsConfig.Net.Enabled {
+		config.CollectorsConfig.Net.Enabled = envConfig.CollectorsConfig.Net.Enabled
+	}
+
+	if envConfig.CollectorsConfig.Net.Interfaces != "" {
+		config.CollectorsConfig.Net.Interfaces = envConfig.CollectorsConfig.Net.Interfaces
+	}
+
+	if envConfig.CollectorsConfig.Runtime.Source != "" {
+		config.CollectorsConfig.Runtime.Source = envConfig.CollectorsConfig.Runtime.Source
+	}
+
+	if envConfig.CollectorsConfig.Cgroup.Enabled {
+		config.CollectorsConfig.Cgroup.Enabled = envConfig.CollectorsConfig.Cgroup.Enabled
+	}
+
+	if envConfig.CollectorsConfig.Cgroup.Root != "" {
+		config.CollectorsConfig.Cgroup.Root = envConfig.CollectorsConfig.Cgroup.Root
+	}
 }
@@ -23,15 +23,52 @@ const (
 )
 
 type Config struct {
-	ServerConfig `yaml:"server" json:"server"`
-	EnvConfig    `yaml:"env" json:"env"`
-	DBConfig     `yaml:"database" json:"database"`
+	ServerConfig      `yaml:"server" json:"server"`
+	EnvConfig         `yaml:"env" json:"env"`
+	DBConfig          `yaml:"database" json:"database"`
+	IngestConfig      `yaml:"ingest" json:"ingest"`
+	LimitsConfig      `yaml:"limits" json:"limits"`
+	RecordingConfig   `yaml:"recording" json:"recording"`
+	WebhooksConfig    `yaml:"webhooks" json:"webhooks"`
+	FederationConfig  `yaml:"federation" json:"federation"`
+	ReplicationConfig `yaml:"replication" json:"replication"`
 }
 
 type DBConfig struct {
-	Address    string `yaml:"address" json:"address" env:"DATABASE_DSN"`
-	DriverName string `yaml:"driver" json:"driver" env:"DATABASE_DRIVER"`
-	BakConfig  `yaml:"bakconfig" json:"bakconfig"`
+	Address          string `yaml:"address" json:"address" env:"DATABASE_DSN"`
+	DriverName       string `yaml:"driver" json:"driver" env:"DATABASE_DRIVER"`
+	BakConfig        `yaml:"bakconfig" json:"bakconfig"`
+	RetentionConfig  `yaml:"retention" json:"retention"`
+	CacheConfig      `yaml:"cache" json:"cache"`
+	LogStorageConfig `yaml:"log_storage" json:"log_storage"`
+}
+
+// Если Dir задан и база не указана, метрики хранятся в журнале сегментов
+// в этом каталоге. Сегмент закрывается, дорастя до SegmentSize байт,
+// закрытые сегменты сжимаются раз в CompactInterval.
+type LogStorageConfig struct {
+	Dir             string        `yaml:"dir" json:"dir" env:"LOG_STORAGE_DIR"`
+	SegmentSize     int64         `yaml:"segment_size" json:"segment_size" env:"LOG_SEGMENT_SIZE"`
+	CompactInterval time.Duration `yaml:"compact_interval" json:"compact_interval" env:"LOG_COMPACT_INTERVAL"`
+}
+
+// Если Enabled, репозиторий оборачивается кешем: чтение идёт из памяти,
+// запись копится и сбрасывается в хранилище раз в FlushInterval
+// или при FlushSize накопленных серий.
+type CacheConfig struct {
+	Enabled       bool          `yaml:"enabled" json:"enabled" env:"CACHE_ENABLED"`
+	FlushInterval time.Duration `yaml:"flush_interval" json:"flush_interval" env:"CACHE_FLUSH_INTERVAL"`
+	FlushSize     int           `yaml:"flush_size" json:"flush_size" env:"CACHE_FLUSH_SIZE"`
+}
+
+// Серии, которые не обновлялись дольше TTL, помечаются устаревшими
+// (mode: mark) или удаляются (mode: delete). Нулевой TTL отключает очистку.
+// HistoryRetention — сколько хранить историю counter'ов для расчёта rate.
+type RetentionConfig struct {
+	TTL              time.Duration `yaml:"ttl" json:"ttl" env:"METRIC_TTL"`
+	Mode             string        `yaml:"mode" json:"mode" env:"METRIC_TTL_MODE"`
+	SweepInterval    time.Duration `yaml:"sweep_interval" json:"sweep_interval" env:"METRIC_SWEEP_INTERVAL"`
+	HistoryRetention time.Duration `yaml:"history_retention" json:"history_retention" env:"METRIC_HISTORY_RETENTION"`
 }
 
 type ServerConfig struct {
@@ -46,6 +83,65 @@ type EnvConfig struct {
 	Env string `yaml:"env" json:"env"`
 }
 
+// Правила из RulesPath (YAML-список) выполняются после правил из Rules.
+type IngestConfig struct {
+	Rules     []RelabelRule `yaml:"rules" json:"rules"`
+	RulesPath string        `yaml:"rules_path" json:"rules_path" env:"INGEST_RULES_PATH"`
+}
+
+// RelabelRule — правило ingest, действия те же, что у relabel на агенте;
+// reject здесь отвечает клиенту ошибкой.
+type RelabelRule struct {
+	Action      string            `yaml:"action" json:"action"`
+	Match       string            `yaml:"match" json:"match"`
+	Type        string            `yaml:"type" json:"type"`
+	Replacement string            `yaml:"replacement" json:"replacement"`
+	Labels      map[string]string `yaml:"labels" json:"labels"`
+	To          string            `yaml:"to" json:"to"`
+}
+
+// Правила записи читаются из YAML-файла RulesPath и считаются раз в Interval.
+type RecordingConfig struct {
+	RulesPath string        `yaml:"rules_path" json:"rules_path" env:"RECORDING_RULES_PATH"`
+	Interval  time.Duration `yaml:"interval" json:"interval" env:"RECORDING_INTERVAL"`
+}
+
+// Подписки на вебхуки читаются из YAML-файла Path; изменения через
+// админское API пишутся туда же. Недоставленные события дописываются
+// JSON-строками в DeadLetterPath.
+type WebhooksConfig struct {
+	Path           string `yaml:"path" json:"path" env:"WEBHOOKS_PATH"`
+	DeadLetterPath string `yaml:"dead_letter_path" json:"dead_letter_path" env:"WEBHOOKS_DEAD_LETTER_PATH"`
+}
+
+// Если задан Upstream (host:port или http(s) URL), принятые записи пачками
+// пересылаются на вышестоящий сервер с меткой SourceLabel=Source. BufferSize ограничивает число серий,
+// ждущих отправки, пока upstream недоступен.
+type FederationConfig struct {
+	Upstream      string        `yaml:"upstream" json:"upstream" env:"FEDERATION_UPSTREAM"`
+	Key           string        `yaml:"key" json:"key" env:"FEDERATION_KEY"`
+	Source        string        `yaml:"source" json:"source" env:"FEDERATION_SOURCE"`
+	SourceLabel   string        `yaml:"source_label" json:"source_label" env:"FEDERATION_SOURCE_LABEL"`
+	FlushInterval time.Duration `yaml:"flush_interval" json:"flush_interval" env:"FEDERATION_FLUSH_INTERVAL"`
+	BatchSize     int           `yaml:"batch_size" json:"batch_size" env:"FEDERATION_BATCH_SIZE"`
+	BufferSize    int           `yaml:"buffer_size" json:"buffer_size" env:"FEDERATION_BUFFER_SIZE"`
+}
+
+// Role — primary или secondary, пустая роль отключает репликацию.
+// Secondary читает журнал операций с Primary (host:port или http(s) URL). LogSize — сколько
+// последних операций держит primary; отставшая дальше реплика получает снимок.
+type ReplicationConfig struct {
+	Role    string `yaml:"role" json:"role" env:"REPLICATION_ROLE"`
+	Primary string `yaml:"primary" json:"primary" env:"REPLICATION_PRIMARY"`
+	LogSize int    `yaml:"log_size" json:"log_size" env:"REPLICATION_LOG_SIZE"`
+}
+
+// Нулевые значения означают отсутствие лимита.
+type LimitsConfig struct {
+	MaxSeries             int `yaml:"max_series" json:"max_series" env:"MAX_SERIES"`
+	MaxNewSeriesPerMinute int `yaml:"max_new_series_per_minute" json:"max_new_series_per_minute" env:"MAX_NEW_SERIES_PER_MINUTE"`
+}
+
 type BakConfig struct {
 	Path          string `yaml:"path" json:"path" env:"FILE_STORAGE_PATH"`
 	StoreInterval int    `yaml:"store_interval" json:"store_interval" env:"STORE_INTERVAL"`
@@ -120,7 +216,43 @@ func parseConfigFromFlags() *Config {
 	pflag.IntVarP(&config.BakConfig.StoreInterval, "store-interval", "s", 300, "store interval")
 
 	pflag.StringVarP(&config.DBConfig.Address, "db-address", "d", "", "database address")
-	pflag.StringVarP(&config.DBConfig.DriverName, "db-driver", "D", "pgx", "database driver")
+	pflag.StringVarP(&config.DBConfig.DriverName, "db-driver", "D", "pgx", "database driver: pgx or sqlite")
+
+	pflag.DurationVar(&config.RetentionConfig.TTL, "metric-ttl", 0, "mark or delete series not updated for this long")
+	pflag.StringVar(&config.RetentionConfig.Mode, "metric-ttl-mode", "mark", "what to do with expired series: mark or delete")
+	pflag.DurationVar(&config.RetentionConfig.SweepInterval, "metric-sweep-interval", time.Minute, "expired series sweep interval")
+	pflag.DurationVar(&config.RetentionConfig.HistoryRetention, "metric-history-retention", time.Hour, "counter history kept for rate queries")
+
+	pflag.BoolVar(&config.CacheConfig.Enabled, "cache", false, "serve reads from memory and write to storage in batches")
+	pflag.DurationVar(&config.CacheConfig.FlushInterval, "cache-flush-interval", 5*time.Second, "cache flush interval")
+	pflag.IntVar(&config.CacheConfig.FlushSize, "cache-flush-size", 1000, "pending series that trigger a cache flush")
+
+	pflag.StringVar(&config.LogStorageConfig.Dir, "log-dir", "", "keep metrics in a segment log in this directory")
+	pflag.Int64Var(&config.LogStorageConfig.SegmentSize, "log-segment-size", 16<<20, "log segment size in bytes")
+	pflag.DurationVar(&config.LogStorageConfig.CompactInterval, "log-compact-interval", time.Minute, "log compaction interval")
+
+	pflag.StringVar(&config.IngestConfig.RulesPath, "ingest-rules", "", "ingest rules file")
+
+	pflag.StringVar(&config.RecordingConfig.RulesPath, "recording-rules", "", "recording rules file")
+	pflag.DurationVar(&config.RecordingConfig.Interval, "recording-interval", 30*time.Second, "recording rules evaluation interval")
+
+	pflag.StringVar(&config.WebhooksConfig.Path, "webhooks", "", "webhook subscriptions file")
+	pflag.StringVar(&config.WebhooksConfig.DeadLetterPath, "webhooks-dead-letter", "", "undelivered webhook events file")
+
+	pflag.StringVar(&config.FederationConfig.Upstream, "upstream", "", "forward accepted writes to this server")
+	pflag.StringVar(&config.FederationConfig.Key, "upstream-key", "", "key for signing forwarded batches")
+	pflag.StringVar(&config.FederationConfig.Source, "upstream-source", "", "source label value, hostname by default")
+	pflag.StringVar(&config.FederationConfig.SourceLabel, "upstream-source-label", "source", "source label name")
+	pflag.DurationVar(&config.FederationConfig.FlushInterval, "upstream-flush-interval", 10*time.Second, "forwarding interval")
+	pflag.IntVar(&config.FederationConfig.BatchSize, "upstream-batch-size", 500, "max metrics in a forwarded batch")
+	pflag.IntVar(&config.FederationConfig.BufferSize, "upstream-buffer-size", 10000, "max series waiting to be forwarded")
+
+	pflag.StringVar(&config.ReplicationConfig.Role, "replication-role", "", "replication role: primary or secondary")
+	pflag.StringVar(&config.ReplicationConfig.Primary, "replication-primary", "", "primary server address for a secondary")
+	pflag.IntVar(&config.ReplicationConfig.LogSize, "replication-log-size", 10000, "operations kept in the replication log")
+
+	pflag.IntVar(&config.LimitsConfig.MaxSeries, "max-series", 0, "max stored series")
+	pflag.IntVar(&config.LimitsConfig.MaxNewSeriesPerMinute, "max-new-series", 0, "max new series per source per minute")
 
 	pflag.Parse()
 
@@ -187,6 +319,190 @@ func checkEnvDatabaseConfig(config *DBConfig) {
 	if envConfig.Address != "" {
 		config.Address = envConfig.Address
 	}
+
+	if envConfig.DriverName != "" {
+		config.DriverName = envConfig.DriverName
+	}
+}
+
+func checkEnvCacheConfig(config *CacheConfig) {
+	var envConfig CacheConfig
+
+	if err := env.Parse(&envConfig); err != nil {
+		return
+	}
+
+	if envConfig.Enabled {
+		config.Enabled = envConfig.Enabled
+	}
+
+	if envConfig.FlushInterval != 0 {
+		config.FlushInterval = envConfig.FlushInterval
+	}
+
+	if envConfig.FlushSize != 0 {
+		config.FlushSize = envConfig.FlushSize
+	}
+}
+
+func checkEnvLogStorageConfig(config *LogStorageConfig) {
+	var envConfig LogStorageConfig
+
+	if err := env.Parse(&envConfig); err != nil {
+		return
+	}
+
+	if envConfig.Dir != "" {
+		config.Dir = envConfig.Dir
+	}
+
+	if envConfig.SegmentSize != 0 {
+		config.SegmentSize = envConfig.SegmentSize
+	}
+
+	if envConfig.CompactInterval != 0 {
+		config.CompactInterval = envConfig.CompactInterval
+	}
+}
+
+func checkEnvRetentionConfig(config *RetentionConfig) {
+	var envConfig RetentionConfig
+
+	if err := env.Parse(&envConfig); err != nil {
+		return
+	}
+
+	if envConfig.TTL != 0 {
+		config.TTL = envConfig.TTL
+	}
+
+	if envConfig.Mode != "" {
+		config.Mode = envConfig.Mode
+	}
+
+	if envConfig.SweepInterval != 0 {
+		config.SweepInterval = envConfig.SweepInterval
+	}
+
+	if envConfig.HistoryRetention != 0 {
+		config.HistoryRetention = envConfig.HistoryRetention
+	}
+}
+
+func checkEnvIngestConfig(config *IngestConfig) {
+	var envConfig IngestConfig
+
+	if err := env.Parse(&envConfig); err != nil {
+		return
+	}
+
+	if envConfig.RulesPath != "" {
+		config.RulesPath = envConfig.RulesPath
+	}
+}
+
+func checkEnvRecordingConfig(config *RecordingConfig) {
+	var envConfig RecordingConfig
+
+	if err := env.Parse(&envConfig); err != nil {
+		return
+	}
+
+	if envConfig.RulesPath != "" {
+		config.RulesPath = envConfig.RulesPath
+	}
+
+	if envConfig.Interval != 0 {
+		config.Interval = envConfig.Interval
+	}
+}
+
+func checkEnvWebhooksConfig(config *WebhooksConfig) {
+	var envConfig WebhooksConfig
+
+	if err := env.Parse(&envConfig); err != nil {
+		return
+	}
+
+	if envConfig.Path != "" {
+		config.Path = envConfig.Path
+	}
+
+	if envConfig.DeadLetterPath != "" {
+		config.DeadLetterPath = envConfig.DeadLetterPath
+	}
+}
+
+func checkEnvFederationConfig(config *FederationConfig) {
+	var envConfig FederationConfig
+
+	if err := env.Parse(&envConfig); err != nil {
+		return
+	}
+
+	if envConfig.Upstream != "" {
+		config.Upstream = envConfig.Upstream
+	}
+
+	if envConfig.Key != "" {
+		config.Key = envConfig.Key
+	}
+
+	if envConfig.Source != "" {
+		config.Source = envConfig.Source
+	}
+
+	if envConfig.SourceLabel != "" {
+		config.SourceLabel = envConfig.SourceLabel
+	}
+
+	if envConfig.FlushInterval != 0 {
+		config.FlushInterval = envConfig.FlushInterval
+	}
+
+	if envConfig.BatchSize != 0 {
+		config.BatchSize = envConfig.BatchSize
+	}
+
+	if envConfig.BufferSize != 0 {
+		config.BufferSize = envConfig.BufferSize
+	}
+}
+
+func checkEnvReplicationConfig(config *ReplicationConfig) {
+	var envConfig ReplicationConfig
+
+	if err := env.Parse(&envConfig); err != nil {
+		return
+	}
+
+	if envConfig.Role != "" {
+		config.Role = envConfig.Role
+	}
+
+	if envConfig.Primary != "" {
+		config.Primary = envConfig.Primary
+	}
+
+	if envConfig.LogSize != 0 {
+		config.LogSize = envConfig.LogSize
+	}
+}
+
+func checkEnvLimitsConfig(config *LimitsConfig) {
+	var envConfig LimitsConfig
+
+	if err := env.Parse(&envConfig); err != nil {
+		return
+	}
+
+	if envConfig.MaxSeries != 0 {
+		config.MaxSeries = envConfig.MaxSeries
+	}
+
+	if envConfig.MaxNewSeriesPerMinute != 0 {
+		config.MaxNewSeriesPerMinute = envConfig.MaxNewSeriesPerMinute
+	}
 }
 
 func getEnvAndFlagConfig() *Config {
@@ -194,6 +510,15 @@ func getEnvAndFlagConfig() *Config {
 	checkEnvServerConfig(&config.ServerConfig)
 	checkEnvBakConfig(&config.BakConfig)
 	checkEnvDatabaseConfig(&config.DBConfig)
+	checkEnvRetentionConfig(&config.RetentionConfig)
+	checkEnvCacheConfig(&config.CacheConfig)
+	checkEnvLogStorageConfig(&config.LogStorageConfig)
+	checkEnvIngestConfig(&config.IngestConfig)
+	checkEnvLimitsConfig(&config.LimitsConfig)
+	checkEnvRecordingConfig(&config.RecordingConfig)
+	checkEnvWebhooksConfig(&config.WebhooksConfig)
+	checkEnvFederationConfig(&config.FederationConfig)
+	checkEnvReplicationConfig(&config.ReplicationConfig)
 
 	return config
 }
@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	config "github.com/BeInBloom/spanish-inquisition/internal/config/client-config"
@@ -18,6 +19,9 @@ import (
 var (
 	ErrInvalidMetricType = errors.New("invalid metric type")
 	ErrSendingEmptyBatch = errors.New("sending empty batch")
+	// ErrRejected — сервер ответил 4xx (кроме 429): повтор той же пачки
+	// получит тот же ответ.
+	ErrRejected = errors.New("batch rejected by server")
 )
 
 type httpSaver struct {
@@ -32,12 +36,21 @@ func New(config config.SaverConfig) *httpSaver {
 		client: &http.Client{
 			Timeout: 10 * time.Second,
 		},
-		//Fix it
-		urlToSend: "http://" + config.URL,
+		urlToSend: baseURL(config.URL),
 		key:       config.Key,
 	}
 }
 
+// baseURL оставляет схему, если адрес задан URL'ом, а к host:port
+// дописывает http://.
+func baseURL(addr string) string {
+	if strings.Contains(addr, "://") {
+		return strings.TrimSuffix(addr, "/")
+	}
+
+	return "http://" + addr
+}
+
 // "/update/%s/%s/%s"
 // Меня терзают смутные сомнения о том, что код, который имеет альтернативную отправку должен быть "забыт"
 // Возможно, стоит сделать возможность выбора или механизм выбора альтернативного отправления
@@ -55,6 +68,16 @@ func (s *httpSaver) Save(data ...models.Metrics) error {
 	return ErrSendingEmptyBatch
 }
 
+// SaveBatch всегда отправляет JSON-пачкой на /updates/, даже одну метрику:
+// в отличие от /update/ по параметрам так проходят ID с метками.
+func (s *httpSaver) SaveBatch(data []models.Metrics) error {
+	if len(data) == 0 {
+		return ErrSendingEmptyBatch
+	}
+
+	return s.sendBatch(data)
+}
+
 // Видимо, там какая-то другая логика. Я не очень понимаю, какие запросы нужно ограничивать
 // У меня 1 запрос раз в n-секунд пачкой
 func (s *httpSaver) sendBatch(data []models.Metrics) error {
@@ -65,7 +88,7 @@ func (s *httpSaver) sendBatch(data []models.Metrics) error {
 
 	jsonMetric, err := json.Marshal(data)
 	if err != nil {
-		fmt.Printf("Error marshaling data: %v\n", err)
+		return fmt.Errorf("%s: %v", fn, err)
 	}
 
 	reqAddr := s.urlToSend + batchSuffix
@@ -86,18 +109,16 @@ func (s *httpSaver) sendBatch(data []models.Metrics) error {
 	if err != nil {
 		return fmt.Errorf("%s: %v", fn, err)
 	}
+	defer res.Body.Close()
 
-	if res.StatusCode != http.StatusOK {
+	switch {
+	case res.StatusCode == http.StatusOK:
+		return nil
+	case res.StatusCode >= 400 && res.StatusCode < 500 && res.StatusCode != http.StatusTooManyRequests:
+		return fmt.Errorf("%s: %w: status code %v", fn, ErrRejected, res.StatusCode)
+	default:
 		return fmt.Errorf("%s: unexpected status code: %v", fn, res.StatusCode)
 	}
-
-	defer func() {
-		if res != nil && res.Body != nil {
-			res.Body.Close()
-		}
-	}()
-
-	return nil
 }
 
 func (s *httpSaver) createHash(data []byte) string {
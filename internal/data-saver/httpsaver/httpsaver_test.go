@@ -7,6 +7,22 @@ import (
 func TestHttpSaver_Save_Success(t *testing.T) {
 }
 
+func TestBaseURL(t *testing.T) {
+	tests := map[string]string{
+		"localhost:8080":          "http://localhost:8080",
+		"http://localhost:8080":   "http://localhost:8080",
+		"https://metrics.local":   "https://metrics.local",
+		"https://metrics.local/":  "https://metrics.local",
+		"https://metrics.local/a": "https://metrics.local/a",
+	}
+
+	for addr, want := range tests {
+		if got := baseURL(addr); got != want {
+			t.Errorf("baseURL(%q): got %q, want %q", addr, got, want)
+		}
+	}
+}
+
 func TestHttpSaver_Save_HttpError(t *testing.T) {
 	// mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 	// 	http.Error(w, "internal error", http.StatusInternalServerError)
@@ -0,0 +1,354 @@
+package federation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	clientconfig "github.com/BeInBloom/spanish-inquisition/internal/config/client-config"
+	config "github.com/BeInBloom/spanish-inquisition/internal/config/server-config"
+	"github.com/BeInBloom/spanish-inquisition/internal/data-saver/httpsaver"
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+	"github.com/BeInBloom/spanish-inquisition/internal/pubsub"
+	"github.com/BeInBloom/spanish-inquisition/internal/wrappers"
+)
+
+const (
+	eventsBuffer = 4096
+	attempts     = 3
+	retryStep    = 2 * time.Second
+
+	defaultSourceLabel   = "source"
+	defaultFlushInterval = 10 * time.Second
+	defaultBatchSize     = 500
+	defaultBufferSize    = 10000
+)
+
+var (
+	ErrNoUpstream  = errors.New("upstream is not set")
+	ErrBadUpstream = errors.New("upstream must be host:port or an http(s) URL")
+)
+
+type subscriber interface {
+	Subscribe(f pubsub.Filter, buffer int) *pubsub.Subscription
+	Unsubscribe(s *pubsub.Subscription)
+}
+
+type batchSaver interface {
+	SaveBatch(data []models.Metrics) error
+}
+
+// forwarder пересылает принятые записи на вышестоящий сервер тем же
+// протоколом /updates/, что и агент. Записи копятся по сериям: для counter'а
+// приросты складываются, для gauge остаётся последнее значение. Пачка, которую
+// не удалось отправить, возвращается в буфер, так что приросты counter'ов
+// не теряются и не задваиваются. Пачка, которую upstream отверг ответом 4xx,
+// не возвращается: её повтор отвергли бы снова.
+type forwarder struct {
+	saver       batchSaver
+	label       string
+	source      string
+	batchSize   int
+	bufferSize  int
+	interval    time.Duration
+	flushSignal chan struct{}
+
+	mu      sync.Mutex
+	pending map[string]models.Metrics
+	dropped int
+
+	// sendMu не даёт периодическому сбросу и Close отправлять одновременно.
+	sendMu sync.Mutex
+}
+
+func New(ctx context.Context, cfg config.FederationConfig, hub subscriber) (*forwarder, error) {
+	const fn = "federation.New"
+
+	if cfg.Upstream == "" {
+		return nil, fmt.Errorf("%s: %w", fn, ErrNoUpstream)
+	}
+
+	upstream, err := upstreamURL(cfg.Upstream)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	if cfg.Source == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fn, err)
+		}
+
+		cfg.Source = host
+	}
+
+	saver := httpsaver.New(clientconfig.SaverConfig{
+		URL: upstream,
+		Key: cfg.Key,
+	})
+
+	f := newForwarder(cfg, saver)
+
+	sub := hub.Subscribe(pubsub.Filter{}, eventsBuffer)
+
+	go f.collect(ctx, hub, sub)
+	go f.run(ctx)
+
+	return f, nil
+}
+
+// upstreamURL разбирает адрес upstream: host:port считается http,
+// у URL'а схема сохраняется, но допускаются только http и https.
+func upstreamURL(raw string) (string, error) {
+	addr := raw
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+
+	u, err := url.Parse(addr)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("%w: %q", ErrBadUpstream, raw)
+	}
+
+	return u.String(), nil
+}
+
+func newForwarder(cfg config.FederationConfig, saver batchSaver) *forwarder {
+	f := &forwarder{
+		saver:       saver,
+		label:       cfg.SourceLabel,
+		source:      cfg.Source,
+		batchSize:   cfg.BatchSize,
+		bufferSize:  cfg.BufferSize,
+		interval:    cfg.FlushInterval,
+		flushSignal: make(chan struct{}, 1),
+		pending:     make(map[string]models.Metrics),
+	}
+
+	if f.label == "" {
+		f.label = defaultSourceLabel
+	}
+
+	if f.batchSize <= 0 {
+		f.batchSize = defaultBatchSize
+	}
+
+	if f.bufferSize <= 0 {
+		f.bufferSize = defaultBufferSize
+	}
+
+	if f.interval <= 0 {
+		f.interval = defaultFlushInterval
+	}
+
+	return f
+}
+
+// Close отправляет всё, что осталось в буфере.
+func (f *forwarder) Close() error {
+	const fn = "federation.Close"
+
+	if err := f.flush(); err != nil {
+		return fmt.Errorf("%s: %v", fn, err)
+	}
+
+	return nil
+}
+
+func (f *forwarder) collect(ctx context.Context, hub subscriber, sub *pubsub.Subscription) {
+	defer hub.Unsubscribe(sub)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+
+			if dropped := sub.TakeDropped(); dropped > 0 {
+				fmt.Printf("federation: %d events dropped, forwarder is too slow\n", dropped)
+			}
+
+			f.add(e.Metric)
+		}
+	}
+}
+
+func (f *forwarder) run(ctx context.Context) {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-f.flushSignal:
+		}
+
+		if err := f.flush(); err != nil {
+			fmt.Printf("federation: %v\n", err)
+		}
+	}
+}
+
+// add кладёт запись в буфер. Новая серия при полном буфере отбрасывается.
+func (f *forwarder) add(m models.Metrics) {
+	if m.MType != models.Counter && m.MType != models.Gauge {
+		return
+	}
+
+	m = models.Metrics{ID: f.withSource(m.ID), MType: m.MType, Delta: m.Delta, Value: m.Value}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.merge(m, false) {
+		f.dropped++
+		return
+	}
+
+	if len(f.pending) >= f.batchSize {
+		select {
+		case f.flushSignal <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// merge вызывается под f.mu. older означает, что m — возвращённая после
+// неудачной отправки запись, и для gauge более свежее значение в буфере
+// важнее неё.
+func (f *forwarder) merge(m models.Metrics, older bool) bool {
+	key := m.MType + "/" + m.ID
+
+	cur, ok := f.pending[key]
+	if !ok {
+		if len(f.pending) >= f.bufferSize {
+			return false
+		}
+
+		f.pending[key] = m
+
+		return true
+	}
+
+	switch {
+	case m.MType == models.Counter:
+		var sum int64
+		if cur.Delta != nil {
+			sum += *cur.Delta
+		}
+		if m.Delta != nil {
+			sum += *m.Delta
+		}
+		cur.Delta = &sum
+	case !older:
+		cur.Value = m.Value
+	}
+
+	f.pending[key] = cur
+
+	return true
+}
+
+// take забирает из буфера не больше batchSize записей.
+func (f *forwarder) take() []models.Metrics {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	batch := make([]models.Metrics, 0, min(len(f.pending), f.batchSize))
+	for key, m := range f.pending {
+		if len(batch) == f.batchSize {
+			break
+		}
+
+		batch = append(batch, m)
+		delete(f.pending, key)
+	}
+
+	return batch
+}
+
+func (f *forwarder) requeue(batch []models.Metrics) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, m := range batch {
+		if !f.merge(m, true) {
+			f.dropped++
+		}
+	}
+}
+
+func (f *forwarder) flush() error {
+	f.sendMu.Lock()
+	defer f.sendMu.Unlock()
+
+	f.reportDropped()
+
+	for {
+		batch := f.take()
+		if len(batch) == 0 {
+			return nil
+		}
+
+		// Отвергнутую пачку upstream мог применить частично: /updates/
+		// пишет записи по одной. Повтор задвоил бы приросты counter'ов,
+		// поэтому такие серии выбрасываются.
+		var rejected error
+
+		send := func() error {
+			err := f.saver.SaveBatch(batch)
+			if errors.Is(err, httpsaver.ErrRejected) {
+				rejected = err
+				return nil
+			}
+
+			return err
+		}
+
+		if err := wrappers.RetryWrapper(send, attempts, retryStep); err != nil {
+			f.requeue(batch)
+			return err
+		}
+
+		if rejected != nil {
+			fmt.Printf("federation: %d series dropped: %v\n", len(batch), rejected)
+		}
+	}
+}
+
+func (f *forwarder) reportDropped() {
+	f.mu.Lock()
+	dropped := f.dropped
+	f.dropped = 0
+	f.mu.Unlock()
+
+	if dropped > 0 {
+		fmt.Printf("federation: %d writes dropped, buffer is full\n", dropped)
+	}
+}
+
+// withSource добавляет к ID метку источника. Уже проставленную метку
+// не трогаем, чтобы при цепочке серверов сохранялся исходный источник.
+func (f *forwarder) withSource(id string) string {
+	name, labels := models.ParseSeriesID(id)
+	if _, ok := labels[f.label]; ok {
+		return id
+	}
+
+	if labels == nil {
+		labels = make(map[string]string, 1)
+	}
+	labels[f.label] = f.source
+
+	return models.SeriesID(name, labels)
+}
@@ -0,0 +1,166 @@
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	clientconfig "github.com/BeInBloom/spanish-inquisition/internal/config/client-config"
+	config "github.com/BeInBloom/spanish-inquisition/internal/config/server-config"
+	"github.com/BeInBloom/spanish-inquisition/internal/data-saver/httpsaver"
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+	"github.com/BeInBloom/spanish-inquisition/internal/pubsub"
+)
+
+func TestForwarder_Forward(t *testing.T) {
+	batches := make(chan []models.Metrics, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch []models.Metrics
+		if r.URL.Path != "/updates/" || json.NewDecoder(r.Body).Decode(&batch) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		batches <- batch
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hub := pubsub.New()
+
+	f, err := New(ctx, config.FederationConfig{Upstream: srv.URL, Source: "edge-1", FlushInterval: time.Hour}, hub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for hub.Subscribers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	two, three := int64(2), int64(3)
+	one, five := 1.0, 5.0
+
+	hub.Publish(pubsub.Event{Metric: models.Metrics{ID: "PollCount", MType: models.Counter, Delta: &two}})
+	hub.Publish(pubsub.Event{Metric: models.Metrics{ID: "PollCount", MType: models.Counter, Delta: &three}})
+	hub.Publish(pubsub.Event{Metric: models.Metrics{ID: `Alloc{source="edge-0"}`, MType: models.Gauge, Value: &one}})
+	hub.Publish(pubsub.Event{Metric: models.Metrics{ID: `Alloc{source="edge-0"}`, MType: models.Gauge, Value: &five}})
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		f.mu.Lock()
+		n := len(f.pending)
+		pc := f.pending[models.Counter+`/PollCount{source="edge-1"}`]
+		f.mu.Unlock()
+
+		if n == 2 && pc.Delta != nil && *pc.Delta == 5 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("events were not buffered")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]models.Metrics)
+	for _, m := range <-batches {
+		got[m.ID] = m
+	}
+
+	if m := got[`PollCount{source="edge-1"}`]; m.Delta == nil || *m.Delta != 5 {
+		t.Errorf("counter: got %+v, want delta 5", m)
+	}
+
+	if m := got[`Alloc{source="edge-0"}`]; m.Value == nil || *m.Value != 5 {
+		t.Errorf("gauge: got %+v, want value 5 with original source", m)
+	}
+}
+
+func TestUpstreamURL(t *testing.T) {
+	tests := []struct {
+		upstream string
+		want     string
+		wantErr  error
+	}{
+		{upstream: "central:8080", want: "http://central:8080"},
+		{upstream: "http://central:8080", want: "http://central:8080"},
+		{upstream: "https://central.example.com", want: "https://central.example.com"},
+		{upstream: "ftp://central", wantErr: ErrBadUpstream},
+		{upstream: "https://", wantErr: ErrBadUpstream},
+	}
+
+	for _, tt := range tests {
+		got, err := upstreamURL(tt.upstream)
+		if !errors.Is(err, tt.wantErr) || got != tt.want {
+			t.Errorf("upstreamURL(%q): got %q, %v, want %q, %v", tt.upstream, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestForwarder_DropsRejectedBatch(t *testing.T) {
+	var requests atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.Error(w, "rejected by ingest rule", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	f := newForwarder(config.FederationConfig{Source: "edge-1"}, httpsaver.New(clientconfig.SaverConfig{URL: srv.URL}))
+
+	var delta int64 = 1
+	f.add(models.Metrics{ID: "PollCount", MType: models.Counter, Delta: &delta})
+
+	if err := f.flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := requests.Load(); n != 1 || len(f.pending) != 0 {
+		t.Fatalf("got %d requests and %d pending series, want the batch sent once and dropped", n, len(f.pending))
+	}
+}
+
+func TestForwarder_Requeue(t *testing.T) {
+	f := newForwarder(config.FederationConfig{Source: "edge-1", BufferSize: 2}, nil)
+
+	one, two := int64(1), int64(2)
+	value, newer := 1.0, 7.0
+
+	f.add(models.Metrics{ID: "PollCount", MType: models.Counter, Delta: &one})
+	f.add(models.Metrics{ID: "Alloc", MType: models.Gauge, Value: &value})
+
+	batch := f.take()
+
+	f.add(models.Metrics{ID: "PollCount", MType: models.Counter, Delta: &two})
+	f.add(models.Metrics{ID: "Alloc", MType: models.Gauge, Value: &newer})
+	f.requeue(batch)
+
+	pc := f.pending[models.Counter+`/PollCount{source="edge-1"}`]
+	if pc.Delta == nil || *pc.Delta != 3 {
+		t.Errorf("counter: got %+v, want delta 3", pc)
+	}
+
+	alloc := f.pending[models.Gauge+`/Alloc{source="edge-1"}`]
+	if alloc.Value == nil || *alloc.Value != 7 {
+		t.Errorf("gauge: got %+v, want newer value 7", alloc)
+	}
+
+	f.add(models.Metrics{ID: "HeapAlloc", MType: models.Gauge, Value: &value})
+	if f.dropped != 1 {
+		t.Errorf("dropped: got %d, want 1", f.dropped)
+	}
+}
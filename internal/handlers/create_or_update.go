@@ -2,11 +2,10 @@ package handlers
 
 import (
 	"encoding/json"
-	"errors"
 	"net/http"
 
+	"github.com/BeInBloom/spanish-inquisition/internal/apperrors"
 	"github.com/BeInBloom/spanish-inquisition/internal/models"
-	mr "github.com/BeInBloom/spanish-inquisition/internal/repository/memrepository"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -23,17 +22,12 @@ func CreateOrUpdate(storage saver) func(w http.ResponseWriter, r *http.Request)
 			chi.URLParam(r, "value"),
 		)
 		if err != nil {
-			http.Error(w, "bad request", http.StatusBadRequest)
+			apperrors.Write(w, err)
 			return
 		}
 
 		if err := storage.CreateOrUpdate(m); err != nil {
-			if errors.Is(err, mr.ErrRepoNotFound) {
-				http.Error(w, "not found", http.StatusNotFound)
-				return
-			}
-
-			http.Error(w, "bad request", http.StatusBadRequest)
+			apperrors.Write(w, err)
 			return
 		}
 
@@ -52,17 +46,12 @@ func CreateOrUpdateByJSON(storage saver) func(w http.ResponseWriter, r *http.Req
 
 		decoder := json.NewDecoder(r.Body)
 		if err := decoder.Decode(&data); err != nil {
-			http.Error(w, "bad request", http.StatusBadRequest)
+			apperrors.Write(w, apperrors.Wrap(apperrors.ErrValidation, err))
 			return
 		}
 
 		if err := storage.CreateOrUpdate(data); err != nil {
-			if errors.Is(err, mr.ErrRepoNotFound) {
-				http.Error(w, "not found", http.StatusNotFound)
-				return
-			}
-
-			http.Error(w, "bad request", http.StatusBadRequest)
+			apperrors.Write(w, err)
 			return
 		}
 
@@ -80,18 +69,13 @@ func CreateOrUpdateByJSONBatch(storage saver) func(w http.ResponseWriter, r *htt
 
 		decoder := json.NewDecoder(r.Body)
 		if err := decoder.Decode(&data); err != nil {
-			http.Error(w, "bad request", http.StatusBadRequest)
+			apperrors.Write(w, apperrors.Wrap(apperrors.ErrValidation, err))
 			return
 		}
 
 		for _, d := range data {
 			if err := storage.CreateOrUpdate(d); err != nil {
-				if errors.Is(err, mr.ErrRepoNotFound) {
-					http.Error(w, "not found", http.StatusNotFound)
-					return
-				}
-
-				http.Error(w, "bad request", http.StatusBadRequest)
+				apperrors.Write(w, err)
 				return
 			}
 		}
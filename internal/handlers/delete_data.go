@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/apperrors"
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+type deleter interface {
+	Delete(models.Metrics) error
+}
+
+type resetter interface {
+	Reset(models.Metrics) error
+}
+
+func DeleteData(repo deleter) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m := models.Metrics{
+			MType: chi.URLParam(r, "type"),
+			ID:    chi.URLParam(r, "name"),
+		}
+
+		if err := repo.Delete(m); err != nil {
+			apperrors.Write(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+
+		w.Write([]byte("ok"))
+	}
+}
+
+// DeleteDataByJSONBatch удаляет все перечисленные метрики. Отсутствующие
+// не считаются ошибкой, в ответе возвращается число реально удалённых.
+func DeleteDataByJSONBatch(repo deleter) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var data []models.Metrics
+
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&data); err != nil {
+			apperrors.Write(w, apperrors.Wrap(apperrors.ErrValidation, err))
+			return
+		}
+
+		var deleted int
+
+		for _, d := range data {
+			if err := repo.Delete(d); err != nil {
+				if errors.Is(err, apperrors.ErrNotFound) {
+					continue
+				}
+
+				apperrors.Write(w, err)
+				return
+			}
+
+			deleted++
+		}
+
+		w.WriteHeader(http.StatusOK)
+
+		w.Write([]byte(fmt.Sprintf("{\"status\": \"ok\", \"deleted\": %d}", deleted)))
+	}
+}
+
+func ResetCounter(repo resetter) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m := models.Metrics{
+			MType: models.Counter,
+			ID:    chi.URLParam(r, "name"),
+		}
+
+		if err := repo.Reset(m); err != nil {
+			apperrors.Write(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+
+		w.Write([]byte("ok"))
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/BeInBloom/spanish-inquisition/internal/apperrors"
 	"github.com/BeInBloom/spanish-inquisition/internal/models"
 	"github.com/go-chi/chi/v5"
 )
@@ -33,10 +34,14 @@ func GetData(repo fetcher) func(w http.ResponseWriter, r *http.Request) {
 		fmt.Printf("GetData value: %+v\n", value)
 
 		if err != nil {
-			http.Error(w, "not found", http.StatusNotFound)
+			apperrors.Write(w, err)
 			return
 		}
 
+		if value.UpdatedAt != nil {
+			w.Header().Set("Last-Modified", value.UpdatedAt.UTC().Format(http.TimeFormat))
+		}
+
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte(parsMetricsForValue(value)))
 	}
@@ -50,19 +55,19 @@ func GetDataByJSON(repo fetcher, k string) func(w http.ResponseWriter, r *http.R
 
 		decoder := json.NewDecoder(r.Body)
 		if err := decoder.Decode(&data); err != nil {
-			http.Error(w, "bad request", http.StatusBadRequest)
+			apperrors.Write(w, apperrors.Wrap(apperrors.ErrValidation, err))
 			return
 		}
 
 		value, err := repo.Get(data)
 		if err != nil {
-			http.Error(w, "not found", http.StatusNotFound)
+			apperrors.Write(w, err)
 			return
 		}
 
 		jsonString, err := json.Marshal(value)
 		if err != nil {
-			http.Error(w, "internal error", http.StatusInternalServerError)
+			apperrors.Write(w, err)
 			return
 		}
 
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/apperrors"
+	"github.com/BeInBloom/spanish-inquisition/internal/limiter"
+)
+
+type usager interface {
+	Usage() limiter.Usage
+}
+
+func GetLimits(l usager) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		jsonString, err := json.Marshal(l.Usage())
+		if err != nil {
+			apperrors.Write(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonString)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"text/template"
 
+	"github.com/BeInBloom/spanish-inquisition/internal/apperrors"
 	"github.com/BeInBloom/spanish-inquisition/internal/models"
 )
 
@@ -21,18 +22,18 @@ func GetRoot(repo dumper) func(w http.ResponseWriter, r *http.Request) {
 
 		metrics, err := repo.Dump()
 		if err != nil {
-			http.Error(w, "internal error", http.StatusInternalServerError)
+			apperrors.Write(w, err)
 			return
 		}
 
 		tmpl, err := template.ParseFiles(templatePath)
 		if err != nil {
-			http.Error(w, "Error loading template", http.StatusInternalServerError)
+			apperrors.Write(w, err)
 			return
 		}
 
 		if err := tmpl.Execute(w, metrics); err != nil {
-			http.Error(w, "Error rendering template", http.StatusInternalServerError)
+			apperrors.Write(w, err)
 			return
 		}
 
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/apperrors"
+	"github.com/BeInBloom/spanish-inquisition/internal/query"
+)
+
+type lister interface {
+	List(query.Filter) (query.Page, error)
+	historian
+}
+
+// ListMetrics с параметром rate=1m,5m добавляет к странице производные
+// gauge'и со скоростью counter'ов. В limit они не входят.
+func ListMetrics(repo lister) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		filter, err := query.ParseFilter(r.URL.Query())
+		if err != nil {
+			apperrors.Write(w, err)
+			return
+		}
+
+		page, err := repo.List(filter)
+		if err != nil {
+			apperrors.Write(w, err)
+			return
+		}
+
+		if rates := r.URL.Query().Get("rate"); rates != "" {
+			windows := strings.Split(rates, ",")
+
+			for _, window := range windows {
+				if d, err := time.ParseDuration(window); err != nil || d <= 0 {
+					apperrors.Write(w, badWindow(window))
+					return
+				}
+			}
+
+			derived, err := rateGauges(repo, page.Metrics, windows, time.Now())
+			if err != nil {
+				apperrors.Write(w, err)
+				return
+			}
+
+			page.Metrics = append(page.Metrics, derived...)
+		}
+
+		jsonString, err := json.Marshal(page)
+		if err != nil {
+			apperrors.Write(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonString)
+	}
+}
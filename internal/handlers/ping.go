@@ -1,17 +1,22 @@
 package handlers
 
-import "net/http"
+import (
+	"net/http"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/apperrors"
+)
 
 type checker interface {
 	Check() error
 }
 
+// Ping отвечает 503, если хранилище недоступно.
 func Ping(checker checker) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/plain")
 
 		if err := checker.Check(); err != nil {
-			http.Error(w, "internal error", http.StatusInternalServerError)
+			apperrors.Write(w, err)
 			return
 		}
 
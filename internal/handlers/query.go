@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/apperrors"
+	"github.com/BeInBloom/spanish-inquisition/internal/query"
+)
+
+type queryResult struct {
+	Expr   string         `json:"expr"`
+	Result []query.Sample `json:"result"`
+}
+
+func Query(repo query.Source) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		expr := r.URL.Query().Get("expr")
+
+		e, err := query.Parse(expr)
+		if err != nil {
+			apperrors.Write(w, err)
+			return
+		}
+
+		samples, err := query.Eval(e, repo)
+		if err != nil {
+			apperrors.Write(w, err)
+			return
+		}
+
+		if samples == nil {
+			samples = []query.Sample{}
+		}
+
+		jsonString, err := json.Marshal(queryResult{Expr: expr, Result: samples})
+		if err != nil {
+			apperrors.Write(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonString)
+	}
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/apperrors"
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+	"github.com/BeInBloom/spanish-inquisition/internal/query"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultRateWindow = "5m"
+)
+
+var (
+	errBadWindow = apperrors.New(apperrors.ErrValidation, "bad_window", "bad window")
+	errNoRate    = apperrors.New(apperrors.ErrNotFound, "no_rate", "not enough points to compute rate")
+)
+
+type historian interface {
+	History(item models.Metrics, since time.Time) ([]models.Point, error)
+}
+
+type rateResult struct {
+	ID     string `json:"id"`
+	Window string `json:"window"`
+	query.Rate
+}
+
+func GetRate(repo historian) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		window := r.URL.Query().Get("window")
+		if window == "" {
+			window = defaultRateWindow
+		}
+
+		d, err := time.ParseDuration(window)
+		if err != nil || d <= 0 {
+			apperrors.Write(w, badWindow(window))
+			return
+		}
+
+		m := models.Metrics{ID: chi.URLParam(r, "name"), MType: models.Counter}
+
+		rate, ok, err := counterRate(repo, m, d, time.Now())
+		if err != nil {
+			apperrors.Write(w, err)
+			return
+		}
+
+		if !ok {
+			apperrors.Write(w, fmt.Errorf("%w: %q", errNoRate, m.ID))
+			return
+		}
+
+		jsonString, err := json.Marshal(rateResult{ID: m.ID, Window: window, Rate: rate})
+		if err != nil {
+			apperrors.Write(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonString)
+	}
+}
+
+func badWindow(window string) error {
+	return fmt.Errorf("%w: %q", errBadWindow, window)
+}
+
+func counterRate(repo historian, m models.Metrics, window time.Duration, now time.Time) (query.Rate, bool, error) {
+	points, err := repo.History(m, now.Add(-window))
+	if err != nil {
+		return query.Rate{}, false, err
+	}
+
+	rate, ok := query.ComputeRate(points, window, now)
+
+	return rate, ok, nil
+}
+
+// rateGauges строит производные gauge'и name:rate<window> для counter'ов
+// из выдачи. Окна берутся как есть из запроса, например "1m,5m".
+func rateGauges(repo historian, metrics []models.Metrics, windows []string, now time.Time) ([]models.Metrics, error) {
+	var res []models.Metrics
+
+	for _, m := range metrics {
+		if m.MType != models.Counter {
+			continue
+		}
+
+		name, labels := models.ParseSeriesID(m.ID)
+
+		for _, window := range windows {
+			d, err := time.ParseDuration(window)
+			if err != nil {
+				return nil, err
+			}
+
+			rate, ok, err := counterRate(repo, m, d, now)
+			if err != nil {
+				if errors.Is(err, apperrors.ErrNotFound) {
+					continue
+				}
+
+				return nil, err
+			}
+
+			if !ok {
+				continue
+			}
+
+			value := rate.Rate
+			res = append(res, models.Metrics{
+				ID:        models.SeriesID(name+":rate"+window, labels),
+				MType:     models.Gauge,
+				Value:     &value,
+				UpdatedAt: m.UpdatedAt,
+			})
+		}
+	}
+
+	return res, nil
+}
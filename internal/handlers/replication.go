@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/apperrors"
+	"github.com/BeInBloom/spanish-inquisition/internal/replication"
+)
+
+type replicator interface {
+	Status() replication.Status
+	Promote() error
+	Follow(ctx context.Context, done <-chan struct{}, logID string, after uint64, send func(replication.Op) error) error
+}
+
+// ReplicationLog отдаёт журнал операций primary построчным JSON.
+// Соединение держится, пока реплика читает; log и after из query говорят,
+// с какого места продолжить.
+func ReplicationLog(repl replicator, done <-chan struct{}) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		after, err := strconv.ParseUint(r.URL.Query().Get("after"), 10, 64)
+		if err != nil {
+			after = 0
+		}
+
+		rc := http.NewResponseController(w)
+
+		if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+			apperrors.Write(w, errStreamingUnsupported)
+			return
+		}
+
+		encoder := json.NewEncoder(w)
+		started := false
+
+		send := func(op replication.Op) error {
+			if !started {
+				w.Header().Set("Content-Type", "application/x-ndjson")
+				w.Header().Set("Cache-Control", "no-cache")
+				w.WriteHeader(http.StatusOK)
+				started = true
+			}
+
+			if err := encoder.Encode(op); err != nil {
+				return err
+			}
+
+			return rc.Flush()
+		}
+
+		err = repl.Follow(r.Context(), done, r.URL.Query().Get("log"), after, send)
+		if err == nil || started {
+			return
+		}
+
+		apperrors.Write(w, err)
+	}
+}
+
+func ReplicationStatus(repl replicator) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		jsonString, err := json.Marshal(repl.Status())
+		if err != nil {
+			apperrors.Write(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonString)
+	}
+}
+
+func PromoteReplica(repl replicator) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := repl.Promote(); err != nil {
+			apperrors.Write(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+
+		w.Write([]byte("{\"status\": \"ok\"}"))
+	}
+}
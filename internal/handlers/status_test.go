@@ -0,0 +1,91 @@
+package handlers_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/apperrors"
+	config "github.com/BeInBloom/spanish-inquisition/internal/config/server-config"
+	"github.com/BeInBloom/spanish-inquisition/internal/handlers"
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+	sqlrepository "github.com/BeInBloom/spanish-inquisition/internal/repository/sql_repository"
+	"github.com/BeInBloom/spanish-inquisition/internal/wrappers"
+	"github.com/go-chi/chi/v5"
+)
+
+type repository interface {
+	Get(models.Metrics) (models.Metrics, error)
+	CreateOrUpdate(models.Metrics) error
+}
+
+// failingRepo отвечает одной и той же ошибкой на любой запрос.
+type failingRepo struct {
+	err error
+}
+
+func (f failingRepo) Get(models.Metrics) (models.Metrics, error) { return models.Metrics{}, f.err }
+
+func (f failingRepo) CreateOrUpdate(models.Metrics) error { return f.err }
+
+func router(repo repository) http.Handler {
+	r := chi.NewRouter()
+	r.Get("/value/{type}/{name}", handlers.GetData(repo))
+	r.Post("/update/{type}/{name}/{value}", handlers.CreateOrUpdate(repo))
+	r.Post("/update/", handlers.CreateOrUpdateByJSON(repo))
+
+	return r
+}
+
+func TestErrorStatus(t *testing.T) {
+	sqlite, err := sqlrepository.New(config.DBConfig{DriverName: "sqlite", Address: filepath.Join(t.TempDir(), "metrics.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlite.Close()
+
+	if err := sqlite.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Так выглядит ошибка хранилища, до которого не достучались за все попытки.
+	down := failingRepo{err: apperrors.Wrap(apperrors.ErrUnavailable, errors.Join(driver.ErrBadConn, wrappers.ErrAttemptsExceeded))}
+	broken := failingRepo{err: errors.New("sql: converting NULL to float64 is unsupported")}
+
+	longID := strings.Repeat("x", models.MaxIDLength+1)
+
+	tests := []struct {
+		name   string
+		repo   repository
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"stored", sqlite, http.MethodPost, "/update/gauge/load/1.5", "", http.StatusOK},
+		{"found", sqlite, http.MethodGet, "/value/gauge/load", "", http.StatusOK},
+		{"not found", sqlite, http.MethodGet, "/value/gauge/missing", "", http.StatusNotFound},
+		{"bad value", sqlite, http.MethodPost, "/update/counter/requests/1.5", "", http.StatusBadRequest},
+		{"id too long", sqlite, http.MethodPost, "/update/gauge/" + longID + "/1", "", http.StatusBadRequest},
+		{"json id too long", sqlite, http.MethodPost, "/update/", `{"id":"` + longID + `","type":"gauge","value":1}`, http.StatusBadRequest},
+		{"storage down on read", down, http.MethodGet, "/value/gauge/load", "", http.StatusServiceUnavailable},
+		{"storage down on write", down, http.MethodPost, "/update/gauge/load/1", "", http.StatusServiceUnavailable},
+		{"storage bug", broken, http.MethodGet, "/value/gauge/load", "", http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router(tt.repo).ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+			if w.Code != tt.want {
+				t.Errorf("got %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/apperrors"
+	"github.com/BeInBloom/spanish-inquisition/internal/pubsub"
+)
+
+const (
+	streamBuffer    = 256
+	streamHeartbeat = 15 * time.Second
+)
+
+type subscriber interface {
+	Subscribe(f pubsub.Filter, buffer int) *pubsub.Subscription
+	Unsubscribe(s *pubsub.Subscription)
+}
+
+var (
+	errStreamingUnsupported = apperrors.New(nil, "streaming_unsupported", "streaming is not supported")
+)
+
+// Stream отдаёт принятые записи как Server-Sent Events. Фильтры — type и
+// prefix из query. Если клиент не успевает читать, события для него
+// выкидываются, а клиенту приходит событие dropped с их числом.
+// done закрывается при остановке сервера, чтобы стримы не держали Shutdown.
+func Stream(hub subscriber, done <-chan struct{}) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+
+		// Стрим живёт дольше WriteTimeout сервера.
+		if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+			apperrors.Write(w, errStreamingUnsupported)
+			return
+		}
+
+		sub := hub.Subscribe(pubsub.Filter{
+			Type:   r.URL.Query().Get("type"),
+			Prefix: r.URL.Query().Get("prefix"),
+		}, streamBuffer)
+		defer hub.Unsubscribe(sub)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+
+		heartbeat := time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-done:
+				return
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+					return
+				}
+			case e, ok := <-sub.Events():
+				if !ok {
+					return
+				}
+
+				if dropped := sub.TakeDropped(); dropped > 0 {
+					if _, err := fmt.Fprintf(w, "event: dropped\ndata: {\"dropped\": %d}\n\n", dropped); err != nil {
+						return
+					}
+				}
+
+				data, err := json.Marshal(e)
+				if err != nil {
+					continue
+				}
+
+				if _, err := fmt.Fprintf(w, "event: metric\ndata: %s\n\n", data); err != nil {
+					return
+				}
+			}
+
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
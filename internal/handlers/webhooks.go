@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/apperrors"
+	"github.com/BeInBloom/spanish-inquisition/internal/webhooks"
+	"github.com/go-chi/chi/v5"
+)
+
+type webhookRegistry interface {
+	List() []webhooks.Subscription
+	Add(webhooks.Subscription) error
+	Remove(id string) error
+}
+
+func ListWebhooks(reg webhookRegistry) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		jsonString, err := json.Marshal(reg.List())
+		if err != nil {
+			apperrors.Write(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonString)
+	}
+}
+
+func AddWebhook(reg webhookRegistry) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var sub webhooks.Subscription
+
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&sub); err != nil {
+			apperrors.Write(w, apperrors.Wrap(apperrors.ErrValidation, err))
+			return
+		}
+
+		if err := reg.Add(sub); err != nil {
+			apperrors.Write(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+
+		w.Write([]byte("{\"status\": \"ok\"}"))
+	}
+}
+
+func DeleteWebhook(reg webhookRegistry) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := reg.Remove(chi.URLParam(r, "id")); err != nil {
+			apperrors.Write(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+
+		w.Write([]byte("{\"status\": \"ok\"}"))
+	}
+}
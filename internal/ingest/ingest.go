@@ -0,0 +1,171 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/apperrors"
+	config "github.com/BeInBloom/spanish-inquisition/internal/config/server-config"
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+	"github.com/BeInBloom/spanish-inquisition/internal/relabel"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	statsFlushInterval = 10 * time.Second
+)
+
+var (
+	ErrRejected = apperrors.New(apperrors.ErrValidation, "rejected", "metric rejected by ingest rules")
+)
+
+type saver interface {
+	CreateOrUpdate(models.Metrics) error
+}
+
+type relabeler interface {
+	Relabel(models.Metrics) (models.Metrics, relabel.Verdict)
+}
+
+// ingest стоит перед хранилищем на пути записи, поэтому правила применяются
+// ко всем ручкам, которые пишут через него. Число выкинутых и отклонённых
+// метрик копится в памяти и периодически пишется в хранилище как counter'ы
+// ServerIngestDropped и ServerIngestRejected.
+type ingest struct {
+	repo     saver
+	pipeline relabeler
+
+	mutex    sync.Mutex
+	dropped  int64
+	rejected int64
+}
+
+func New(ctx context.Context, repo saver, cfg config.IngestConfig) (*ingest, error) {
+	const fn = "ingest.New"
+
+	cfgRules := cfg.Rules
+
+	if cfg.RulesPath != "" {
+		fileRules, err := readRules(cfg.RulesPath)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fn, err)
+		}
+
+		cfgRules = append(cfgRules, fileRules...)
+	}
+
+	rules := make([]relabel.Rule, 0, len(cfgRules))
+	for _, r := range cfgRules {
+		rules = append(rules, relabel.Rule(r))
+	}
+
+	pipeline, err := relabel.New(rules)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn, err)
+	}
+
+	i := &ingest{
+		repo:     repo,
+		pipeline: pipeline,
+	}
+
+	go i.flushStats(ctx)
+
+	return i, nil
+}
+
+// Relabel показывает, во что превратится метрика при записи, ничего не записывая.
+func (i *ingest) Relabel(m models.Metrics) (models.Metrics, relabel.Verdict) {
+	return i.pipeline.Relabel(m)
+}
+
+func (i *ingest) CreateOrUpdate(m models.Metrics) error {
+	const fn = "ingest.CreateOrUpdate"
+
+	m, verdict := i.pipeline.Relabel(m)
+
+	switch verdict {
+	case relabel.Dropped:
+		i.mutex.Lock()
+		i.dropped++
+		i.mutex.Unlock()
+
+		return nil
+	case relabel.Rejected:
+		i.mutex.Lock()
+		i.rejected++
+		i.mutex.Unlock()
+
+		return fmt.Errorf("%s: %w", fn, ErrRejected)
+	}
+
+	return i.repo.CreateOrUpdate(m)
+}
+
+func (i *ingest) flushStats(ctx context.Context) {
+	ticker := time.NewTicker(statsFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := i.writeStats(); err != nil {
+				fmt.Printf("ingest stats error: %v\n", err)
+			}
+		}
+	}
+}
+
+func (i *ingest) writeStats() error {
+	i.mutex.Lock()
+	dropped, rejected := i.dropped, i.rejected
+	i.dropped, i.rejected = 0, 0
+	i.mutex.Unlock()
+
+	if err := i.writeCounter("ServerIngestDropped", dropped); err != nil {
+		i.restoreStats(dropped, rejected)
+		return err
+	}
+
+	if err := i.writeCounter("ServerIngestRejected", rejected); err != nil {
+		i.restoreStats(0, rejected)
+		return err
+	}
+
+	return nil
+}
+
+func (i *ingest) writeCounter(id string, delta int64) error {
+	if delta == 0 {
+		return nil
+	}
+
+	return i.repo.CreateOrUpdate(models.Metrics{ID: id, MType: models.Counter, Delta: &delta})
+}
+
+func (i *ingest) restoreStats(dropped, rejected int64) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.dropped += dropped
+	i.rejected += rejected
+}
+
+func readRules(path string) ([]config.RelabelRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []config.RelabelRule
+	if err := yaml.Unmarshal(data, &rules); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
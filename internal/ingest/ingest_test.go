@@ -0,0 +1,74 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	config "github.com/BeInBloom/spanish-inquisition/internal/config/server-config"
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+	"github.com/BeInBloom/spanish-inquisition/internal/relabel"
+)
+
+type memSaver struct {
+	data map[string]models.Metrics
+}
+
+func (s *memSaver) CreateOrUpdate(m models.Metrics) error {
+	if m.MType == models.Counter {
+		if old, ok := s.data[m.ID]; ok {
+			sum := *old.Delta + *m.Delta
+			m.Delta = &sum
+		}
+	}
+
+	s.data[m.ID] = m
+
+	return nil
+}
+
+func TestIngest_CreateOrUpdate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	repo := &memSaver{data: make(map[string]models.Metrics)}
+
+	i, err := New(ctx, repo, config.IngestConfig{Rules: []config.RelabelRule{
+		{Action: relabel.ActionDrop, Match: "Debug.*"},
+		{Action: relabel.ActionReject, Match: ".*", Type: models.Counter},
+		{Action: relabel.ActionRename, Match: "Alloc", Replacement: "HeapAlloc"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value := 1.0
+	var delta int64 = 1
+
+	if err := i.CreateOrUpdate(models.Metrics{ID: "DebugValue", MType: models.Gauge, Value: &value}); err != nil {
+		t.Fatalf("dropped metric must not fail the write: %v", err)
+	}
+
+	if err := i.CreateOrUpdate(models.Metrics{ID: "PollCount", MType: models.Counter, Delta: &delta}); !errors.Is(err, ErrRejected) {
+		t.Fatalf("got %v, want %v", err, ErrRejected)
+	}
+
+	if err := i.CreateOrUpdate(models.Metrics{ID: "Alloc", MType: models.Gauge, Value: &value}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := repo.data["HeapAlloc"]; !ok || len(repo.data) != 1 {
+		t.Fatalf("only renamed HeapAlloc must reach the repository, got %v", repo.data)
+	}
+
+	if err := i.writeStats(); err != nil {
+		t.Fatal(err)
+	}
+
+	for id, want := range map[string]int64{"ServerIngestDropped": 1, "ServerIngestRejected": 1} {
+		m, ok := repo.data[id]
+		if !ok || *m.Delta != want {
+			t.Errorf("%s: got %+v, want %d", id, m, want)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/apperrors"
+	config "github.com/BeInBloom/spanish-inquisition/internal/config/server-config"
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+	"github.com/BeInBloom/spanish-inquisition/internal/relabel"
+)
+
+const (
+	window = time.Minute
+)
+
+var (
+	ErrSeriesLimit = apperrors.New(apperrors.ErrRateLimited, "series_limit_exceeded", "series limit exceeded")
+	ErrRateLimited = apperrors.New(apperrors.ErrRateLimited, "rate_limited", "new series rate limit exceeded")
+)
+
+type dumper interface {
+	Dump() ([]models.Metrics, error)
+}
+
+// relabeler — правила ingest: считать нужно серии, которые реально
+// будут записаны, то есть после переименования и без выброшенных.
+type relabeler interface {
+	Relabel(models.Metrics) (models.Metrics, relabel.Verdict)
+}
+
+type Usage struct {
+	MaxSeries             int              `json:"max_series"`
+	Series                int              `json:"series"`
+	MaxNewSeriesPerMinute int              `json:"max_new_series_per_minute"`
+	NewSeries             map[string]int   `json:"new_series"`
+	Rejected              map[string]int64 `json:"rejected"`
+	WindowStart           time.Time        `json:"window_start"`
+}
+
+// limiter решает, можно ли источнику создать новые серии.
+// Известные серии — это всё, что лежит в хранилище, плюс всё, что пропустили
+// за последнюю минуту: запись могла ещё не дойти до хранилища. Раз в минуту
+// набор пересобирается из Dump, чтобы удалённые серии перестали учитываться.
+type limiter struct {
+	cfg   config.LimitsConfig
+	repo  dumper
+	rules relabeler
+
+	mutex       sync.Mutex
+	known       map[string]struct{}
+	seen        map[string]struct{}
+	newSeries   map[string]int
+	rejected    map[string]int64
+	windowStart time.Time
+}
+
+func New(ctx context.Context, cfg config.LimitsConfig, repo dumper, rules relabeler) (*limiter, error) {
+	const fn = "limiter.New"
+
+	l := &limiter{
+		cfg:      cfg,
+		repo:     repo,
+		rules:    rules,
+		rejected: make(map[string]int64),
+	}
+
+	if err := l.resync(); err != nil {
+		return nil, fmt.Errorf("%s: %v", fn, err)
+	}
+
+	go l.run(ctx)
+
+	return l, nil
+}
+
+// Admit проверяет запрос источника целиком: либо все его новые серии
+// укладываются в лимиты, либо запрос отклоняется. Метрики должны быть
+// уже проверены: ошибочные всё равно не запишутся и учитываться не должны.
+func (l *limiter) Admit(source string, metrics []models.Metrics) error {
+	const fn = "limiter.Admit"
+
+	keys := make([]string, 0, len(metrics))
+
+	for _, m := range metrics {
+		m, verdict := l.rules.Relabel(m)
+		if verdict != relabel.Kept {
+			continue
+		}
+
+		keys = append(keys, seriesKey(m))
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	fresh := make(map[string]struct{})
+
+	for _, key := range keys {
+		if _, ok := l.known[key]; !ok {
+			fresh[key] = struct{}{}
+		}
+	}
+
+	if l.cfg.MaxSeries > 0 && len(l.known)+len(fresh) > l.cfg.MaxSeries {
+		l.rejected[source]++
+		return fmt.Errorf("%s: %w: %d series stored, limit %d", fn, ErrSeriesLimit, len(l.known), l.cfg.MaxSeries)
+	}
+
+	if l.cfg.MaxNewSeriesPerMinute > 0 && l.newSeries[source]+len(fresh) > l.cfg.MaxNewSeriesPerMinute {
+		l.rejected[source]++
+		return fmt.Errorf("%s: %w: %d new series this minute, limit %d", fn, ErrRateLimited, l.newSeries[source], l.cfg.MaxNewSeriesPerMinute)
+	}
+
+	for key := range fresh {
+		l.known[key] = struct{}{}
+	}
+
+	for _, key := range keys {
+		l.seen[key] = struct{}{}
+	}
+
+	if len(fresh) > 0 {
+		l.newSeries[source] += len(fresh)
+	}
+
+	return nil
+}
+
+func (l *limiter) Usage() Usage {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	newSeries := make(map[string]int, len(l.newSeries))
+	for k, v := range l.newSeries {
+		newSeries[k] = v
+	}
+
+	rejected := make(map[string]int64, len(l.rejected))
+	for k, v := range l.rejected {
+		rejected[k] = v
+	}
+
+	return Usage{
+		MaxSeries:             l.cfg.MaxSeries,
+		Series:                len(l.known),
+		MaxNewSeriesPerMinute: l.cfg.MaxNewSeriesPerMinute,
+		NewSeries:             newSeries,
+		Rejected:              rejected,
+		WindowStart:           l.windowStart,
+	}
+}
+
+func (l *limiter) run(ctx context.Context) {
+	ticker := time.NewTicker(window)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := l.resync(); err != nil {
+				fmt.Printf("limiter resync error: %v\n", err)
+			}
+		}
+	}
+}
+
+func (l *limiter) resync() error {
+	stored, err := l.repo.Dump()
+	if err != nil {
+		return err
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	known := make(map[string]struct{}, len(stored)+len(l.seen))
+	for _, m := range stored {
+		known[seriesKey(m)] = struct{}{}
+	}
+
+	for key := range l.seen {
+		known[key] = struct{}{}
+	}
+
+	l.known = known
+	l.seen = make(map[string]struct{})
+	l.newSeries = make(map[string]int)
+	l.windowStart = time.Now()
+
+	return nil
+}
+
+func seriesKey(m models.Metrics) string {
+	return m.MType + ":" + m.ID
+}
@@ -0,0 +1,107 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	config "github.com/BeInBloom/spanish-inquisition/internal/config/server-config"
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+	"github.com/BeInBloom/spanish-inquisition/internal/relabel"
+)
+
+type staticDumper []models.Metrics
+
+func (d staticDumper) Dump() ([]models.Metrics, error) {
+	return d, nil
+}
+
+func gauges(ids ...string) []models.Metrics {
+	metrics := make([]models.Metrics, 0, len(ids))
+	for _, id := range ids {
+		metrics = append(metrics, models.Metrics{ID: id, MType: models.Gauge})
+	}
+
+	return metrics
+}
+
+func noRules(t *testing.T) relabeler {
+	t.Helper()
+
+	p, err := relabel.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+func TestLimiter_Admit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	l, err := New(ctx, config.LimitsConfig{MaxSeries: 4, MaxNewSeriesPerMinute: 2}, staticDumper(gauges("Alloc")), noRules(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.Admit("agent-1", gauges("Alloc", "Sys", "HeapAlloc")); err != nil {
+		t.Fatalf("known series must not count against the limit: %v", err)
+	}
+
+	if err := l.Admit("agent-1", gauges("Sys", "Frees")); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("got %v, want %v", err, ErrRateLimited)
+	}
+
+	if err := l.Admit("agent-2", gauges("Frees", "Mallocs")); !errors.Is(err, ErrSeriesLimit) {
+		t.Fatalf("got %v, want %v", err, ErrSeriesLimit)
+	}
+
+	if err := l.Admit("agent-2", gauges("Frees")); err != nil {
+		t.Fatal(err)
+	}
+
+	usage := l.Usage()
+	if usage.Series != 4 || usage.NewSeries["agent-1"] != 2 || usage.Rejected["agent-1"] != 1 || usage.Rejected["agent-2"] != 1 {
+		t.Fatalf("unexpected usage %+v", usage)
+	}
+
+	if err := l.resync(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.Admit("agent-1", gauges("Sys", "HeapAlloc", "Frees")); err != nil {
+		t.Fatalf("series seen in the last window must stay known: %v", err)
+	}
+}
+
+func TestLimiter_CountsStoredSeries(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rules, err := relabel.New([]relabel.Rule{
+		{Action: relabel.ActionDrop, Match: "Debug.*"},
+		{Action: relabel.ActionRename, Match: "Old(.*)", Replacement: "$1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := New(ctx, config.LimitsConfig{MaxSeries: 2}, staticDumper(gauges("Alloc")), rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// OldAlloc записывается как Alloc, а Debug-серии выбрасываются: новых серий нет.
+	if err := l.Admit("agent-1", gauges("OldAlloc", "DebugA", "DebugB")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.Admit("agent-1", gauges("Sys")); err != nil {
+		t.Fatal(err)
+	}
+
+	if usage := l.Usage(); usage.Series != 2 {
+		t.Fatalf("got %d series, want 2", usage.Series)
+	}
+}
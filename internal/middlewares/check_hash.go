@@ -8,11 +8,27 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/apperrors"
 )
 
 const (
 	signed = "HashSHA256"
+
+	signatureHeader     = "X-Signature"
+	signatureTimeHeader = "X-Signature-Timestamp"
+	signatureMaxAge     = 5 * time.Minute
+)
+
+var (
+	errInvalidHash = apperrors.New(apperrors.ErrValidation, "invalid_hash", "invalid hash")
+	errNoKey       = apperrors.New(apperrors.ErrForbidden, "no_server_key", "forbidden: server key is not configured")
+	errNotSigned   = apperrors.New(apperrors.ErrForbidden, "not_signed", "forbidden: request is not signed")
+	errBadHash     = apperrors.New(apperrors.ErrForbidden, "invalid_hash", "forbidden: invalid hash")
+	errStaleSign   = apperrors.New(apperrors.ErrForbidden, "stale_signature", "forbidden: signature timestamp is missing or too old")
 )
 
 func CheckHash(key string) func(h http.Handler) http.Handler {
@@ -24,12 +40,12 @@ func CheckHash(key string) func(h http.Handler) http.Handler {
 			if hash != "" {
 				bodyBytes, err := io.ReadAll(r.Body)
 				if err != nil {
-					http.Error(w, "internal server error", http.StatusInternalServerError)
+					apperrors.Write(w, apperrors.Wrap(apperrors.ErrValidation, err))
 					return
 				}
 
 				if !isCorrectHash(hash, bodyBytes, key) {
-					http.Error(w, "invalid hash", http.StatusBadRequest)
+					apperrors.Write(w, errInvalidHash)
 					return
 				}
 
@@ -45,6 +61,85 @@ func CheckHash(key string) func(h http.Handler) http.Handler {
 
 }
 
+// RequireHash пропускает только подписанные запросы и вешается на опасные ручки
+// (удаление, сброс). Без ключа на сервере такие ручки закрыты совсем.
+// Подпись идёт в X-Signature, а не в HashSHA256: она покрывает не только
+// тело, но и метод, путь и время подписи (X-Signature-Timestamp, unix-секунды),
+// так что перехваченный запрос можно повторить лишь в пределах signatureMaxAge.
+func RequireHash(key string) func(h http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		f := func(w http.ResponseWriter, r *http.Request) {
+			if key == "" {
+				apperrors.Write(w, errNoKey)
+				return
+			}
+
+			hash := r.Header.Get(signatureHeader)
+			if hash == "" {
+				apperrors.Write(w, errNotSigned)
+				return
+			}
+
+			timestamp := r.Header.Get(signatureTimeHeader)
+			if !isFresh(timestamp, time.Now()) {
+				apperrors.Write(w, errStaleSign)
+				return
+			}
+
+			bodyBytes, err := io.ReadAll(r.Body)
+			if err != nil {
+				apperrors.Write(w, apperrors.Wrap(apperrors.ErrValidation, err))
+				return
+			}
+
+			if !isCorrectHash(hash, signedPayload(r.Method, r.URL.Path, timestamp, bodyBytes), key) {
+				apperrors.Write(w, errBadHash)
+				return
+			}
+
+			r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+
+			h.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(f)
+	}
+}
+
+// SignRequest подписывает запрос для ручек за RequireHash.
+func SignRequest(r *http.Request, body []byte, key string) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write(signedPayload(r.Method, r.URL.Path, timestamp, body))
+
+	r.Header.Set(signatureTimeHeader, timestamp)
+	r.Header.Set(signatureHeader, hex.EncodeToString(h.Sum(nil)))
+}
+
+func signedPayload(method, path, timestamp string, body []byte) []byte {
+	payload := make([]byte, 0, len(method)+len(path)+len(timestamp)+len(body)+3)
+	payload = append(payload, timestamp...)
+	payload = append(payload, '\n')
+	payload = append(payload, method...)
+	payload = append(payload, ' ')
+	payload = append(payload, path...)
+	payload = append(payload, '\n')
+
+	return append(payload, body...)
+}
+
+func isFresh(timestamp string, now time.Time) bool {
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	age := now.Sub(time.Unix(sec, 0))
+
+	return age <= signatureMaxAge && age >= -signatureMaxAge
+}
+
 func isCorrectHash(hash string, bodyBytes []byte, key string) bool {
 	h := hmac.New(sha256.New, []byte(key))
 
@@ -0,0 +1,139 @@
+package middlewares
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sign(data, key string) string {
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write([]byte(data))
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+var ok = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+func TestCheckHash(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		hash string
+		want int
+	}{
+		{name: "unsigned", want: http.StatusOK},
+		{name: "empty body signed", hash: sign("", "k"), want: http.StatusOK},
+		{name: "body signed", body: `{"id":"X"}`, hash: sign(`{"id":"X"}`, "k"), want: http.StatusOK},
+		{name: "wrong hash", body: `{"id":"X"}`, hash: sign(`{"id":"Y"}`, "k"), want: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/update/gauge/X/1", strings.NewReader(tt.body))
+			if tt.hash != "" {
+				r.Header.Set(signed, tt.hash)
+			}
+
+			w := httptest.NewRecorder()
+			CheckHash("k")(ok).ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("got %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireHash(t *testing.T) {
+	stale := strconv.FormatInt(time.Now().Add(-2*signatureMaxAge).Unix(), 10)
+
+	tests := []struct {
+		name   string
+		key    string
+		method string
+		path   string
+		body   string
+		// prepare подписывает запрос; по умолчанию — правильно ключом "k".
+		prepare func(r *http.Request, body []byte)
+		want    int
+	}{
+		{name: "no key on server", path: "/value/gauge/X", want: http.StatusForbidden},
+		{name: "unsigned", key: "k", path: "/value/gauge/X", prepare: func(*http.Request, []byte) {}, want: http.StatusForbidden},
+		{name: "path signed", key: "k", path: "/value/gauge/X", want: http.StatusOK},
+		{name: "body signed", key: "k", path: "/deletes/", body: `[{"id":"X","type":"gauge"}]`, want: http.StatusOK},
+		{name: "other key", key: "other", path: "/value/gauge/X", want: http.StatusForbidden},
+		{
+			name: "other path", key: "k", path: "/value/gauge/Y",
+			prepare: func(r *http.Request, body []byte) {
+				SignRequest(r, body, "k")
+				r.URL.Path = "/value/gauge/X"
+			},
+			want: http.StatusForbidden,
+		},
+		{
+			name: "other method", key: "k", method: http.MethodPost, path: "/value/gauge/X",
+			prepare: func(r *http.Request, body []byte) {
+				r.Method = http.MethodDelete
+				SignRequest(r, body, "k")
+				r.Method = http.MethodPost
+			},
+			want: http.StatusForbidden,
+		},
+		{
+			name: "no timestamp", key: "k", path: "/value/gauge/X",
+			prepare: func(r *http.Request, body []byte) {
+				SignRequest(r, body, "k")
+				r.Header.Del(signatureTimeHeader)
+			},
+			want: http.StatusForbidden,
+		},
+		{
+			name: "replayed later", key: "k", path: "/value/gauge/X",
+			prepare: func(r *http.Request, body []byte) {
+				r.Header.Set(signatureTimeHeader, stale)
+				r.Header.Set(signatureHeader, sign(string(signedPayload(r.Method, r.URL.Path, stale, body)), "k"))
+			},
+			want: http.StatusForbidden,
+		},
+		{
+			name: "legacy body hash", key: "k", path: "/value/gauge/X",
+			prepare: func(r *http.Request, body []byte) {
+				r.Header.Set(signed, sign("/value/gauge/X", "k"))
+			},
+			want: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodDelete
+			}
+
+			r := httptest.NewRequest(method, tt.path, strings.NewReader(tt.body))
+
+			prepare := tt.prepare
+			if prepare == nil {
+				prepare = func(r *http.Request, body []byte) { SignRequest(r, body, "k") }
+			}
+			prepare(r, []byte(tt.body))
+
+			w := httptest.NewRecorder()
+			RequireHash(tt.key)(ok).ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("got %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"io"
 	"net/http"
 	"strings"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/apperrors"
 )
 
 //TODO понять и переделать вот это все
@@ -96,7 +98,7 @@ func Compress(h http.Handler) http.Handler {
 			// оборачиваем тело запроса в io.Reader с поддержкой декомпрессии
 			cr, err := newCompressReader(r.Body)
 			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
+				apperrors.Write(w, apperrors.Wrap(apperrors.ErrValidation, err))
 				return
 			}
 			// меняем тело запроса на новое
@@ -116,7 +118,7 @@ func Decomp(next http.Handler) http.Handler {
 		if strings.Contains(r.Header.Get("Content-Encoding"), "gzip") {
 			gz, err := gzip.NewReader(r.Body)
 			if err != nil {
-				http.Error(w, "Failed to decompress request body", http.StatusBadRequest)
+				apperrors.Write(w, apperrors.Wrap(apperrors.ErrValidation, err))
 				return
 			}
 
@@ -0,0 +1,100 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/apperrors"
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	agentIDHeader = "X-Agent-ID"
+)
+
+type admitter interface {
+	Admit(source string, metrics []models.Metrics) error
+}
+
+// LimitSeries вешается на ручки записи и до записи проверяет, не создаёт ли
+// источник слишком много новых серий. Источник — заголовок X-Agent-ID,
+// а если его нет, то IP клиента. Запрос, который не удалось разобрать,
+// пропускается дальше: ошибку вернёт сама ручка. Параметры пути chi
+// заполняет только при выборе маршрута, поэтому для /update/{type}/...
+// мидлварь нужно вешать на сам маршрут через With, а не через Use.
+func LimitSeries(l admitter) func(h http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		f := func(w http.ResponseWriter, r *http.Request) {
+			metrics, err := requestMetrics(r)
+			if err != nil {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			if err := l.Admit(requestSource(r), metrics); err != nil {
+				apperrors.Write(w, err)
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(f)
+	}
+}
+
+func requestSource(r *http.Request) string {
+	if id := r.Header.Get(agentIDHeader); id != "" {
+		return id
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// requestMetrics достаёт из запроса метрики, которые ручка попробует записать.
+// Ошибочные не возвращаются: они не запишутся и серий не создадут.
+func requestMetrics(r *http.Request) ([]models.Metrics, error) {
+	if mType := chi.URLParam(r, "type"); mType != "" {
+		m, err := models.CreateMetricsByType(mType, chi.URLParam(r, "name"), chi.URLParam(r, "value"))
+		if err != nil {
+			return nil, err
+		}
+
+		return []models.Metrics{m}, nil
+	}
+
+	bodyBytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+
+	var batch []models.Metrics
+	if err := json.Unmarshal(bodyBytes, &batch); err != nil {
+		var single models.Metrics
+		if err := json.Unmarshal(bodyBytes, &single); err != nil {
+			return nil, err
+		}
+
+		batch = []models.Metrics{single}
+	}
+
+	valid := batch[:0]
+	for _, m := range batch {
+		if m.Validate() == nil {
+			valid = append(valid, m)
+		}
+	}
+
+	return valid, nil
+}
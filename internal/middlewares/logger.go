@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/BeInBloom/spanish-inquisition/internal/apperrors"
 	"go.uber.org/zap"
 )
 
@@ -44,7 +45,7 @@ func Logger(log *zap.SugaredLogger) func(h http.Handler) http.Handler {
 			bodyBytes, err := io.ReadAll(r.Body)
 			if err != nil {
 				log.Error("failed to read request body", "error", err)
-				http.Error(w, "internal server error", http.StatusInternalServerError)
+				apperrors.Write(w, apperrors.Wrap(apperrors.ErrValidation, err))
 				return
 			}
 
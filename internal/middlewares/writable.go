@@ -0,0 +1,32 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/apperrors"
+)
+
+var (
+	errReadOnly = apperrors.New(apperrors.ErrUnavailable, "read_only", "node is a passive replica")
+)
+
+type writableChecker interface {
+	Writable() bool
+}
+
+// RequireWritable вешается на ручки записи: пассивная реплика отвечает 503,
+// чтобы клиент пошёл на primary.
+func RequireWritable(n writableChecker) func(h http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		f := func(w http.ResponseWriter, r *http.Request) {
+			if !n.Writable() {
+				apperrors.Write(w, errReadOnly)
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(f)
+	}
+}
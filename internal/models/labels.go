@@ -0,0 +1,127 @@
+package models
+
+import (
+	"sort"
+	"strings"
+)
+
+// SeriesID строит идентификатор серии вида name{key="value",...}.
+// Метки сортируются по ключу, чтобы один и тот же набор всегда давал один и тот же ID.
+func SeriesID(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k)
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(labels[k]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// EscapeLabelValue экранирует значение метки так же, как оно лежит внутри ID.
+func EscapeLabelValue(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+// UnescapeLabelValue — обратное к EscapeLabelValue. Неразборчивое значение
+// возвращается как есть.
+func UnescapeLabelValue(v string) string {
+	value, n, ok := unquoteLabel(v + `"`)
+	if !ok || n != len(v)+1 {
+		return v
+	}
+
+	return value
+}
+
+// ParseSeriesID разбирает ID, собранный SeriesID, обратно на имя и метки.
+// ID без меток или с неразборчивыми метками целиком считается именем.
+func ParseSeriesID(id string) (string, map[string]string) {
+	open := strings.IndexByte(id, '{')
+	if open < 0 || !strings.HasSuffix(id, "}") {
+		return id, nil
+	}
+
+	labels, ok := parseLabels(id[open+1 : len(id)-1])
+	if !ok {
+		return id, nil
+	}
+
+	return id[:open], labels
+}
+
+func parseLabels(s string) (map[string]string, bool) {
+	labels := make(map[string]string)
+
+	for len(s) > 0 {
+		key, rest, ok := strings.Cut(s, `="`)
+		if !ok || key == "" {
+			return nil, false
+		}
+
+		value, n, ok := unquoteLabel(rest)
+		if !ok {
+			return nil, false
+		}
+
+		labels[key] = value
+		s = rest[n:]
+
+		if len(s) > 0 {
+			if s[0] != ',' {
+				return nil, false
+			}
+			s = s[1:]
+		}
+	}
+
+	return labels, true
+}
+
+// unquoteLabel читает значение до закрывающей кавычки и возвращает,
+// сколько байт было прочитано вместе с ней.
+func unquoteLabel(s string) (string, int, bool) {
+	var value strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return value.String(), i + 1, true
+		case '\\':
+			i++
+			if i >= len(s) {
+				return "", 0, false
+			}
+
+			if s[i] == 'n' {
+				value.WriteByte('\n')
+			} else {
+				value.WriteByte(s[i])
+			}
+		default:
+			value.WriteByte(s[i])
+		}
+	}
+
+	return "", 0, false
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSeriesID_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels map[string]string
+		wantID string
+	}{
+		{"HeapAlloc", nil, "HeapAlloc"},
+		{"NetBytesSent", map[string]string{"interface": "eth0"}, `NetBytesSent{interface="eth0"}`},
+		{"X", map[string]string{"b": "2", "a": "1"}, `X{a="1",b="2"}`},
+		{"X", map[string]string{"q": `say "hi", \o/` + "\n"}, `X{q="say \"hi\", \\o/\n"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.wantID, func(t *testing.T) {
+			id := SeriesID(tt.name, tt.labels)
+			if id != tt.wantID {
+				t.Fatalf("SeriesID() = %s, want %s", id, tt.wantID)
+			}
+
+			name, labels := ParseSeriesID(id)
+			if name != tt.name {
+				t.Errorf("name = %s, want %s", name, tt.name)
+			}
+
+			if len(tt.labels) > 0 && !reflect.DeepEqual(labels, tt.labels) {
+				t.Errorf("labels = %v, want %v", labels, tt.labels)
+			}
+		})
+	}
+}
+
+func TestParseSeriesID_Malformed(t *testing.T) {
+	for _, id := range []string{`X{a}`, `X{a="1"`, `X{a="1" b="2"}`, `X{="1"}`} {
+		name, labels := ParseSeriesID(id)
+		if name != id || labels != nil {
+			t.Errorf("ParseSeriesID(%s) = %s, %v; want the whole ID as name", id, name, labels)
+		}
+	}
+}
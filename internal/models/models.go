@@ -3,15 +3,26 @@ package models
 import (
 	"fmt"
 	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/apperrors"
 )
 
 const (
 	Gauge   = "gauge"
 	Counter = "counter"
+
+	// MaxIDLength — длина ID в символах, которую держат все хранилища
+	// (в Postgres колонка id — VARCHAR(255)).
+	MaxIDLength = 255
 )
 
 var (
-	ErrUnexpectedMetricType = fmt.Errorf("unexpected metric type")
+	ErrUnexpectedMetricType = apperrors.New(apperrors.ErrValidation, "bad_metric_type", "unexpected metric type")
+	ErrInvalidMetric        = apperrors.New(apperrors.ErrValidation, "invalid_metric", "metric has no id or no value for its type")
+	ErrMetricNotFound       = apperrors.New(apperrors.ErrNotFound, "metric_not_found", "metric not found")
+	ErrIDTooLong            = apperrors.New(apperrors.ErrValidation, "id_too_long", "metric id is too long")
 )
 
 type Metrics struct {
@@ -19,6 +30,34 @@ type Metrics struct {
 	MType string   `json:"type" validate:"required,oneof=gauge counter"`
 	Delta *int64   `json:"delta,omitempty"`
 	Value *float64 `json:"value,omitempty"`
+	// UpdatedAt и Stale заполняет хранилище, от клиента они игнорируются.
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	Stale     bool       `json:"stale,omitempty"`
+}
+
+// Point — значение counter'а (накопленное) в момент записи.
+type Point struct {
+	Time  time.Time
+	Value float64
+}
+
+// Validate проверяет то, без чего метрику нельзя сохранить: id, тип
+// и значение, подходящее типу.
+func (m Metrics) Validate() error {
+	switch {
+	case m.MType != Gauge && m.MType != Counter:
+		return ErrUnexpectedMetricType
+	case m.ID == "":
+		return ErrInvalidMetric
+	case utf8.RuneCountInString(m.ID) > MaxIDLength:
+		return ErrIDTooLong
+	case m.MType == Gauge && m.Value == nil:
+		return ErrInvalidMetric
+	case m.MType == Counter && m.Delta == nil:
+		return ErrInvalidMetric
+	}
+
+	return nil
 }
 
 func ParseMetrics(m Metrics) (string, string, string) {
@@ -46,7 +85,7 @@ func CreateMetricsByType(mType, id, val string) (Metrics, error) {
 func createGauge(id, val string) (Metrics, error) {
 	num, err := strconv.ParseFloat(val, 64)
 	if err != nil {
-		return Metrics{}, err
+		return Metrics{}, apperrors.Wrap(apperrors.ErrValidation, err)
 	}
 
 	return Metrics{
@@ -59,7 +98,7 @@ func createGauge(id, val string) (Metrics, error) {
 func createCounter(id, val string) (Metrics, error) {
 	num, err := strconv.ParseInt(val, 10, 64)
 	if err != nil {
-		return Metrics{}, err
+		return Metrics{}, apperrors.Wrap(apperrors.ErrValidation, err)
 	}
 
 	return Metrics{
@@ -0,0 +1,81 @@
+package pubsub
+
+import (
+	"errors"
+	"time"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/apperrors"
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+)
+
+type repository interface {
+	CreateOrUpdate(models.Metrics) error
+	Get(models.Metrics) (models.Metrics, error)
+}
+
+type broadcaster interface {
+	Publish(Event)
+	Subscribers() int
+}
+
+// publisher стоит на пути записи перед хранилищем и публикует
+// каждую успешно записанную метрику.
+type publisher struct {
+	repo repository
+	hub  broadcaster
+}
+
+func NewPublisher(repo repository, hub broadcaster) *publisher {
+	return &publisher{
+		repo: repo,
+		hub:  hub,
+	}
+}
+
+func (p *publisher) CreateOrUpdate(m models.Metrics) error {
+	// Копия снимается до записи: хранилище может оставить у себя указатели
+	// из m и менять значения по ним при следующих записях.
+	event := Event{Metric: clone(m)}
+
+	// Предыдущее состояние читается отдельно от записи, поэтому при
+	// конкурентных записях одной серии оно может быть неточным. Если
+	// прочитать его не удалось, событие уходит без него: считать серию
+	// новой можно только по ErrNotFound.
+	if p.hub.Subscribers() > 0 {
+		prev, err := p.repo.Get(m)
+
+		switch {
+		case err == nil:
+			prev = clone(prev)
+			event.Previous = &prev
+		case errors.Is(err, apperrors.ErrNotFound):
+			event.Created = true
+		}
+	}
+
+	if err := p.repo.CreateOrUpdate(m); err != nil {
+		return err
+	}
+
+	event.Time = time.Now()
+	p.hub.Publish(event)
+
+	return nil
+}
+
+func clone(m models.Metrics) models.Metrics {
+	if m.Delta != nil {
+		delta := *m.Delta
+		m.Delta = &delta
+	}
+
+	if m.Value != nil {
+		value := *m.Value
+		m.Value = &value
+	}
+
+	m.UpdatedAt = nil
+	m.Stale = false
+
+	return m
+}
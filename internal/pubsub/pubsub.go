@@ -0,0 +1,114 @@
+package pubsub
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+)
+
+// Event — принятая запись метрики. Для counter'а в Metric лежит
+// присланный прирост, а не накопленное значение. Previous — состояние
+// серии до записи, Created — серии до записи не было.
+type Event struct {
+	Metric   models.Metrics  `json:"metric"`
+	Previous *models.Metrics `json:"previous,omitempty"`
+	Created  bool            `json:"created,omitempty"`
+	Time     time.Time       `json:"time"`
+}
+
+// Filter отбирает события по типу и префиксу ID. Пустые поля пропускают всё.
+type Filter struct {
+	Type   string
+	Prefix string
+}
+
+func (f Filter) Matches(m models.Metrics) bool {
+	if f.Type != "" && m.MType != f.Type {
+		return false
+	}
+
+	return strings.HasPrefix(m.ID, f.Prefix)
+}
+
+type Subscription struct {
+	ch      chan Event
+	filter  Filter
+	dropped atomic.Int64
+}
+
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+// TakeDropped возвращает число событий, выкинутых из-за переполненного
+// буфера с прошлого вызова.
+func (s *Subscription) TakeDropped() int64 {
+	return s.dropped.Swap(0)
+}
+
+// hub раздаёт события подписчикам. Publish никогда не блокируется:
+// если подписчик не успевает читать, событие для него выкидывается.
+type hub struct {
+	mutex sync.RWMutex
+	subs  map[*Subscription]struct{}
+}
+
+func New() *hub {
+	return &hub{
+		subs: make(map[*Subscription]struct{}),
+	}
+}
+
+func (h *hub) Subscribe(f Filter, buffer int) *Subscription {
+	s := &Subscription{
+		ch:     make(chan Event, buffer),
+		filter: f,
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.subs[s] = struct{}{}
+
+	return s
+}
+
+// Unsubscribe закрывает канал подписки.
+func (h *hub) Unsubscribe(s *Subscription) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if _, ok := h.subs[s]; !ok {
+		return
+	}
+
+	delete(h.subs, s)
+	close(s.ch)
+}
+
+func (h *hub) Subscribers() int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	return len(h.subs)
+}
+
+func (h *hub) Publish(e Event) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	for s := range h.subs {
+		if !s.filter.Matches(e.Metric) {
+			continue
+		}
+
+		select {
+		case s.ch <- e:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package pubsub
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+)
+
+type memRepo map[string]models.Metrics
+
+func (r memRepo) CreateOrUpdate(m models.Metrics) error {
+	r[m.ID] = m
+	return nil
+}
+
+func (r memRepo) Get(m models.Metrics) (models.Metrics, error) {
+	if stored, ok := r[m.ID]; ok {
+		return stored, nil
+	}
+
+	return models.Metrics{}, models.ErrMetricNotFound
+}
+
+// brokenRepo пишет, но не может прочитать.
+type brokenRepo struct{ memRepo }
+
+func (brokenRepo) Get(models.Metrics) (models.Metrics, error) {
+	return models.Metrics{}, errors.New("connection reset")
+}
+
+func TestHub_SlowConsumerDoesNotBlock(t *testing.T) {
+	h := New()
+
+	slow := h.Subscribe(Filter{}, 1)
+	gauges := h.Subscribe(Filter{Type: models.Gauge, Prefix: "Heap"}, 10)
+
+	p := NewPublisher(memRepo{}, h)
+
+	value := 1.0
+	var delta int64 = 1
+
+	for i := 0; i < 3; i++ {
+		if err := p.CreateOrUpdate(models.Metrics{ID: "HeapAlloc", MType: models.Gauge, Value: &value}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := p.CreateOrUpdate(models.Metrics{ID: "HeapCount", MType: models.Counter, Delta: &delta}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(slow.Events()) != 1 || slow.TakeDropped() != 3 || slow.TakeDropped() != 0 {
+		t.Fatal("full subscription must drop events and count them")
+	}
+
+	if len(gauges.Events()) != 3 {
+		t.Fatalf("got %d events, want 3 filtered gauges", len(gauges.Events()))
+	}
+
+	value = 2
+	if e := <-gauges.Events(); *e.Metric.Value != 1 || !e.Created {
+		t.Fatalf("first write must be a created event with its own copy, got %+v", e)
+	}
+
+	if e := <-gauges.Events(); e.Created || e.Previous == nil || *e.Previous.Value != 1 {
+		t.Fatalf("next write must carry the previous state, got %+v", e)
+	}
+
+	h.Unsubscribe(slow)
+	h.Unsubscribe(slow)
+
+	if _, ok := <-slow.Events(); !ok {
+		t.Fatal("buffered event must still be readable after unsubscribe")
+	}
+
+	if _, ok := <-slow.Events(); ok {
+		t.Fatal("channel must be closed after unsubscribe")
+	}
+}
+
+func TestPublisher_CreatedOnlyWhenNotFound(t *testing.T) {
+	h := New()
+	sub := h.Subscribe(Filter{}, 1)
+
+	value := 1.0
+
+	if err := NewPublisher(brokenRepo{memRepo{}}, h).CreateOrUpdate(models.Metrics{ID: "Load", MType: models.Gauge, Value: &value}); err != nil {
+		t.Fatal(err)
+	}
+
+	if e := <-sub.Events(); e.Created || e.Previous != nil {
+		t.Fatalf("failed read must not mark the series as created, got %+v", e)
+	}
+}
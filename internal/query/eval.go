@@ -0,0 +1,250 @@
+package query
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+)
+
+// Sample — одна группа результата агрегации.
+type Sample struct {
+	Labels map[string]string `json:"labels"`
+	Value  float64           `json:"value"`
+	Series int               `json:"series"`
+}
+
+// Evaluate считает агрегацию по уже загруженным метрикам.
+// Counter'ы участвуют своим накопленным значением.
+func Evaluate(metrics []models.Metrics, agg Aggregation) []Sample {
+	groups := make(map[string]*Sample)
+
+	for _, m := range metrics {
+		name, labels := models.ParseSeriesID(m.ID)
+		if !agg.Selector.Matches(name, labels) {
+			continue
+		}
+
+		value, ok := numericValue(m)
+		if !ok {
+			continue
+		}
+
+		groupLabels := make(map[string]string, len(agg.By))
+		for _, l := range agg.By {
+			groupLabels[l] = labels[l]
+		}
+
+		key := models.SeriesID("", groupLabels)
+
+		g, ok := groups[key]
+		if !ok {
+			g = &Sample{Labels: groupLabels, Value: initialValue(agg.Op)}
+			groups[key] = g
+		}
+
+		g.Series++
+
+		switch agg.Op {
+		case AggSum, AggAvg:
+			g.Value += value
+		case AggMin:
+			g.Value = math.Min(g.Value, value)
+		case AggMax:
+			g.Value = math.Max(g.Value, value)
+		case AggCount:
+			g.Value++
+		}
+	}
+
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	res := make([]Sample, 0, len(groups))
+
+	for _, k := range keys {
+		g := groups[k]
+		if agg.Op == AggAvg {
+			g.Value /= float64(g.Series)
+		}
+
+		res = append(res, *g)
+	}
+
+	return res
+}
+
+func numericValue(m models.Metrics) (float64, bool) {
+	switch {
+	case m.Value != nil:
+		return *m.Value, true
+	case m.Delta != nil:
+		return float64(*m.Delta), true
+	default:
+		return 0, false
+	}
+}
+
+func initialValue(op string) float64 {
+	switch op {
+	case AggMin:
+		return math.Inf(1)
+	case AggMax:
+		return math.Inf(-1)
+	default:
+		return 0
+	}
+}
+
+// SelectSeries возвращает по сэмплу на каждую серию, подходящую под селектор.
+func SelectSeries(metrics []models.Metrics, sel Selector) []Sample {
+	var res []Sample
+
+	for _, m := range metrics {
+		name, labels := models.ParseSeriesID(m.ID)
+		if !sel.Matches(name, labels) {
+			continue
+		}
+
+		value, ok := numericValue(m)
+		if !ok {
+			continue
+		}
+
+		if labels == nil {
+			labels = map[string]string{}
+		}
+
+		res = append(res, Sample{Labels: labels, Value: value, Series: 1})
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return models.SeriesID("", res[i].Labels) < models.SeriesID("", res[j].Labels)
+	})
+
+	return res
+}
+
+// Source — хранилище, по которому считаются выражения. Агрегации и выборку
+// серий хранилище делает само, арифметика считается поверх в Eval.
+type Source interface {
+	Aggregate(Aggregation) ([]Sample, error)
+	Select(Selector) ([]Sample, error)
+}
+
+func Eval(e Expr, src Source) ([]Sample, error) {
+	v, err := eval(e, src)
+	if err != nil {
+		return nil, err
+	}
+
+	if v.scalar {
+		if math.IsNaN(v.value) || math.IsInf(v.value, 0) {
+			return nil, nil
+		}
+
+		return []Sample{{Labels: map[string]string{}, Value: v.value}}, nil
+	}
+
+	return v.samples, nil
+}
+
+type operand struct {
+	scalar  bool
+	value   float64
+	samples []Sample
+}
+
+func eval(e Expr, src Source) (operand, error) {
+	switch e := e.(type) {
+	case NumberExpr:
+		return operand{scalar: true, value: e.Value}, nil
+	case Selector:
+		samples, err := src.Select(e)
+		return operand{samples: samples}, err
+	case Aggregation:
+		samples, err := src.Aggregate(e)
+		return operand{samples: samples}, err
+	case BinaryExpr:
+		lhs, err := eval(e.LHS, src)
+		if err != nil {
+			return operand{}, err
+		}
+
+		rhs, err := eval(e.RHS, src)
+		if err != nil {
+			return operand{}, err
+		}
+
+		return binary(e.Op, lhs, rhs), nil
+	default:
+		return operand{}, fmt.Errorf("%w: unsupported expression %T", ErrBadExpr, e)
+	}
+}
+
+// binary выкидывает результаты, которые не являются конечными числами
+// (деление на ноль): их нельзя ни отдать в JSON, ни записать как gauge.
+func binary(op byte, lhs, rhs operand) operand {
+	if lhs.scalar && rhs.scalar {
+		return operand{scalar: true, value: apply(op, lhs.value, rhs.value)}
+	}
+
+	var res []Sample
+
+	switch {
+	case lhs.scalar:
+		for _, s := range rhs.samples {
+			s.Value = apply(op, lhs.value, s.Value)
+			res = append(res, s)
+		}
+	case rhs.scalar:
+		for _, s := range lhs.samples {
+			s.Value = apply(op, s.Value, rhs.value)
+			res = append(res, s)
+		}
+	default:
+		index := make(map[string]Sample, len(rhs.samples))
+		for _, s := range rhs.samples {
+			index[models.SeriesID("", s.Labels)] = s
+		}
+
+		for _, s := range lhs.samples {
+			other, ok := index[models.SeriesID("", s.Labels)]
+			if !ok {
+				continue
+			}
+
+			s.Value = apply(op, s.Value, other.Value)
+			s.Series += other.Series
+			res = append(res, s)
+		}
+	}
+
+	finite := res[:0]
+	for _, s := range res {
+		if !math.IsNaN(s.Value) && !math.IsInf(s.Value, 0) {
+			finite = append(finite, s)
+		}
+	}
+
+	return operand{samples: finite}
+}
+
+func apply(op byte, a, b float64) float64 {
+	switch op {
+	case '+':
+		return a + b
+	case '-':
+		return a - b
+	case '*':
+		return a * b
+	case '/':
+		return a / b
+	default:
+		return math.NaN()
+	}
+}
@@ -0,0 +1,108 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+)
+
+func TestEvaluate(t *testing.T) {
+	gauge := func(id string, v float64) models.Metrics {
+		return models.Metrics{ID: id, MType: models.Gauge, Value: &v}
+	}
+	counter := func(id string, d int64) models.Metrics {
+		return models.Metrics{ID: id, MType: models.Counter, Delta: &d}
+	}
+
+	metrics := []models.Metrics{
+		gauge(`HeapAlloc{host="web-1",dc="a"}`, 10),
+		gauge(`HeapAlloc{host="web-2",dc="a"}`, 30),
+		gauge(`HeapAlloc{host="db-1",dc="b"}`, 100),
+		gauge(`HeapAllocX{host="web-3"}`, 1000),
+		counter(`PollCount{host="web-1"}`, 5),
+		counter(`PollCount{host="web-2"}`, 7),
+		counter(`PollCount`, 1),
+	}
+
+	tests := []struct {
+		expr string
+		want []Sample
+	}{
+		{`sum(PollCount)`, []Sample{{Labels: map[string]string{}, Value: 13, Series: 3}}},
+		{`max(HeapAlloc{host=~"web-.*"})`, []Sample{{Labels: map[string]string{}, Value: 30, Series: 2}}},
+		{`avg(HeapAlloc) by (dc)`, []Sample{
+			{Labels: map[string]string{"dc": "a"}, Value: 20, Series: 2},
+			{Labels: map[string]string{"dc": "b"}, Value: 100, Series: 1},
+		}},
+		{`count by (host) (PollCount{host!="web-2"})`, []Sample{
+			{Labels: map[string]string{"host": ""}, Value: 1, Series: 1},
+			{Labels: map[string]string{"host": "web-1"}, Value: 1, Series: 1},
+		}},
+		{`min(Missing)`, []Sample{}},
+		{`HeapAlloc{dc="a"} / 10 + 1`, []Sample{
+			{Labels: map[string]string{"dc": "a", "host": "web-1"}, Value: 2, Series: 1},
+			{Labels: map[string]string{"dc": "a", "host": "web-2"}, Value: 4, Series: 1},
+		}},
+		{`sum(HeapAlloc) by (host) / sum(PollCount) by (host)`, []Sample{
+			{Labels: map[string]string{"host": "web-1"}, Value: 2, Series: 2},
+			{Labels: map[string]string{"host": "web-2"}, Value: 30.0 / 7, Series: 2},
+		}},
+		{`-(2 * 3)`, []Sample{{Labels: map[string]string{}, Value: -6}}},
+		{`PollCount / 0`, []Sample{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			e, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := Eval(e, memSource(metrics))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+
+			for i := range got {
+				if got[i].Value != tt.want[i].Value || got[i].Series != tt.want[i].Series ||
+					models.SeriesID("", got[i].Labels) != models.SeriesID("", tt.want[i].Labels) {
+					t.Errorf("got %+v, want %+v", got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+type memSource []models.Metrics
+
+func (m memSource) Aggregate(agg Aggregation) ([]Sample, error) {
+	return Evaluate(m, agg), nil
+}
+
+func (m memSource) Select(sel Selector) ([]Sample, error) {
+	return SelectSeries(m, sel), nil
+}
+
+func TestParse_Errors(t *testing.T) {
+	for _, expr := range []string{
+		``,
+		`median(X) by (a)`,
+		`sum(X`,
+		`sum(X{host})`,
+		`sum(X{host="a"`,
+		`sum(X{host=~"("})`,
+		`sum(X) by host`,
+		`sum(X) extra`,
+		`X /`,
+		`(X`,
+		`1.2.3`,
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("%q: expected error", expr)
+		}
+	}
+}
@@ -0,0 +1,461 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/apperrors"
+)
+
+const (
+	AggSum   = "sum"
+	AggAvg   = "avg"
+	AggMin   = "min"
+	AggMax   = "max"
+	AggCount = "count"
+
+	MatchEqual     = "="
+	MatchNotEqual  = "!="
+	MatchRegexp    = "=~"
+	MatchNotRegexp = "!~"
+)
+
+var (
+	ErrBadExpr = apperrors.New(apperrors.ErrValidation, "bad_expression", "bad expression")
+)
+
+// Expr — разобранное выражение. Поддерживаются селекторы серий,
+// агрегации по селектору, числа и арифметика между ними:
+//
+//	sum(PollCount)
+//	max(HeapAlloc{host=~"web-.*"}) by (host)
+//	count by (host) (AgentCollectorUp{collector!="exec"})
+//	HeapInuse / HeapSys * 100
+type Expr interface {
+	expr()
+}
+
+type Aggregation struct {
+	Op       string
+	Selector Selector
+	By       []string
+}
+
+type NumberExpr struct {
+	Value float64
+}
+
+// BinaryExpr — арифметика. Векторы сопоставляются по полному набору меток,
+// число применяется к каждой серии вектора.
+type BinaryExpr struct {
+	Op  byte
+	LHS Expr
+	RHS Expr
+}
+
+func (Aggregation) expr() {}
+func (Selector) expr()    {}
+func (NumberExpr) expr()  {}
+func (BinaryExpr) expr()  {}
+
+type Selector struct {
+	Name     string
+	Matchers []Matcher
+}
+
+type Matcher struct {
+	Label string
+	Op    string
+	Value string
+
+	re *regexp.Regexp
+}
+
+func (m Matcher) Matches(labels map[string]string) bool {
+	v := labels[m.Label]
+
+	switch m.Op {
+	case MatchEqual:
+		return v == m.Value
+	case MatchNotEqual:
+		return v != m.Value
+	case MatchRegexp:
+		return m.re.MatchString(v)
+	case MatchNotRegexp:
+		return !m.re.MatchString(v)
+	default:
+		return false
+	}
+}
+
+func (s Selector) Matches(name string, labels map[string]string) bool {
+	if name != s.Name {
+		return false
+	}
+
+	for _, m := range s.Matchers {
+		if !m.Matches(labels) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func Parse(input string) (Expr, error) {
+	const fn = "query.Parse"
+
+	p := &parser{input: input}
+
+	e, err := p.expr()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %v", fn, ErrBadExpr, err)
+	}
+
+	if p.skipSpaces(); p.pos != len(p.input) {
+		return nil, fmt.Errorf("%s: %w: unexpected %q at %d", fn, ErrBadExpr, p.input[p.pos:], p.pos)
+	}
+
+	return e, nil
+}
+
+type parser struct {
+	input string
+	pos   int
+}
+
+func (p *parser) expr() (Expr, error) {
+	lhs, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op, ok := p.acceptAny("+-")
+		if !ok {
+			return lhs, nil
+		}
+
+		rhs, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+
+		lhs = BinaryExpr{Op: op, LHS: lhs, RHS: rhs}
+	}
+}
+
+func (p *parser) term() (Expr, error) {
+	lhs, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op, ok := p.acceptAny("*/")
+		if !ok {
+			return lhs, nil
+		}
+
+		rhs, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+
+		lhs = BinaryExpr{Op: op, LHS: lhs, RHS: rhs}
+	}
+}
+
+func (p *parser) unary() (Expr, error) {
+	if p.accept('-') {
+		e, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+
+		return BinaryExpr{Op: '*', LHS: NumberExpr{Value: -1}, RHS: e}, nil
+	}
+
+	if p.accept('(') {
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := p.expect(')'); err != nil {
+			return nil, err
+		}
+
+		return e, nil
+	}
+
+	if p.pos < len(p.input) && (p.input[p.pos] >= '0' && p.input[p.pos] <= '9' || p.input[p.pos] == '.') {
+		return p.number()
+	}
+
+	start := p.pos
+
+	switch p.ident() {
+	case AggSum, AggAvg, AggMin, AggMax, AggCount:
+		if p.peek('(') || p.keyword("by") {
+			p.pos = start
+			return p.aggregation()
+		}
+	}
+
+	p.pos = start
+
+	return p.selector()
+}
+
+func (p *parser) number() (Expr, error) {
+	start := p.pos
+
+	for p.pos < len(p.input) && (p.input[p.pos] >= '0' && p.input[p.pos] <= '9' || p.input[p.pos] == '.') {
+		p.pos++
+	}
+
+	if p.pos < len(p.input) && (p.input[p.pos] == 'e' || p.input[p.pos] == 'E') {
+		p.pos++
+		if p.pos < len(p.input) && (p.input[p.pos] == '+' || p.input[p.pos] == '-') {
+			p.pos++
+		}
+		for p.pos < len(p.input) && p.input[p.pos] >= '0' && p.input[p.pos] <= '9' {
+			p.pos++
+		}
+	}
+
+	v, err := strconv.ParseFloat(p.input[start:p.pos], 64)
+	if err != nil {
+		return nil, fmt.Errorf("bad number %q at %d", p.input[start:p.pos], start)
+	}
+
+	return NumberExpr{Value: v}, nil
+}
+
+func (p *parser) aggregation() (Expr, error) {
+	var agg Aggregation
+
+	agg.Op = p.ident()
+
+	if p.keyword("by") {
+		by, err := p.labelList()
+		if err != nil {
+			return nil, err
+		}
+
+		agg.By = by
+	}
+
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+
+	selector, err := p.selector()
+	if err != nil {
+		return nil, err
+	}
+
+	agg.Selector = selector
+
+	if err := p.expect(')'); err != nil {
+		return nil, err
+	}
+
+	if agg.By == nil && p.keyword("by") {
+		by, err := p.labelList()
+		if err != nil {
+			return nil, err
+		}
+
+		agg.By = by
+	}
+
+	return agg, nil
+}
+
+func (p *parser) selector() (Selector, error) {
+	var s Selector
+
+	s.Name = p.ident()
+	if s.Name == "" {
+		return Selector{}, fmt.Errorf("metric name expected at %d", p.pos)
+	}
+
+	if !p.accept('{') {
+		return s, nil
+	}
+
+	for !p.accept('}') {
+		if len(s.Matchers) > 0 {
+			if err := p.expect(','); err != nil {
+				return Selector{}, err
+			}
+		}
+
+		m, err := p.matcher()
+		if err != nil {
+			return Selector{}, err
+		}
+
+		s.Matchers = append(s.Matchers, m)
+	}
+
+	return s, nil
+}
+
+func (p *parser) matcher() (Matcher, error) {
+	var m Matcher
+
+	m.Label = p.ident()
+	if m.Label == "" {
+		return Matcher{}, fmt.Errorf("label name expected at %d", p.pos)
+	}
+
+	p.skipSpaces()
+
+	for _, op := range []string{MatchRegexp, MatchNotRegexp, MatchNotEqual, MatchEqual} {
+		if strings.HasPrefix(p.input[p.pos:], op) {
+			m.Op = op
+			p.pos += len(op)
+			break
+		}
+	}
+
+	if m.Op == "" {
+		return Matcher{}, fmt.Errorf("label matcher expected at %d", p.pos)
+	}
+
+	value, err := p.str()
+	if err != nil {
+		return Matcher{}, err
+	}
+
+	m.Value = value
+
+	if m.Op == MatchRegexp || m.Op == MatchNotRegexp {
+		re, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return Matcher{}, err
+		}
+
+		m.re = re
+	}
+
+	return m, nil
+}
+
+func (p *parser) labelList() ([]string, error) {
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+
+	labels := []string{}
+
+	for !p.accept(')') {
+		if len(labels) > 0 {
+			if err := p.expect(','); err != nil {
+				return nil, err
+			}
+		}
+
+		label := p.ident()
+		if label == "" {
+			return nil, fmt.Errorf("label name expected at %d", p.pos)
+		}
+
+		labels = append(labels, label)
+	}
+
+	return labels, nil
+}
+
+func (p *parser) str() (string, error) {
+	p.skipSpaces()
+
+	if p.pos >= len(p.input) || p.input[p.pos] != '"' {
+		return "", fmt.Errorf("string expected at %d", p.pos)
+	}
+
+	prefix, err := strconv.QuotedPrefix(p.input[p.pos:])
+	if err != nil {
+		return "", fmt.Errorf("bad string at %d: %v", p.pos, err)
+	}
+
+	p.pos += len(prefix)
+
+	return strconv.Unquote(prefix)
+}
+
+func (p *parser) ident() string {
+	p.skipSpaces()
+
+	start := p.pos
+	for p.pos < len(p.input) && isIdentRune(rune(p.input[p.pos])) {
+		p.pos++
+	}
+
+	return p.input[start:p.pos]
+}
+
+// keyword съедает слово, только если оно совпало целиком.
+func (p *parser) keyword(word string) bool {
+	start := p.pos
+
+	if p.ident() == word {
+		return true
+	}
+
+	p.pos = start
+
+	return false
+}
+
+func (p *parser) accept(c byte) bool {
+	p.skipSpaces()
+
+	if p.pos < len(p.input) && p.input[p.pos] == c {
+		p.pos++
+		return true
+	}
+
+	return false
+}
+
+func (p *parser) acceptAny(chars string) (byte, bool) {
+	p.skipSpaces()
+
+	if p.pos < len(p.input) && strings.IndexByte(chars, p.input[p.pos]) >= 0 {
+		p.pos++
+		return p.input[p.pos-1], true
+	}
+
+	return 0, false
+}
+
+func (p *parser) peek(c byte) bool {
+	p.skipSpaces()
+
+	return p.pos < len(p.input) && p.input[p.pos] == c
+}
+
+func (p *parser) expect(c byte) error {
+	if !p.accept(c) {
+		return fmt.Errorf("%q expected at %d", c, p.pos)
+	}
+
+	return nil
+}
+
+func (p *parser) skipSpaces() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || r == ':' || r == '.' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+}
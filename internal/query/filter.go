@@ -0,0 +1,175 @@
+package query
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/apperrors"
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+)
+
+const (
+	SortID        = "id"
+	SortType      = "type"
+	SortUpdatedAt = "updated_at"
+
+	DefaultLimit = 100
+	MaxLimit     = 1000
+
+	// Время в курсоре и ключах сортировки пишется с фиксированной длиной,
+	// чтобы строки сравнивались так же, как моменты времени.
+	timeKeyFormat = "2006-01-02T15:04:05.000000000Z"
+)
+
+var (
+	ErrBadFilter = apperrors.New(apperrors.ErrValidation, "bad_filter", "bad filter")
+	ErrBadCursor = apperrors.New(apperrors.ErrValidation, "bad_cursor", "bad cursor")
+)
+
+// Filter описывает выборку для листинга метрик. Sort — одно из полей
+// SortID, SortType, SortUpdatedAt, с префиксом "-" для обратного порядка.
+type Filter struct {
+	Type   string
+	Prefix string
+	Match  string
+	Sort   string
+	Limit  int
+	Cursor string
+}
+
+type Page struct {
+	Metrics    []models.Metrics `json:"metrics"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+// Cursor — позиция последней отданной метрики в порядке сортировки.
+type Cursor struct {
+	Sort      string    `json:"s"`
+	ID        string    `json:"i"`
+	Type      string    `json:"t"`
+	UpdatedAt time.Time `json:"u,omitempty"`
+}
+
+func ParseFilter(values url.Values) (Filter, error) {
+	const fn = "query.ParseFilter"
+
+	f := Filter{
+		Type:   values.Get("type"),
+		Prefix: values.Get("prefix"),
+		Match:  values.Get("match"),
+		Sort:   values.Get("sort"),
+		Cursor: values.Get("cursor"),
+		Limit:  DefaultLimit,
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return Filter{}, fmt.Errorf("%s: %w: limit %q", fn, ErrBadFilter, limit)
+		}
+
+		f.Limit = n
+	}
+
+	if err := f.Validate(); err != nil {
+		return Filter{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return f, nil
+}
+
+func (f *Filter) Validate() error {
+	if f.Limit <= 0 {
+		f.Limit = DefaultLimit
+	}
+
+	if f.Limit > MaxLimit {
+		f.Limit = MaxLimit
+	}
+
+	if f.Sort == "" {
+		f.Sort = SortID
+	}
+
+	switch f.Field() {
+	case SortID, SortType, SortUpdatedAt:
+	default:
+		return fmt.Errorf("%w: sort %q", ErrBadFilter, f.Sort)
+	}
+
+	if f.Type != "" && f.Type != models.Gauge && f.Type != models.Counter {
+		return fmt.Errorf("%w: type %q", ErrBadFilter, f.Type)
+	}
+
+	if _, err := regexp.Compile(f.Match); err != nil {
+		return fmt.Errorf("%w: match: %v", ErrBadFilter, err)
+	}
+
+	if _, err := f.DecodeCursor(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (f Filter) Field() string {
+	return strings.TrimPrefix(f.Sort, "-")
+}
+
+func (f Filter) Desc() bool {
+	return strings.HasPrefix(f.Sort, "-")
+}
+
+// DecodeCursor возвращает nil, если курсора нет. Курсор от другой
+// сортировки считается ошибкой: продолжить по нему выдачу нельзя.
+func (f Filter) DecodeCursor() (*Cursor, error) {
+	if f.Cursor == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(f.Cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadCursor, err)
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadCursor, err)
+	}
+
+	if c.Sort != f.Sort {
+		return nil, fmt.Errorf("%w: cursor is for sort %q", ErrBadCursor, c.Sort)
+	}
+
+	return &c, nil
+}
+
+func (f Filter) EncodeCursor(m models.Metrics) string {
+	c := Cursor{
+		Sort: f.Sort,
+		ID:   m.ID,
+		Type: m.MType,
+	}
+
+	if f.Field() == SortUpdatedAt {
+		c.UpdatedAt = updatedAt(m)
+	}
+
+	data, _ := json.Marshal(c)
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func updatedAt(m models.Metrics) time.Time {
+	if m.UpdatedAt == nil {
+		return time.Time{}
+	}
+
+	return m.UpdatedAt.UTC()
+}
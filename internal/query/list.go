@@ -0,0 +1,85 @@
+package query
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+)
+
+// List применяет фильтр к уже загруженным метрикам. Используется хранилищами,
+// которые не умеют фильтровать сами и отдают всё через Dump.
+func List(metrics []models.Metrics, f Filter) (Page, error) {
+	if err := f.Validate(); err != nil {
+		return Page{}, err
+	}
+
+	cursor, _ := f.DecodeCursor()
+	re := regexp.MustCompile(f.Match)
+
+	var afterKey []string
+	if cursor != nil {
+		afterKey = sortKey(f.Field(), models.Metrics{ID: cursor.ID, MType: cursor.Type, UpdatedAt: &cursor.UpdatedAt})
+	}
+
+	type keyed struct {
+		key []string
+		m   models.Metrics
+	}
+
+	selected := make([]keyed, 0, len(metrics))
+
+	for _, m := range metrics {
+		if f.Type != "" && m.MType != f.Type {
+			continue
+		}
+
+		if !strings.HasPrefix(m.ID, f.Prefix) || !re.MatchString(m.ID) {
+			continue
+		}
+
+		key := sortKey(f.Field(), m)
+
+		if afterKey != nil {
+			cmp := slices.Compare(key, afterKey)
+			if (!f.Desc() && cmp <= 0) || (f.Desc() && cmp >= 0) {
+				continue
+			}
+		}
+
+		selected = append(selected, keyed{key: key, m: m})
+	}
+
+	slices.SortFunc(selected, func(a, b keyed) int {
+		if f.Desc() {
+			return slices.Compare(b.key, a.key)
+		}
+
+		return slices.Compare(a.key, b.key)
+	})
+
+	page := Page{Metrics: make([]models.Metrics, 0, min(len(selected), f.Limit))}
+
+	for i, k := range selected {
+		if i == f.Limit {
+			page.NextCursor = f.EncodeCursor(page.Metrics[len(page.Metrics)-1])
+			break
+		}
+
+		page.Metrics = append(page.Metrics, k.m)
+	}
+
+	return page, nil
+}
+
+func sortKey(field string, m models.Metrics) []string {
+	switch field {
+	case SortType:
+		return []string{m.MType, m.ID}
+	case SortUpdatedAt:
+		return []string{updatedAt(m).Format(timeKeyFormat), m.MType, m.ID}
+	default:
+		return []string{m.ID, m.MType}
+	}
+}
@@ -0,0 +1,66 @@
+package query
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+)
+
+func TestList_Pagination(t *testing.T) {
+	now := time.Now()
+	value := 1.0
+
+	var metrics []models.Metrics
+	for i, id := range []string{"HeapAlloc", "Alloc", "HeapSys", "PollCount", "HeapIdle"} {
+		updated := now.Add(time.Duration(i) * time.Second)
+		metrics = append(metrics, models.Metrics{ID: id, MType: models.Gauge, Value: &value, UpdatedAt: &updated})
+	}
+
+	f, err := ParseFilter(url.Values{"prefix": {"Heap"}, "sort": {"-id"}, "limit": {"2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+
+	for {
+		page, err := List(metrics, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, m := range page.Metrics {
+			got = append(got, m.ID)
+		}
+
+		if page.NextCursor == "" {
+			break
+		}
+
+		f.Cursor = page.NextCursor
+	}
+
+	want := []string{"HeapSys", "HeapIdle", "HeapAlloc"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+
+	f = Filter{Sort: SortUpdatedAt, Match: "Alloc$", Cursor: f.Cursor}
+	if _, err := List(metrics, f); !errors.Is(err, ErrBadCursor) {
+		t.Fatalf("cursor from another sort must be rejected, got %v", err)
+	}
+
+	page, err := List(metrics, Filter{Sort: SortUpdatedAt, Match: "Alloc$"})
+	if err != nil || len(page.Metrics) != 2 || page.Metrics[0].ID != "HeapAlloc" {
+		t.Fatalf("got %+v, %v", page, err)
+	}
+}
@@ -0,0 +1,78 @@
+package query
+
+import (
+	"time"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+)
+
+type Rate struct {
+	Increase float64 `json:"increase"`
+	Rate     float64 `json:"rate"`
+	Samples  int     `json:"samples"`
+}
+
+// ComputeRate считает прирост counter'а за окно [now-window, now] и скорость
+// в секунду. points должны идти по времени. Последняя точка до начала окна
+// служит базой: прирост от неё до первой точки в окне считается равномерным,
+// и в результат идёт только его доля, пришедшаяся на окно. Скорость — прирост,
+// делённый на покрытую точками часть окна. Уменьшение значения считается
+// сбросом: после него прирост отсчитывается от нуля.
+func ComputeRate(points []models.Point, window time.Duration, now time.Time) (Rate, bool) {
+	start := now.Add(-window)
+
+	var (
+		res     Rate
+		prev    *models.Point
+		first   time.Time
+		covered bool
+	)
+
+	for i := range points {
+		p := points[i]
+
+		if p.Time.After(now) {
+			break
+		}
+
+		if p.Time.Before(start) {
+			prev = &points[i]
+			continue
+		}
+
+		res.Samples++
+
+		if prev == nil {
+			first = p.Time
+			prev = &points[i]
+			covered = true
+			continue
+		}
+
+		increase := p.Value
+		if p.Value >= prev.Value {
+			increase = p.Value - prev.Value
+		}
+
+		if !covered {
+			// Отрезок от базы начался до окна: берём только его часть в окне.
+			increase *= p.Time.Sub(start).Seconds() / p.Time.Sub(prev.Time).Seconds()
+			first = start
+			covered = true
+		}
+
+		res.Increase += increase
+		prev = &points[i]
+	}
+
+	// Точки есть только до окна: counter за окно не менялся.
+	if !covered {
+		return Rate{}, prev != nil
+	}
+
+	if span := prev.Time.Sub(first).Seconds(); span > 0 {
+		res.Rate = res.Increase / span
+	}
+
+	return res, true
+}
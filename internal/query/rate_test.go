@@ -0,0 +1,41 @@
+package query
+
+import (
+	"testing"
+	"time"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+)
+
+func TestComputeRate(t *testing.T) {
+	now := time.Now()
+	at := func(sec int, v float64) models.Point {
+		return models.Point{Time: now.Add(time.Duration(sec) * time.Second), Value: v}
+	}
+
+	tests := []struct {
+		name     string
+		points   []models.Point
+		increase float64
+		rate     float64
+		ok       bool
+	}{
+		{name: "empty"},
+		// От базы до первой точки в окне +10 за 40s, из них в окне 10s.
+		{name: "baseline before window", points: []models.Point{at(-90, 10), at(-50, 20), at(-10, 60)}, increase: 42.5, rate: 42.5 / 50, ok: true},
+		{name: "old baseline", points: []models.Point{at(-3000, 0), at(-30, 99), at(-10, 109)}, increase: 1 + 10, rate: 11.0 / 50, ok: true},
+		{name: "reset after baseline", points: []models.Point{at(-120, 50), at(0, 8)}, increase: 4, rate: 4.0 / 60, ok: true},
+		{name: "counter reset", points: []models.Point{at(-50, 100), at(-30, 120), at(-20, 5), at(-10, 15)}, increase: 35, rate: 35.0 / 40, ok: true},
+		{name: "single point", points: []models.Point{at(-5, 7)}, ok: true},
+		{name: "no updates in window", points: []models.Point{at(-300, 7)}, ok: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ComputeRate(tt.points, time.Minute, now)
+			if ok != tt.ok || got.Increase != tt.increase || got.Rate != tt.rate {
+				t.Errorf("got %+v %v, want increase %v rate %v %v", got, ok, tt.increase, tt.rate, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package recording
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	config "github.com/BeInBloom/spanish-inquisition/internal/config/server-config"
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+	"github.com/BeInBloom/spanish-inquisition/internal/query"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultInterval = 30 * time.Second
+)
+
+var (
+	ErrBadRule = errors.New("bad recording rule")
+)
+
+// Rule записывает результат Expr как gauge с именем Record. Метки
+// результата (например, из by (...)) попадают в ID записанной серии.
+type Rule struct {
+	Record string `yaml:"record" json:"record"`
+	Expr   string `yaml:"expr" json:"expr"`
+}
+
+type saver interface {
+	CreateOrUpdate(models.Metrics) error
+}
+
+type compiledRule struct {
+	record string
+	expr   query.Expr
+}
+
+// recorder периодически считает правила по хранилищу и пишет результаты
+// обратно через CreateOrUpdate, поэтому они видны во всех ручках чтения.
+type recorder struct {
+	src      query.Source
+	writer   saver
+	rules    []compiledRule
+	interval time.Duration
+}
+
+func New(ctx context.Context, cfg config.RecordingConfig, src query.Source, writer saver) (*recorder, error) {
+	const fn = "recording.New"
+
+	r := &recorder{
+		src:      src,
+		writer:   writer,
+		interval: cfg.Interval,
+	}
+
+	if r.interval <= 0 {
+		r.interval = defaultInterval
+	}
+
+	if cfg.RulesPath == "" {
+		return r, nil
+	}
+
+	rules, err := readRules(cfg.RulesPath)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn, err)
+	}
+
+	r.rules, err = compile(rules)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	if len(r.rules) > 0 {
+		go r.run(ctx)
+	}
+
+	return r, nil
+}
+
+func (r *recorder) run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.evaluate(); err != nil {
+				fmt.Printf("recording rules error: %v\n", err)
+			}
+		}
+	}
+}
+
+// evaluate считает все правила; ошибка одного правила не мешает остальным.
+func (r *recorder) evaluate() error {
+	var errs []error
+
+	for _, rule := range r.rules {
+		samples, err := query.Eval(rule.expr, r.src)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", rule.record, err))
+			continue
+		}
+
+		for _, s := range samples {
+			value := s.Value
+
+			m := models.Metrics{
+				ID:    models.SeriesID(rule.record, nonEmpty(s.Labels)),
+				MType: models.Gauge,
+				Value: &value,
+			}
+
+			if err := r.writer.CreateOrUpdate(m); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", m.ID, err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func compile(rules []Rule) ([]compiledRule, error) {
+	compiled := make([]compiledRule, 0, len(rules))
+
+	for _, rule := range rules {
+		if rule.Record == "" {
+			return nil, fmt.Errorf("%w: empty record name", ErrBadRule)
+		}
+
+		if strings.ContainsAny(rule.Record, "{}\", \t\n") {
+			return nil, fmt.Errorf("%w: record name %q must not have labels", ErrBadRule, rule.Record)
+		}
+
+		e, err := query.Parse(rule.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrBadRule, rule.Record, err)
+		}
+
+		compiled = append(compiled, compiledRule{record: rule.Record, expr: e})
+	}
+
+	return compiled, nil
+}
+
+// nonEmpty убирает пустые метки: отсутствующая метка в by (...) даёт "".
+func nonEmpty(labels map[string]string) map[string]string {
+	res := make(map[string]string, len(labels))
+
+	for k, v := range labels {
+		if v != "" {
+			res[k] = v
+		}
+	}
+
+	return res
+}
+
+func readRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Rules []Rule `yaml:"rules"`
+	}
+
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	return file.Rules, nil
+}
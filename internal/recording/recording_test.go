@@ -0,0 +1,75 @@
+package recording
+
+import (
+	"testing"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+	"github.com/BeInBloom/spanish-inquisition/internal/query"
+)
+
+type memRepo struct {
+	data map[string]models.Metrics
+}
+
+func (r *memRepo) CreateOrUpdate(m models.Metrics) error {
+	r.data[m.ID] = m
+	return nil
+}
+
+func (r *memRepo) dump() []models.Metrics {
+	var res []models.Metrics
+	for _, m := range r.data {
+		res = append(res, m)
+	}
+
+	return res
+}
+
+func (r *memRepo) Aggregate(agg query.Aggregation) ([]query.Sample, error) {
+	return query.Evaluate(r.dump(), agg), nil
+}
+
+func (r *memRepo) Select(sel query.Selector) ([]query.Sample, error) {
+	return query.SelectSeries(r.dump(), sel), nil
+}
+
+func TestRecorder_Evaluate(t *testing.T) {
+	gauge := func(v float64) *float64 { return &v }
+
+	repo := &memRepo{data: map[string]models.Metrics{
+		`HeapInuse{host="a"}`: {ID: `HeapInuse{host="a"}`, MType: models.Gauge, Value: gauge(25)},
+		`HeapSys{host="a"}`:   {ID: `HeapSys{host="a"}`, MType: models.Gauge, Value: gauge(100)},
+		`HeapInuse{host="b"}`: {ID: `HeapInuse{host="b"}`, MType: models.Gauge, Value: gauge(5)},
+		`HeapSys{host="b"}`:   {ID: `HeapSys{host="b"}`, MType: models.Gauge, Value: gauge(0)},
+	}}
+
+	rules, err := compile([]Rule{
+		{Record: "heap_utilization", Expr: "HeapInuse / HeapSys"},
+		{Record: "heap_total", Expr: "sum(HeapSys)"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &recorder{src: repo, writer: repo, rules: rules}
+	if err := r.evaluate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for id, want := range map[string]float64{`heap_utilization{host="a"}`: 0.25, `heap_total`: 100} {
+		m, ok := repo.data[id]
+		if !ok || m.MType != models.Gauge || *m.Value != want {
+			t.Errorf("%s: got %+v, want gauge %v", id, m, want)
+		}
+	}
+
+	if _, ok := repo.data[`heap_utilization{host="b"}`]; ok {
+		t.Error("division by zero must not be recorded")
+	}
+
+	for _, bad := range []Rule{{Expr: "X"}, {Record: `x{a="b"}`, Expr: "X"}, {Record: "x", Expr: "sum("}} {
+		if _, err := compile([]Rule{bad}); err == nil {
+			t.Errorf("%+v: expected error", bad)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package relabel
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+)
+
+const (
+	ActionKeep   = "keep"
+	ActionDrop   = "drop"
+	ActionRename = "rename"
+	ActionLabel  = "label"
+	ActionPrefix = "prefix"
+	ActionCoerce = "coerce"
+	ActionReject = "reject"
+)
+
+type Verdict int
+
+const (
+	Kept Verdict = iota
+	Dropped
+	Rejected
+)
+
+var (
+	ErrUnknownAction = errors.New("unknown relabel action")
+	ErrBadRule       = errors.New("bad relabel rule")
+)
+
+// Rule — правило в том виде, в каком оно пришло из конфига. Поля те же,
+// что у правил в конфигах агента и сервера, поэтому те приводятся
+// к Rule простым преобразованием типа. Описание действий — там же.
+type Rule struct {
+	Action      string
+	Match       string
+	Type        string
+	Replacement string
+	Labels      map[string]string
+	To          string
+}
+
+type rule struct {
+	action      string
+	match       *regexp.Regexp
+	mType       string
+	replacement string
+	labels      map[string]string
+}
+
+type pipeline struct {
+	rules []rule
+}
+
+func New(rules []Rule) (*pipeline, error) {
+	const fn = "relabel.New"
+
+	compiled := make([]rule, 0, len(rules))
+
+	for i, r := range rules {
+		c, err := compile(r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: rule %d: %w", fn, i, err)
+		}
+
+		compiled = append(compiled, c)
+	}
+
+	return &pipeline{rules: compiled}, nil
+}
+
+// Apply прогоняет метрики через правила по порядку и возвращает то, что осталось.
+func (p *pipeline) Apply(metrics []models.Metrics) []models.Metrics {
+	if len(p.rules) == 0 {
+		return metrics
+	}
+
+	result := make([]models.Metrics, 0, len(metrics))
+
+	for _, m := range metrics {
+		if m, verdict := p.Relabel(m); verdict == Kept {
+			result = append(result, m)
+		}
+	}
+
+	return result
+}
+
+// Relabel прогоняет через правила одну метрику и сообщает, что с ней решили.
+func (p *pipeline) Relabel(m models.Metrics) (models.Metrics, Verdict) {
+	if len(p.rules) == 0 {
+		return m, Kept
+	}
+
+	name, labels := models.ParseSeriesID(m.ID)
+
+	for _, r := range p.rules {
+		matched := r.matches(name, m.MType)
+
+		switch r.action {
+		case ActionKeep:
+			if !matched {
+				return models.Metrics{}, Dropped
+			}
+		case ActionDrop:
+			if matched {
+				return models.Metrics{}, Dropped
+			}
+		case ActionReject:
+			if matched {
+				return models.Metrics{}, Rejected
+			}
+		case ActionRename:
+			if matched {
+				name = r.match.ReplaceAllString(name, r.replacement)
+			}
+		case ActionPrefix:
+			if matched {
+				name = r.replacement + name
+			}
+		case ActionLabel:
+			if matched {
+				if labels == nil {
+					labels = make(map[string]string, len(r.labels))
+				}
+				maps.Copy(labels, r.labels)
+			}
+		case ActionCoerce:
+			if matched {
+				m = coerce(m)
+			}
+		}
+	}
+
+	m.ID = models.SeriesID(name, labels)
+
+	return m, Kept
+}
+
+func (r rule) matches(name, mType string) bool {
+	if r.mType != "" && r.mType != mType {
+		return false
+	}
+
+	return r.match.MatchString(name)
+}
+
+func compile(r Rule) (rule, error) {
+	match := r.Match
+	if match == "" {
+		match = ".*"
+	}
+
+	re, err := regexp.Compile("^(?:" + match + ")$")
+	if err != nil {
+		return rule{}, err
+	}
+
+	c := rule{
+		action:      r.Action,
+		match:       re,
+		mType:       r.Type,
+		replacement: r.Replacement,
+	}
+
+	if r.Type != "" && r.Type != models.Gauge && r.Type != models.Counter {
+		return rule{}, fmt.Errorf("%w: type %q", ErrBadRule, r.Type)
+	}
+
+	switch r.Action {
+	case ActionKeep, ActionDrop, ActionReject:
+	case ActionRename, ActionPrefix:
+		if r.Replacement == "" {
+			return rule{}, fmt.Errorf("%w: %s needs replacement", ErrBadRule, r.Action)
+		}
+
+		// В rename доллар занят группами регулярного выражения.
+		if r.Action == ActionPrefix {
+			c.replacement = expand(r.Replacement)
+		}
+	case ActionLabel:
+		if len(r.Labels) == 0 {
+			return rule{}, fmt.Errorf("%w: label needs labels", ErrBadRule)
+		}
+
+		c.labels = make(map[string]string, len(r.Labels))
+		for k, v := range r.Labels {
+			c.labels[k] = expand(v)
+		}
+	case ActionCoerce:
+		// Gauge — абсолютное значение, а counter сервер складывает, так что
+		// gauge, переделанный в counter, рос бы на своё значение с каждой записью.
+		if r.To != models.Gauge {
+			return rule{}, fmt.Errorf("%w: coerce to %q, only gauge is supported", ErrBadRule, r.To)
+		}
+	default:
+		return rule{}, fmt.Errorf("%w: %q", ErrUnknownAction, r.Action)
+	}
+
+	return c, nil
+}
+
+// coerce делает из counter'а gauge: присланная дельта становится значением.
+func coerce(m models.Metrics) models.Metrics {
+	if m.MType != models.Counter || m.Delta == nil {
+		return m
+	}
+
+	value := float64(*m.Delta)
+
+	return models.Metrics{ID: m.ID, MType: models.Gauge, Value: &value}
+}
+
+func expand(s string) string {
+	return os.Expand(s, func(key string) string {
+		if v, ok := os.LookupEnv(key); ok {
+			return v
+		}
+
+		if key == "HOSTNAME" {
+			host, err := os.Hostname()
+			if err == nil {
+				return host
+			}
+		}
+
+		return ""
+	})
+}
@@ -0,0 +1,76 @@
+package relabel
+
+import (
+	"testing"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+)
+
+func TestPipeline_Apply(t *testing.T) {
+	t.Setenv("HOSTNAME", "web-1")
+
+	p, err := New([]Rule{
+		{Action: ActionDrop, Match: "Heap.*"},
+		{Action: ActionKeep, Match: "Alloc|PollCount|Net.*"},
+		{Action: ActionRename, Match: "Net(.*)", Replacement: "network_$1"},
+		{Action: ActionCoerce, Match: "PollCount", To: models.Gauge},
+		{Action: ActionLabel, Labels: map[string]string{"host": "$HOSTNAME"}},
+		{Action: ActionPrefix, Match: "Alloc", Type: models.Gauge, Replacement: "team_"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	heapAlloc, alloc, sys := 1.0, 2.0, 3.0
+	pollCount, bytesSent := int64(4), int64(5)
+
+	got := p.Apply([]models.Metrics{
+		{ID: "HeapAlloc", MType: models.Gauge, Value: &heapAlloc},
+		{ID: "Alloc", MType: models.Gauge, Value: &alloc},
+		{ID: "Sys", MType: models.Gauge, Value: &sys},
+		{ID: "PollCount", MType: models.Counter, Delta: &pollCount},
+		{ID: `NetBytesSent{interface="eth0"}`, MType: models.Counter, Delta: &bytesSent},
+	})
+
+	want := map[string]string{
+		`team_Alloc{host="web-1"}`:                         models.Gauge,
+		`PollCount{host="web-1"}`:                          models.Gauge,
+		`network_BytesSent{host="web-1",interface="eth0"}`: models.Counter,
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d metrics, want %d: %+v", len(got), len(want), got)
+	}
+
+	for _, m := range got {
+		mType, ok := want[m.ID]
+		if !ok {
+			t.Errorf("unexpected metric %s", m.ID)
+			continue
+		}
+
+		if m.MType != mType {
+			t.Errorf("%s: type %s, want %s", m.ID, m.MType, mType)
+		}
+
+		if m.ID == `PollCount{host="web-1"}` && (m.Value == nil || *m.Value != 4) {
+			t.Errorf("%s: coerced value %+v, want 4", m.ID, m.Value)
+		}
+	}
+}
+
+func TestNew_BadRules(t *testing.T) {
+	for _, r := range []Rule{
+		{Action: "explode"},
+		{Action: ActionKeep, Match: "("},
+		{Action: ActionRename, Match: "X"},
+		{Action: ActionLabel},
+		{Action: ActionCoerce, To: "histogram"},
+		{Action: ActionCoerce, To: models.Counter},
+		{Action: ActionDrop, Type: "histogram"},
+	} {
+		if _, err := New([]Rule{r}); err == nil {
+			t.Errorf("%+v: expected error", r)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package replication
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	OplogPath = "/replication/oplog"
+
+	reconnectDelay = time.Second
+	// Без heartbeat'а дольше этого соединение считается мёртвым.
+	readTimeout = 3 * heartbeat
+	maxLineSize = 64 << 20
+)
+
+// follower читает журнал primary и применяет его к локальному хранилищу.
+// При обрыве переподключается с последнего применённого Seq.
+type follower struct {
+	primary string
+	target  applier
+	client  *http.Client
+
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mutex       sync.Mutex
+	log         string
+	seq         uint64
+	primarySeq  uint64
+	connected   bool
+	lastContact time.Time
+	caughtUp    time.Time
+}
+
+// primaryURL разбирает адрес primary: host:port считается http,
+// у URL'а схема сохраняется, но допускаются только http и https.
+func primaryURL(raw string) (string, error) {
+	addr := raw
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+
+	u, err := url.Parse(addr)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("%w: %q", ErrBadPrimary, raw)
+	}
+
+	return strings.TrimSuffix(u.String(), "/"), nil
+}
+
+func newFollower(primary string, target applier) *follower {
+	return &follower{
+		primary:  primary,
+		target:   target,
+		client:   &http.Client{},
+		done:     make(chan struct{}),
+		caughtUp: time.Now(),
+	}
+}
+
+func (f *follower) start(ctx context.Context) {
+	ctx, f.cancel = context.WithCancel(ctx)
+
+	go f.run(ctx)
+}
+
+func (f *follower) run(ctx context.Context) {
+	defer close(f.done)
+
+	for {
+		err := f.stream(ctx)
+
+		f.mutex.Lock()
+		f.connected = false
+		f.mutex.Unlock()
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		fmt.Printf("replication: stream from %s broken: %v\n", f.primary, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+// stop останавливает чтение и ждёт, пока последняя операция применится.
+func (f *follower) stop() {
+	f.cancel()
+	<-f.done
+}
+
+func (f *follower) stream(ctx context.Context) error {
+	f.mutex.Lock()
+	params := url.Values{}
+	params.Set("log", f.log)
+	params.Set("after", strconv.FormatUint(f.seq, 10))
+	f.mutex.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.primary+OplogPath+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	// Если primary замолчал и даже heartbeat'ов нет, рвём соединение сами.
+	watchdog := time.AfterFunc(readTimeout, cancel)
+	defer watchdog.Stop()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+
+	for scanner.Scan() {
+		watchdog.Reset(readTimeout)
+
+		var op Op
+		if err := json.Unmarshal(scanner.Bytes(), &op); err != nil {
+			return err
+		}
+
+		if err := f.apply(op); err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return errors.New("stream closed by primary")
+}
+
+func (f *follower) apply(op Op) error {
+	var err error
+
+	switch op.Kind {
+	case OpSnapshot:
+		err = f.target.Replace(op.Metrics)
+	case OpSet:
+		if op.Metric != nil {
+			err = f.target.Load(*op.Metric)
+		}
+	case OpDelete:
+		if op.Metric != nil {
+			err = f.target.Drop(*op.Metric)
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.connected = true
+	f.lastContact = now
+
+	switch op.Kind {
+	case OpSnapshot:
+		f.log = op.Log
+		f.seq = op.Seq
+		f.primarySeq = op.Seq
+	case OpHeartbeat:
+		f.primarySeq = op.Seq
+	default:
+		f.seq = op.Seq
+		if op.Seq > f.primarySeq {
+			f.primarySeq = op.Seq
+		}
+	}
+
+	if f.seq >= f.primarySeq {
+		f.caughtUp = now
+	}
+
+	return nil
+}
+
+func (f *follower) status() Status {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	s := Status{
+		Role:       RoleSecondary,
+		Log:        f.log,
+		Seq:        f.seq,
+		Primary:    f.primary,
+		PrimarySeq: f.primarySeq,
+		Connected:  f.connected,
+	}
+
+	if f.primarySeq > f.seq {
+		s.LagOps = f.primarySeq - f.seq
+	}
+
+	if s.LagOps > 0 || !f.connected {
+		s.LagSeconds = time.Since(f.caughtUp).Seconds()
+	}
+
+	if !f.lastContact.IsZero() {
+		lastContact := f.lastContact
+		s.LastContact = &lastContact
+	}
+
+	return s
+}
@@ -0,0 +1,27 @@
+package replication
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPrimaryURL(t *testing.T) {
+	tests := []struct {
+		primary string
+		want    string
+		wantErr error
+	}{
+		{primary: "primary:8080", want: "http://primary:8080"},
+		{primary: "http://primary:8080/", want: "http://primary:8080"},
+		{primary: "https://primary.example.com", want: "https://primary.example.com"},
+		{primary: "ws://primary:8080", wantErr: ErrBadPrimary},
+		{primary: "http://", wantErr: ErrBadPrimary},
+	}
+
+	for _, tt := range tests {
+		got, err := primaryURL(tt.primary)
+		if !errors.Is(err, tt.wantErr) || got != tt.want {
+			t.Errorf("primaryURL(%q): got %q, %v, want %q, %v", tt.primary, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
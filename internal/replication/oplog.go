@@ -0,0 +1,100 @@
+package replication
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+)
+
+const (
+	OpSet       = "set"
+	OpDelete    = "delete"
+	OpSnapshot  = "snapshot"
+	OpHeartbeat = "heartbeat"
+)
+
+// Op — строка журнала. set несёт итоговое состояние серии, а не присланный
+// прирост, поэтому повторное применение ничего не ломает. snapshot заменяет
+// всё состояние реплики, heartbeat только сообщает текущий Seq primary.
+// Log меняется при каждом запуске primary: по нему реплика понимает,
+// что её Seq относится к другому журналу.
+type Op struct {
+	Seq     uint64           `json:"seq"`
+	Kind    string           `json:"kind"`
+	Time    time.Time        `json:"time"`
+	Log     string           `json:"log,omitempty"`
+	Metric  *models.Metrics  `json:"metric,omitempty"`
+	Metrics []models.Metrics `json:"metrics,omitempty"`
+}
+
+// oplog держит последние size операций в памяти.
+type oplog struct {
+	id   string
+	size int
+
+	mutex   sync.Mutex
+	ops     []Op
+	head    uint64
+	updated chan struct{}
+}
+
+func newOplog(size int, head uint64) *oplog {
+	return &oplog{
+		id:      newLogID(),
+		size:    size,
+		head:    head,
+		updated: make(chan struct{}),
+	}
+}
+
+func (l *oplog) append(kind string, metric models.Metrics) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.head++
+	l.ops = append(l.ops, Op{Seq: l.head, Kind: kind, Time: time.Now(), Metric: &metric})
+
+	if len(l.ops) > l.size {
+		l.ops = l.ops[len(l.ops)-l.size:]
+	}
+
+	close(l.updated)
+	l.updated = make(chan struct{})
+}
+
+// since возвращает операции после after и канал, который закроется
+// при следующей записи. ok == false, если этих операций в журнале уже нет.
+func (l *oplog) since(after uint64) ([]Op, <-chan struct{}, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if after > l.head {
+		return nil, nil, false
+	}
+
+	first := l.head - uint64(len(l.ops)) + 1
+	if after+1 < first {
+		return nil, nil, false
+	}
+
+	ops := append([]Op(nil), l.ops[after+1-first:]...)
+
+	return ops, l.updated, true
+}
+
+func (l *oplog) seq() uint64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.head
+}
+
+func newLogID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,411 @@
+package replication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/apperrors"
+	config "github.com/BeInBloom/spanish-inquisition/internal/config/server-config"
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+	"github.com/BeInBloom/spanish-inquisition/internal/query"
+)
+
+const (
+	RoleStandalone = "standalone"
+	RolePrimary    = "primary"
+	RoleSecondary  = "secondary"
+
+	defaultLogSize = 10000
+	heartbeat      = 5 * time.Second
+)
+
+var (
+	ErrUnknownRole   = errors.New("unknown replication role")
+	ErrNoPrimary     = errors.New("primary address is not set")
+	ErrBadPrimary    = errors.New("primary must be host:port or an http(s) URL")
+	ErrNotApplicable = errors.New("storage does not support replication")
+	ErrReadOnly      = apperrors.New(apperrors.ErrUnavailable, "read_only", "node is a passive secondary")
+	ErrNotPrimary    = apperrors.New(apperrors.ErrConflict, "not_primary", "node is not a primary")
+	ErrNotSecondary  = apperrors.New(apperrors.ErrConflict, "not_secondary", "node is not a secondary")
+)
+
+type repository interface {
+	CreateOrUpdate(models.Metrics) error
+	Get(models.Metrics) (models.Metrics, error)
+	Dump() ([]models.Metrics, error)
+	List(query.Filter) (query.Page, error)
+	Aggregate(query.Aggregation) ([]query.Sample, error)
+	Select(query.Selector) ([]query.Sample, error)
+	History(item models.Metrics, since time.Time) ([]models.Point, error)
+	Check() error
+	Delete(models.Metrics) error
+	Reset(models.Metrics) error
+	MarkStale(before time.Time) (int, error)
+	DeleteStale(before time.Time) (int, error)
+	Init(context.Context) error
+	Close() error
+}
+
+// applier — хранилище, в которое secondary кладёт состояние с primary.
+type applier interface {
+	Load(models.Metrics) error
+	Replace([]models.Metrics) error
+	Drop(models.Metrics) error
+}
+
+// Status отдаётся ручкой /replication/status. Lag — сколько времени реплика
+// не догоняла primary; у primary и standalone он всегда нулевой.
+type Status struct {
+	Role        string     `json:"role"`
+	Log         string     `json:"log,omitempty"`
+	Seq         uint64     `json:"seq"`
+	Primary     string     `json:"primary,omitempty"`
+	PrimarySeq  uint64     `json:"primary_seq,omitempty"`
+	LagOps      uint64     `json:"lag_ops"`
+	LagSeconds  float64    `json:"lag_seconds"`
+	Connected   bool       `json:"connected"`
+	LastContact *time.Time `json:"last_contact,omitempty"`
+}
+
+// node оборачивает репозиторий. На primary каждая изменяющая операция
+// под общим мьютексом пишется в repo и в журнал, чтобы снимок и журнал
+// не разъезжались. Passive secondary отказывает в записи и применяет
+// журнал primary, пока его не повысят.
+type node struct {
+	repository
+
+	cfg config.ReplicationConfig
+
+	// mutex защищает role, log и запись в repo на primary.
+	mutex sync.Mutex
+	role  string
+	log   *oplog
+
+	follower *follower
+}
+
+func New(ctx context.Context, cfg config.ReplicationConfig, repo repository) (*node, error) {
+	const fn = "replication.New"
+
+	if cfg.LogSize <= 0 {
+		cfg.LogSize = defaultLogSize
+	}
+
+	n := &node{
+		repository: repo,
+		cfg:        cfg,
+	}
+
+	switch cfg.Role {
+	case "", RoleStandalone:
+		n.role = RoleStandalone
+	case RolePrimary:
+		n.role = RolePrimary
+		n.log = newOplog(cfg.LogSize, 0)
+	case RoleSecondary:
+		if cfg.Primary == "" {
+			return nil, fmt.Errorf("%s: %w", fn, ErrNoPrimary)
+		}
+
+		primary, err := primaryURL(cfg.Primary)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fn, err)
+		}
+
+		target, ok := repo.(applier)
+		if !ok {
+			return nil, fmt.Errorf("%s: %w", fn, ErrNotApplicable)
+		}
+
+		n.role = RoleSecondary
+		n.follower = newFollower(primary, target)
+
+		n.follower.start(ctx)
+	default:
+		return nil, fmt.Errorf("%s: %w: %q", fn, ErrUnknownRole, cfg.Role)
+	}
+
+	return n, nil
+}
+
+func (n *node) Role() string {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	return n.role
+}
+
+// Writable сообщает, принимает ли узел запись.
+func (n *node) Writable() bool {
+	return n.Role() != RoleSecondary
+}
+
+func (n *node) CreateOrUpdate(metric models.Metrics) error {
+	switch n.lockPrimary() {
+	case RoleSecondary:
+		return ErrReadOnly
+	case RoleStandalone:
+		return n.repository.CreateOrUpdate(metric)
+	}
+
+	defer n.mutex.Unlock()
+
+	if err := n.repository.CreateOrUpdate(metric); err != nil {
+		return err
+	}
+
+	n.logCurrent(metric)
+
+	return nil
+}
+
+func (n *node) Delete(metric models.Metrics) error {
+	switch n.lockPrimary() {
+	case RoleSecondary:
+		return ErrReadOnly
+	case RoleStandalone:
+		return n.repository.Delete(metric)
+	}
+
+	defer n.mutex.Unlock()
+
+	if err := n.repository.Delete(metric); err != nil {
+		return err
+	}
+
+	n.log.append(OpDelete, models.Metrics{ID: metric.ID, MType: metric.MType})
+
+	return nil
+}
+
+func (n *node) Reset(metric models.Metrics) error {
+	switch n.lockPrimary() {
+	case RoleSecondary:
+		return ErrReadOnly
+	case RoleStandalone:
+		return n.repository.Reset(metric)
+	}
+
+	defer n.mutex.Unlock()
+
+	if err := n.repository.Reset(metric); err != nil {
+		return err
+	}
+
+	n.logCurrent(metric)
+
+	return nil
+}
+
+// MarkStale и DeleteStale на secondary ничего не делают: пометки
+// и удаления приходят с primary.
+func (n *node) MarkStale(before time.Time) (int, error) {
+	switch n.lockPrimary() {
+	case RoleSecondary:
+		return 0, nil
+	case RoleStandalone:
+		return n.repository.MarkStale(before)
+	}
+
+	defer n.mutex.Unlock()
+
+	count, err := n.repository.MarkStale(before)
+	if err != nil || count == 0 {
+		return count, err
+	}
+
+	for _, m := range n.expired(before) {
+		n.log.append(OpSet, m)
+	}
+
+	return count, nil
+}
+
+func (n *node) DeleteStale(before time.Time) (int, error) {
+	switch n.lockPrimary() {
+	case RoleSecondary:
+		return 0, nil
+	case RoleStandalone:
+		return n.repository.DeleteStale(before)
+	}
+
+	defer n.mutex.Unlock()
+
+	expired := n.expired(before)
+
+	count, err := n.repository.DeleteStale(before)
+	if err != nil || count == 0 {
+		return count, err
+	}
+
+	for _, m := range expired {
+		n.log.append(OpDelete, models.Metrics{ID: m.ID, MType: m.MType})
+	}
+
+	return count, nil
+}
+
+func (n *node) Close() error {
+	n.mutex.Lock()
+	f := n.follower
+	n.mutex.Unlock()
+
+	if f != nil {
+		f.stop()
+	}
+
+	return n.repository.Close()
+}
+
+// Promote делает secondary primary-узлом. Журнал нового primary
+// продолжает нумерацию с последней применённой операции.
+func (n *node) Promote() error {
+	const fn = "replication.Promote"
+
+	n.mutex.Lock()
+	f := n.follower
+	n.mutex.Unlock()
+
+	if f == nil {
+		return fmt.Errorf("%s: %w", fn, ErrNotSecondary)
+	}
+
+	f.stop()
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.follower != f {
+		return fmt.Errorf("%s: %w", fn, ErrNotSecondary)
+	}
+
+	n.role = RolePrimary
+	n.log = newOplog(n.cfg.LogSize, f.status().Seq)
+	n.follower = nil
+
+	return nil
+}
+
+func (n *node) Status() Status {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	switch n.role {
+	case RolePrimary:
+		return Status{Role: n.role, Log: n.log.id, Seq: n.log.seq(), Connected: true}
+	case RoleSecondary:
+		return n.follower.status()
+	default:
+		return Status{Role: n.role}
+	}
+}
+
+// Follow отдаёт журнал начиная с after через send, пока ctx или done
+// не завершатся. Если реплика пришла с чужим журналом или отстала
+// дальше, чем хранится журнал, сначала отправляется снимок.
+func (n *node) Follow(ctx context.Context, done <-chan struct{}, logID string, after uint64, send func(Op) error) error {
+	const fn = "replication.Follow"
+
+	n.mutex.Lock()
+
+	if n.role != RolePrimary {
+		n.mutex.Unlock()
+		return fmt.Errorf("%s: %w", fn, ErrNotPrimary)
+	}
+
+	log := n.log
+
+	_, _, ok := log.since(after)
+	if logID != log.id || !ok {
+		metrics, err := n.repository.Dump()
+		if err != nil {
+			n.mutex.Unlock()
+			return fmt.Errorf("%s: %v", fn, err)
+		}
+
+		after = log.seq()
+
+		n.mutex.Unlock()
+
+		if err := send(Op{Seq: after, Kind: OpSnapshot, Time: time.Now(), Log: log.id, Metrics: metrics}); err != nil {
+			return err
+		}
+	} else {
+		n.mutex.Unlock()
+	}
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	for {
+		ops, updated, ok := log.since(after)
+		if !ok {
+			return fmt.Errorf("%s: replica fell behind the log", fn)
+		}
+
+		for _, op := range ops {
+			if err := send(op); err != nil {
+				return err
+			}
+			after = op.Seq
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-done:
+			return nil
+		case <-updated:
+		case <-ticker.C:
+			if err := send(Op{Seq: log.seq(), Kind: OpHeartbeat, Time: time.Now(), Log: log.id}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// lockPrimary захватывает мьютекс и возвращает роль. На primary мьютекс
+// остаётся захваченным, чтобы запись в repo и в журнал шли под одной
+// блокировкой; вызывающий отпускает его сам. На остальных ролях журнала
+// нет, и мьютекс сразу отпускается, чтобы записи не выстраивались в очередь.
+func (n *node) lockPrimary() string {
+	n.mutex.Lock()
+
+	role := n.role
+	if role != RolePrimary {
+		n.mutex.Unlock()
+	}
+
+	return role
+}
+
+// logCurrent пишет в журнал итоговое состояние серии после записи.
+func (n *node) logCurrent(metric models.Metrics) {
+	current, err := n.repository.Get(metric)
+	if err != nil {
+		fmt.Printf("replication: can't read %s after write: %v\n", metric.ID, err)
+		return
+	}
+
+	n.log.append(OpSet, current)
+}
+
+// expired возвращает серии, которые затронет очистка по TTL.
+func (n *node) expired(before time.Time) []models.Metrics {
+	metrics, err := n.repository.Dump()
+	if err != nil {
+		return nil
+	}
+
+	var result []models.Metrics
+	for _, m := range metrics {
+		if m.UpdatedAt != nil && m.UpdatedAt.Before(before) {
+			result = append(result, m)
+		}
+	}
+
+	return result
+}
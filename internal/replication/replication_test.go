@@ -0,0 +1,53 @@
+package replication
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	config "github.com/BeInBloom/spanish-inquisition/internal/config/server-config"
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+)
+
+// blockingRepo держит запись серии "slow", пока не закроют release.
+type blockingRepo struct {
+	repository
+	release chan struct{}
+}
+
+func (r *blockingRepo) CreateOrUpdate(m models.Metrics) error {
+	if m.ID == "slow" {
+		<-r.release
+	}
+
+	return nil
+}
+
+func TestNode_StandaloneWritesDoNotSerialize(t *testing.T) {
+	repo := &blockingRepo{release: make(chan struct{})}
+	defer close(repo.release)
+
+	n, err := New(context.Background(), config.ReplicationConfig{}, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value := 1.0
+
+	go n.CreateOrUpdate(models.Metrics{ID: "slow", MType: models.Gauge, Value: &value})
+
+	done := make(chan error, 1)
+
+	// Даём медленной записи начаться и проверяем, что быстрая её не ждёт.
+	time.Sleep(10 * time.Millisecond)
+	go func() { done <- n.CreateOrUpdate(models.Metrics{ID: "fast", MType: models.Gauge, Value: &value}) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("standalone write waited for another write")
+	}
+}
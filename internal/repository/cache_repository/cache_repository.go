@@ -0,0 +1,407 @@
+package cacherepository
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	config "github.com/BeInBloom/spanish-inquisition/internal/config/server-config"
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+	"github.com/BeInBloom/spanish-inquisition/internal/query"
+	mapstorage "github.com/BeInBloom/spanish-inquisition/internal/storage"
+)
+
+const (
+	defaultFlushInterval = 5 * time.Second
+	defaultFlushSize     = 1000
+)
+
+type repository interface {
+	CreateOrUpdate(models.Metrics) error
+	Get(models.Metrics) (models.Metrics, error)
+	Dump() ([]models.Metrics, error)
+	List(query.Filter) (query.Page, error)
+	Aggregate(query.Aggregation) ([]query.Sample, error)
+	Select(query.Selector) ([]query.Sample, error)
+	History(item models.Metrics, since time.Time) ([]models.Point, error)
+	Check() error
+	Delete(models.Metrics) error
+	Reset(models.Metrics) error
+	MarkStale(before time.Time) (int, error)
+	DeleteStale(before time.Time) (int, error)
+	Init(context.Context) error
+	Close() error
+}
+
+// batchWriter — хранилище, которое умеет писать пачку за раз.
+// Остальным пачка отдаётся по одной метрике.
+type batchWriter interface {
+	CreateOrUpdateBatch([]models.Metrics) error
+}
+
+type cache interface {
+	Create(models.Metrics) error
+	Get(models.Metrics) (models.Metrics, error)
+	Dump() []models.Metrics
+	Replace([]models.Metrics)
+	Delete(models.Metrics) error
+	Reset(models.Metrics) error
+	History(item models.Metrics, since time.Time) ([]models.Point, error)
+	Expire(before time.Time, remove bool) int
+}
+
+// cacheRepository держит полную копию данных в mapstorage и отвечает
+// на чтение из неё. Запись сразу попадает в кеш, а в backend уходит
+// пачками: приросты counter'ов складываются, от gauge остаётся последнее
+// значение. Предполагается, что кроме этого сервера в backend никто
+// не пишет: чужие изменения кеш увидит только после рестарта.
+type cacheRepository struct {
+	backend  repository
+	interval time.Duration
+	size     int
+
+	// mutex держится на время изменения кеша и pending вместе.
+	mutex   sync.Mutex
+	data    cache
+	pending map[string]models.Metrics
+
+	// flushMutex не даёт двум сбросам идти одновременно и сохраняет
+	// порядок между сбросом и удалением или обнулением серии.
+	flushMutex  sync.Mutex
+	flushSignal chan struct{}
+	stop        context.CancelFunc
+	done        chan struct{}
+}
+
+func New(cfg config.DBConfig, backend repository) *cacheRepository {
+	interval := cfg.CacheConfig.FlushInterval
+	if interval <= 0 {
+		interval = defaultFlushInterval
+	}
+
+	size := cfg.CacheConfig.FlushSize
+	if size <= 0 {
+		size = defaultFlushSize
+	}
+
+	return &cacheRepository{
+		backend:     backend,
+		interval:    interval,
+		size:        size,
+		data:        mapstorage.New(cfg.HistoryRetention),
+		pending:     make(map[string]models.Metrics),
+		flushSignal: make(chan struct{}, 1),
+		done:        make(chan struct{}),
+	}
+}
+
+func (c *cacheRepository) Init(ctx context.Context) error {
+	const fn = "cacheRepository.Init"
+
+	if err := c.backend.Init(ctx); err != nil {
+		return fmt.Errorf("%v: %w", fn, err)
+	}
+
+	metrics, err := c.backend.Dump()
+	if err != nil {
+		return fmt.Errorf("%v: %v", fn, err)
+	}
+
+	c.data.Replace(metrics)
+
+	ctx, c.stop = context.WithCancel(ctx)
+
+	go c.run(ctx)
+
+	return nil
+}
+
+// Close останавливает фоновый сброс и пишет в backend всё, что осталось.
+func (c *cacheRepository) Close() error {
+	const fn = "cacheRepository.Close"
+
+	if c.stop != nil {
+		c.stop()
+		<-c.done
+	}
+
+	if err := c.Flush(); err != nil {
+		return fmt.Errorf("%v: %v", fn, err)
+	}
+
+	return c.backend.Close()
+}
+
+func (c *cacheRepository) Check() error {
+	return c.backend.Check()
+}
+
+func (c *cacheRepository) Get(metric models.Metrics) (models.Metrics, error) {
+	const fn = "cacheRepository.Get"
+
+	m, err := c.data.Get(metric)
+	if err != nil {
+		return models.Metrics{}, fmt.Errorf("%v: %w", fn, err)
+	}
+
+	return m, nil
+}
+
+func (c *cacheRepository) Dump() ([]models.Metrics, error) {
+	return c.data.Dump(), nil
+}
+
+func (c *cacheRepository) List(f query.Filter) (query.Page, error) {
+	return query.List(c.data.Dump(), f)
+}
+
+func (c *cacheRepository) Aggregate(agg query.Aggregation) ([]query.Sample, error) {
+	return query.Evaluate(c.data.Dump(), agg), nil
+}
+
+func (c *cacheRepository) Select(sel query.Selector) ([]query.Sample, error) {
+	return query.SelectSeries(c.data.Dump(), sel), nil
+}
+
+func (c *cacheRepository) CreateOrUpdate(metric models.Metrics) error {
+	const fn = "cacheRepository.CreateOrUpdate"
+
+	if err := metric.Validate(); err != nil {
+		return fmt.Errorf("%v: %w", fn, err)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.data.Create(metric); err != nil {
+		return fmt.Errorf("%v: %w", fn, err)
+	}
+
+	c.merge(metric, false)
+
+	if len(c.pending) >= c.size {
+		select {
+		case c.flushSignal <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// Delete и Reset сначала сбрасывают накопленное, чтобы backend увидел
+// операции в том же порядке, что и кеш.
+func (c *cacheRepository) Delete(metric models.Metrics) error {
+	const fn = "cacheRepository.Delete"
+
+	c.flushMutex.Lock()
+	defer c.flushMutex.Unlock()
+
+	if err := c.flush(); err != nil {
+		return fmt.Errorf("%v: %w", fn, err)
+	}
+
+	c.mutex.Lock()
+	err := c.data.Delete(metric)
+	delete(c.pending, pendingKey(metric))
+	c.mutex.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("%v: %w", fn, err)
+	}
+
+	return c.backend.Delete(metric)
+}
+
+func (c *cacheRepository) Reset(metric models.Metrics) error {
+	const fn = "cacheRepository.Reset"
+
+	c.flushMutex.Lock()
+	defer c.flushMutex.Unlock()
+
+	if err := c.flush(); err != nil {
+		return fmt.Errorf("%v: %w", fn, err)
+	}
+
+	c.mutex.Lock()
+	err := c.data.Reset(metric)
+	delete(c.pending, pendingKey(metric))
+	c.mutex.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("%v: %w", fn, err)
+	}
+
+	return c.backend.Reset(metric)
+}
+
+// History склеивает историю из backend с точками кеша, которые
+// появились после последней сохранённой точки.
+func (c *cacheRepository) History(metric models.Metrics, since time.Time) ([]models.Point, error) {
+	const fn = "cacheRepository.History"
+
+	cached, cacheErr := c.data.History(metric, since)
+
+	stored, err := c.backend.History(metric, since)
+	if err != nil {
+		if cacheErr != nil {
+			return nil, fmt.Errorf("%v: %w", fn, cacheErr)
+		}
+
+		return cached, nil
+	}
+
+	last := stored[len(stored)-1].Time
+	for _, p := range cached {
+		if p.Time.After(last) {
+			stored = append(stored, p)
+		}
+	}
+
+	return stored, nil
+}
+
+func (c *cacheRepository) MarkStale(before time.Time) (int, error) {
+	c.mutex.Lock()
+	n := c.data.Expire(before, false)
+	c.mutex.Unlock()
+
+	if _, err := c.backend.MarkStale(before); err != nil {
+		return n, err
+	}
+
+	return n, nil
+}
+
+func (c *cacheRepository) DeleteStale(before time.Time) (int, error) {
+	const fn = "cacheRepository.DeleteStale"
+
+	c.flushMutex.Lock()
+	defer c.flushMutex.Unlock()
+
+	if err := c.flush(); err != nil {
+		return 0, fmt.Errorf("%v: %w", fn, err)
+	}
+
+	c.mutex.Lock()
+	n := c.data.Expire(before, true)
+	c.mutex.Unlock()
+
+	if _, err := c.backend.DeleteStale(before); err != nil {
+		return n, err
+	}
+
+	return n, nil
+}
+
+// Flush сразу пишет накопленное в backend.
+func (c *cacheRepository) Flush() error {
+	c.flushMutex.Lock()
+	defer c.flushMutex.Unlock()
+
+	return c.flush()
+}
+
+func (c *cacheRepository) run(ctx context.Context) {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-c.flushSignal:
+		}
+
+		if err := c.Flush(); err != nil {
+			fmt.Printf("cache flush error: %v\n", err)
+		}
+	}
+}
+
+// flush вызывается под flushMutex. Если backend не принял пачку,
+// она возвращается в pending и уйдёт со следующим сбросом.
+func (c *cacheRepository) flush() error {
+	c.mutex.Lock()
+	batch := make([]models.Metrics, 0, len(c.pending))
+	for _, m := range c.pending {
+		batch = append(batch, m)
+	}
+	c.pending = make(map[string]models.Metrics)
+	c.mutex.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	if bw, ok := c.backend.(batchWriter); ok {
+		if err := bw.CreateOrUpdateBatch(batch); err != nil {
+			c.requeue(batch)
+			return err
+		}
+
+		return nil
+	}
+
+	for i, m := range batch {
+		if err := c.backend.CreateOrUpdate(m); err != nil {
+			c.requeue(batch[i:])
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *cacheRepository) requeue(batch []models.Metrics) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, m := range batch {
+		c.merge(m, true)
+	}
+}
+
+// merge вызывается под mutex. older означает, что m вернулась после
+// неудачного сброса, и более свежий gauge в pending важнее неё.
+func (c *cacheRepository) merge(m models.Metrics, older bool) {
+	key := pendingKey(m)
+
+	cur, ok := c.pending[key]
+	if !ok {
+		// Указатели копируются: тот же Delta мог уйти в кеш, а кеш
+		// прибавляет к нему следующие приросты.
+		cur = models.Metrics{ID: m.ID, MType: m.MType}
+		if m.Delta != nil {
+			delta := *m.Delta
+			cur.Delta = &delta
+		}
+		if m.Value != nil {
+			value := *m.Value
+			cur.Value = &value
+		}
+
+		c.pending[key] = cur
+
+		return
+	}
+
+	switch {
+	case m.MType == models.Counter:
+		sum := *cur.Delta + *m.Delta
+		cur.Delta = &sum
+	case !older:
+		value := *m.Value
+		cur.Value = &value
+	}
+
+	c.pending[key] = cur
+}
+
+func pendingKey(m models.Metrics) string {
+	return m.MType + "/" + m.ID
+}
@@ -0,0 +1,103 @@
+package cacherepository
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	config "github.com/BeInBloom/spanish-inquisition/internal/config/server-config"
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+	"github.com/BeInBloom/spanish-inquisition/internal/repository/memrepository"
+	"github.com/BeInBloom/spanish-inquisition/internal/repository/repotest"
+)
+
+// recordingBackend запоминает, что до него дошло, и умеет отказать в записи.
+type recordingBackend struct {
+	repository
+	writes []models.Metrics
+	fail   bool
+}
+
+func (b *recordingBackend) CreateOrUpdate(m models.Metrics) error {
+	if b.fail {
+		return errors.New("backend is down")
+	}
+
+	b.writes = append(b.writes, m)
+
+	return b.repository.CreateOrUpdate(m)
+}
+
+func TestCacheRepository_WriteBehind(t *testing.T) {
+	cfg := config.Config{}
+	cfg.BakConfig.Path = filepath.Join(t.TempDir(), "bak.json")
+	cfg.StoreInterval = 300
+
+	backend := &recordingBackend{repository: memrepository.New(cfg)}
+
+	c := New(config.DBConfig{CacheConfig: config.CacheConfig{FlushInterval: time.Hour}}, backend)
+	if err := c.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range []models.Metrics{repotest.Counter("requests", 2), repotest.Counter("requests", 3), repotest.Gauge("load", 1), repotest.Gauge("load", 7)} {
+		if err := c.CreateOrUpdate(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, err := c.Get(repotest.Counter("requests", 0)); err != nil || *got.Delta != 5 {
+		t.Fatalf("read from cache: got %+v, %v", got, err)
+	}
+
+	if len(backend.writes) != 0 {
+		t.Fatalf("backend written before flush: %+v", backend.writes)
+	}
+
+	backend.fail = true
+	if err := c.Flush(); err == nil {
+		t.Fatal("expected flush error")
+	}
+
+	backend.fail = false
+	if err := c.CreateOrUpdate(repotest.Counter("requests", 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(backend.writes) != 2 {
+		t.Fatalf("writes were not coalesced: %+v", backend.writes)
+	}
+
+	if got, _ := backend.Get(repotest.Counter("requests", 0)); got.Delta == nil || *got.Delta != 6 {
+		t.Errorf("counter in backend: got %+v, want 6", got)
+	}
+
+	if got, _ := backend.Get(repotest.Gauge("load", 0)); got.Value == nil || *got.Value != 7 {
+		t.Errorf("gauge in backend: got %+v, want 7", got)
+	}
+}
+
+// Сброс раз в миллисекунду, чтобы проверки шли на фоне записи в backend.
+func TestConformance(t *testing.T) {
+	repotest.Run(t, repotest.Suite{
+		New: func(t *testing.T) repotest.Repository {
+			cfg := config.Config{}
+			cfg.BakConfig.Path = filepath.Join(t.TempDir(), "bak.json")
+			cfg.StoreInterval = 300
+
+			c := New(config.DBConfig{CacheConfig: config.CacheConfig{FlushInterval: time.Millisecond}}, memrepository.New(cfg))
+			if err := c.Init(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { c.Close() })
+
+			return c
+		},
+	})
+}
@@ -0,0 +1,147 @@
+package logrepository
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// moved — живая запись, переписанная компакцией.
+type moved struct {
+	key    string
+	from   location
+	offset int64
+}
+
+// Compact переписывает живые записи всех закрытых сегментов в один.
+// Результат получает имя (id последнего сжатого, поколение+1): он
+// читается после сжатых сегментов и до активного. Поэтому падение
+// в любой момент безопасно — пока старые сегменты не удалены, они
+// проигрываются раньше результата, а удаляются они по порядку.
+// Надгробия не переносятся: всё, что они перекрывали, тоже сжимается.
+func (r *logRepository) Compact() error {
+	const fn = "logRepository.Compact"
+
+	r.compactMutex.Lock()
+	defer r.compactMutex.Unlock()
+
+	r.mutex.Lock()
+	sealed := slices.Clone(r.sealed)
+	r.mutex.Unlock()
+
+	if len(sealed) < compactThreshold {
+		return nil
+	}
+
+	last := sealed[len(sealed)-1]
+	target := segmentName{id: last.id, generation: last.generation + 1}
+	tmp := r.path(target) + tmpExt
+
+	records, err := r.rewrite(sealed, tmp)
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("%v: %v", fn, err)
+	}
+
+	if err := os.Rename(tmp, r.path(target)); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("%v: %v", fn, err)
+	}
+
+	if err := syncDir(r.dir); err != nil {
+		return fmt.Errorf("%v: %v", fn, err)
+	}
+
+	// Серия могла обновиться, пока шла перезапись: тогда индекс уже
+	// смотрит в активный сегмент и трогать его не нужно.
+	r.mutex.Lock()
+	for _, m := range records {
+		if r.index[m.key] == m.from {
+			r.index[m.key] = location{segment: target, offset: m.offset}
+		}
+	}
+	r.sealed = append([]segmentName{target}, r.sealed[len(sealed):]...)
+	r.mutex.Unlock()
+
+	for _, name := range sealed {
+		if err := os.Remove(r.path(name)); err != nil {
+			return fmt.Errorf("%v: %v", fn, err)
+		}
+	}
+
+	return nil
+}
+
+func (r *logRepository) rewrite(sealed []segmentName, path string) ([]moved, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+
+	var (
+		records []moved
+		offset  int64
+	)
+
+	for _, name := range sealed {
+		_, err := readSegment(r.path(name), func(rec record, from int64) error {
+			if rec.Op != opSet {
+				return nil
+			}
+
+			k := indexKey(rec.Metric)
+			loc := location{segment: name, offset: from}
+
+			r.mutex.Lock()
+			live := r.index[k] == loc
+			r.mutex.Unlock()
+
+			if !live {
+				return nil
+			}
+
+			buf, err := encodeRecord(rec)
+			if err != nil {
+				return err
+			}
+
+			if _, err := w.Write(buf); err != nil {
+				return err
+			}
+
+			records = append(records, moved{key: k, from: loc, offset: offset})
+			offset += int64(len(buf))
+
+			return nil
+		})
+		// Битый хвост закрытого сегмента уже пропущен при восстановлении.
+		if err != nil && !errors.Is(err, ErrCorruptRecord) {
+			return nil, err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+
+	if err := file.Sync(); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
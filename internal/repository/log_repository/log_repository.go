@@ -0,0 +1,562 @@
+package logrepository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/apperrors"
+	config "github.com/BeInBloom/spanish-inquisition/internal/config/server-config"
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+	"github.com/BeInBloom/spanish-inquisition/internal/query"
+	mapstorage "github.com/BeInBloom/spanish-inquisition/internal/storage"
+)
+
+const (
+	defaultSegmentSize     = 16 << 20
+	defaultCompactInterval = time.Minute
+
+	// Компакция запускается, когда закрытых сегментов набралось столько.
+	compactThreshold = 2
+)
+
+var (
+	ErrClosed = apperrors.New(apperrors.ErrUnavailable, "storage_closed", "log storage is closed")
+)
+
+type storage interface {
+	Get(models.Metrics) (models.Metrics, error)
+	Dump() []models.Metrics
+	Load(models.Metrics)
+	Replace([]models.Metrics)
+	Delete(models.Metrics) error
+	History(item models.Metrics, since time.Time) ([]models.Point, error)
+	Expire(before time.Time, remove bool) int
+}
+
+// location — где лежит последняя запись серии.
+type location struct {
+	segment segmentName
+	offset  int64
+}
+
+// logRepository хранит метрики в журнале: каждое изменение дописывается
+// в активный сегмент, а полное состояние держится в памяти и
+// восстанавливается в Init проигрыванием сегментов по порядку.
+// Индекс помнит, какая запись по серии последняя, — по нему компакция
+// отличает живые записи от перезаписанных.
+//
+// Запись не делает fsync: переживается падение процесса, но не питания.
+// Недописанный хвост отсекается при восстановлении по crc.
+type logRepository struct {
+	dir             string
+	segmentSize     int64
+	compactInterval time.Duration
+
+	data storage
+
+	// mutex держится на время изменения данных, журнала и индекса вместе.
+	mutex      sync.Mutex
+	index      map[string]location
+	active     *os.File
+	activeName segmentName
+	activeSize int64
+	sealed     []segmentName
+
+	compactMutex sync.Mutex
+	stop         context.CancelFunc
+	done         chan struct{}
+}
+
+func New(cfg config.DBConfig) *logRepository {
+	size := cfg.LogStorageConfig.SegmentSize
+	if size <= 0 {
+		size = defaultSegmentSize
+	}
+
+	interval := cfg.LogStorageConfig.CompactInterval
+	if interval <= 0 {
+		interval = defaultCompactInterval
+	}
+
+	return &logRepository{
+		dir:             cfg.LogStorageConfig.Dir,
+		segmentSize:     size,
+		compactInterval: interval,
+		data:            mapstorage.New(cfg.HistoryRetention),
+		index:           make(map[string]location),
+		done:            make(chan struct{}),
+	}
+}
+
+// Init проигрывает сегменты. Битый хвост последнего сегмента — след
+// падения посреди записи — обрезается, в него пишется дальше.
+func (r *logRepository) Init(ctx context.Context) error {
+	const fn = "logRepository.Init"
+
+	if err := os.MkdirAll(r.dir, 0o755); err != nil {
+		return fmt.Errorf("%v: %w", fn, err)
+	}
+
+	names, err := listSegments(r.dir)
+	if err != nil {
+		return fmt.Errorf("%v: %w", fn, err)
+	}
+
+	if len(names) == 0 {
+		names = []segmentName{{id: 1}}
+	}
+
+	for i, name := range names {
+		last := i == len(names)-1
+		path := r.path(name)
+
+		end, err := readSegment(path, func(rec record, offset int64) error {
+			r.replay(rec, location{segment: name, offset: offset})
+			return nil
+		})
+
+		switch {
+		case errors.Is(err, os.ErrNotExist) && last:
+		case errors.Is(err, ErrCorruptRecord) && last:
+			fmt.Printf("log storage: truncating %s at offset %d\n", path, end)
+
+			if err := os.Truncate(path, end); err != nil {
+				return fmt.Errorf("%v: %w", fn, err)
+			}
+		case errors.Is(err, ErrCorruptRecord):
+			fmt.Printf("log storage: corrupt record in %s at offset %d, rest of segment skipped\n", path, end)
+		case err != nil:
+			return fmt.Errorf("%v: %w", fn, err)
+		}
+
+		if last {
+			r.activeName = name
+			r.activeSize = end
+		} else {
+			r.sealed = append(r.sealed, name)
+		}
+	}
+
+	active, err := os.OpenFile(r.path(r.activeName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("%v: %w", fn, err)
+	}
+
+	r.active = active
+
+	ctx, r.stop = context.WithCancel(ctx)
+
+	go r.run(ctx)
+
+	return nil
+}
+
+func (r *logRepository) Close() error {
+	const fn = "logRepository.Close"
+
+	if r.stop != nil {
+		r.stop()
+		<-r.done
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.active == nil {
+		return nil
+	}
+
+	defer func() { r.active = nil }()
+
+	if err := r.active.Sync(); err != nil {
+		r.active.Close()
+		return fmt.Errorf("%v: %w", fn, err)
+	}
+
+	if err := r.active.Close(); err != nil {
+		return fmt.Errorf("%v: %w", fn, err)
+	}
+
+	return nil
+}
+
+func (r *logRepository) Check() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.active == nil {
+		return ErrClosed
+	}
+
+	return nil
+}
+
+func (r *logRepository) Get(metric models.Metrics) (models.Metrics, error) {
+	const fn = "logRepository.Get"
+
+	if metric.MType == "" || metric.ID == "" {
+		return models.Metrics{}, fmt.Errorf("%v: %w", fn, models.ErrInvalidMetric)
+	}
+
+	m, err := r.data.Get(metric)
+	if err != nil {
+		return models.Metrics{}, fmt.Errorf("%v: %w", fn, err)
+	}
+
+	return m, nil
+}
+
+func (r *logRepository) Dump() ([]models.Metrics, error) {
+	return r.data.Dump(), nil
+}
+
+func (r *logRepository) List(f query.Filter) (query.Page, error) {
+	return query.List(r.data.Dump(), f)
+}
+
+func (r *logRepository) Aggregate(agg query.Aggregation) ([]query.Sample, error) {
+	return query.Evaluate(r.data.Dump(), agg), nil
+}
+
+func (r *logRepository) Select(sel query.Selector) ([]query.Sample, error) {
+	return query.SelectSeries(r.data.Dump(), sel), nil
+}
+
+func (r *logRepository) History(metric models.Metrics, since time.Time) ([]models.Point, error) {
+	const fn = "logRepository.History"
+
+	points, err := r.data.History(metric, since)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", fn, err)
+	}
+
+	return points, nil
+}
+
+// CreateOrUpdate считает новое состояние серии, пишет его в журнал и
+// только потом кладёт в память: то, что видно читателям, уже на диске.
+func (r *logRepository) CreateOrUpdate(metric models.Metrics) error {
+	const fn = "logRepository.CreateOrUpdate"
+
+	if err := metric.Validate(); err != nil {
+		return fmt.Errorf("%v: %w", fn, err)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	next := models.Metrics{ID: metric.ID, MType: metric.MType, UpdatedAt: &now}
+
+	switch metric.MType {
+	case models.Counter:
+		delta := *metric.Delta
+		if cur, err := r.data.Get(metric); err == nil && cur.Delta != nil {
+			delta += *cur.Delta
+		}
+		next.Delta = &delta
+	case models.Gauge:
+		value := *metric.Value
+		next.Value = &value
+	}
+
+	if err := r.append(record{Op: opSet, Metric: next}); err != nil {
+		return fmt.Errorf("%v: %w", fn, err)
+	}
+
+	r.data.Load(next)
+
+	return nil
+}
+
+func (r *logRepository) Delete(metric models.Metrics) error {
+	const fn = "logRepository.Delete"
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, err := r.data.Get(metric); err != nil {
+		return fmt.Errorf("%v: %w", fn, err)
+	}
+
+	if err := r.append(record{Op: opDelete, Metric: key(metric)}); err != nil {
+		return fmt.Errorf("%v: %w", fn, err)
+	}
+
+	r.data.Delete(metric)
+
+	return nil
+}
+
+func (r *logRepository) Reset(metric models.Metrics) error {
+	const fn = "logRepository.Reset"
+
+	if metric.MType != models.Counter {
+		return fmt.Errorf("%v: %w", fn, models.ErrUnexpectedMetricType)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, err := r.data.Get(metric); err != nil {
+		return fmt.Errorf("%v: %w", fn, err)
+	}
+
+	var zero int64
+	now := time.Now()
+	next := models.Metrics{ID: metric.ID, MType: metric.MType, Delta: &zero, UpdatedAt: &now}
+
+	if err := r.append(record{Op: opSet, Metric: next}); err != nil {
+		return fmt.Errorf("%v: %w", fn, err)
+	}
+
+	r.data.Load(next)
+
+	return nil
+}
+
+// MarkStale и DeleteStale пишут в журнал только затронутые серии.
+func (r *logRepository) MarkStale(before time.Time) (int, error) {
+	const fn = "logRepository.MarkStale"
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var n int
+
+	for _, m := range r.data.Dump() {
+		if m.Stale || !expired(m, before) {
+			continue
+		}
+
+		m.Stale = true
+
+		if err := r.append(record{Op: opSet, Metric: m}); err != nil {
+			return n, fmt.Errorf("%v: %w", fn, err)
+		}
+
+		r.data.Load(m)
+		n++
+	}
+
+	return n, nil
+}
+
+func (r *logRepository) DeleteStale(before time.Time) (int, error) {
+	const fn = "logRepository.DeleteStale"
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var n int
+
+	for _, m := range r.data.Dump() {
+		if !expired(m, before) {
+			continue
+		}
+
+		if err := r.append(record{Op: opDelete, Metric: key(m)}); err != nil {
+			return n, fmt.Errorf("%v: %w", fn, err)
+		}
+
+		r.data.Delete(m)
+		n++
+	}
+
+	return n, nil
+}
+
+// Load, Replace и Drop применяют состояние с primary при репликации.
+func (r *logRepository) Load(metric models.Metrics) error {
+	const fn = "logRepository.Load"
+
+	if err := metric.Validate(); err != nil {
+		return fmt.Errorf("%v: %w", fn, err)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := r.append(record{Op: opSet, Metric: metric}); err != nil {
+		return fmt.Errorf("%v: %w", fn, err)
+	}
+
+	r.data.Load(metric)
+
+	return nil
+}
+
+func (r *logRepository) Replace(metrics []models.Metrics) error {
+	const fn = "logRepository.Replace"
+
+	for _, metric := range metrics {
+		if err := metric.Validate(); err != nil {
+			return fmt.Errorf("%v: %w", fn, err)
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	keep := make(map[string]struct{}, len(metrics))
+	for _, m := range metrics {
+		keep[indexKey(m)] = struct{}{}
+	}
+
+	for _, m := range r.data.Dump() {
+		if _, ok := keep[indexKey(m)]; ok {
+			continue
+		}
+
+		if err := r.append(record{Op: opDelete, Metric: key(m)}); err != nil {
+			return fmt.Errorf("%v: %w", fn, err)
+		}
+	}
+
+	for _, m := range metrics {
+		if err := r.append(record{Op: opSet, Metric: m}); err != nil {
+			return fmt.Errorf("%v: %w", fn, err)
+		}
+	}
+
+	r.data.Replace(metrics)
+
+	return nil
+}
+
+func (r *logRepository) Drop(metric models.Metrics) error {
+	const fn = "logRepository.Drop"
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, err := r.data.Get(metric); err != nil {
+		return nil
+	}
+
+	if err := r.append(record{Op: opDelete, Metric: key(metric)}); err != nil {
+		return fmt.Errorf("%v: %w", fn, err)
+	}
+
+	r.data.Delete(metric)
+
+	return nil
+}
+
+// append вызывается под mutex. Если запись не легла целиком, файл
+// обрезается обратно, чтобы следующие записи не оказались за мусором.
+// Сбой диска — недоступность хранилища.
+func (r *logRepository) append(rec record) error {
+	if r.active == nil {
+		return ErrClosed
+	}
+
+	buf, err := encodeRecord(rec)
+	if err != nil {
+		return err
+	}
+
+	if r.activeSize > 0 && r.activeSize+int64(len(buf)) > r.segmentSize {
+		if err := r.rotate(); err != nil {
+			return apperrors.Wrap(apperrors.ErrUnavailable, err)
+		}
+	}
+
+	if _, err := r.active.Write(buf); err != nil {
+		r.active.Truncate(r.activeSize)
+		return apperrors.Wrap(apperrors.ErrUnavailable, err)
+	}
+
+	r.index[indexKey(rec.Metric)] = location{segment: r.activeName, offset: r.activeSize}
+	if rec.Op == opDelete {
+		delete(r.index, indexKey(rec.Metric))
+	}
+
+	r.activeSize += int64(len(buf))
+
+	return nil
+}
+
+// rotate закрывает активный сегмент и открывает следующий.
+func (r *logRepository) rotate() error {
+	next := segmentName{id: r.activeName.id + 1}
+
+	file, err := os.OpenFile(r.path(next), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if err := r.active.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+
+	r.active.Close()
+
+	r.sealed = append(r.sealed, r.activeName)
+	r.active = file
+	r.activeName = next
+	r.activeSize = 0
+
+	return nil
+}
+
+// replay применяет запись при восстановлении. Записи пишет сам
+// репозиторий, так что кривая метрика может быть только порчей.
+func (r *logRepository) replay(rec record, loc location) {
+	k := indexKey(rec.Metric)
+
+	switch rec.Op {
+	case opSet:
+		if rec.Metric.Validate() != nil {
+			return
+		}
+
+		r.data.Load(rec.Metric)
+		r.index[k] = loc
+	case opDelete:
+		r.data.Delete(rec.Metric)
+		delete(r.index, k)
+	}
+}
+
+func (r *logRepository) run(ctx context.Context) {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.compactInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := r.Compact(); err != nil {
+			fmt.Printf("log storage compaction error: %v\n", err)
+		}
+	}
+}
+
+func (r *logRepository) path(name segmentName) string {
+	return filepath.Join(r.dir, name.String())
+}
+
+// key — всё, что нужно надгробию.
+func key(m models.Metrics) models.Metrics {
+	return models.Metrics{ID: m.ID, MType: m.MType}
+}
+
+func indexKey(m models.Metrics) string {
+	return m.MType + "/" + m.ID
+}
+
+func expired(m models.Metrics, before time.Time) bool {
+	return m.UpdatedAt != nil && m.UpdatedAt.Before(before)
+}
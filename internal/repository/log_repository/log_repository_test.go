@@ -0,0 +1,111 @@
+package logrepository
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/apperrors"
+	config "github.com/BeInBloom/spanish-inquisition/internal/config/server-config"
+	"github.com/BeInBloom/spanish-inquisition/internal/repository/repotest"
+)
+
+func open(t *testing.T, dir string) *logRepository {
+	t.Helper()
+
+	r := New(config.DBConfig{LogStorageConfig: config.LogStorageConfig{Dir: dir, SegmentSize: 512}})
+	if err := r.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+func TestLogRepository_RecoveryAndCompaction(t *testing.T) {
+	dir := t.TempDir()
+	r := open(t, dir)
+
+	for i := 0; i < 50; i++ {
+		if err := r.CreateOrUpdate(repotest.Counter("requests", 1)); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := r.CreateOrUpdate(repotest.Gauge("load", float64(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := r.CreateOrUpdate(repotest.Gauge("gone", 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Delete(repotest.Gauge("gone", 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r.sealed) < compactThreshold {
+		t.Fatalf("segments were not rotated: %d sealed", len(r.sealed))
+	}
+
+	if err := r.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r.sealed) != 1 {
+		t.Fatalf("after compaction: %d sealed segments, want 1", len(r.sealed))
+	}
+
+	active := r.path(r.activeName)
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Недописанная запись в конце активного сегмента — как после падения.
+	f, err := os.OpenFile(active, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{1, 2, 3, 4, 200, 0, 0, 0, '{'})
+	f.Close()
+
+	r = open(t, dir)
+	defer r.Close()
+
+	if got, err := r.Get(repotest.Counter("requests", 0)); err != nil || *got.Delta != 50 {
+		t.Fatalf("counter after recovery: got %+v, %v", got, err)
+	}
+
+	if got, err := r.Get(repotest.Gauge("load", 0)); err != nil || *got.Value != 49 {
+		t.Fatalf("gauge after recovery: got %+v, %v", got, err)
+	}
+
+	if _, err := r.Get(repotest.Gauge("gone", 0)); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Fatalf("deleted series after recovery: got %v", err)
+	}
+
+	// После обрезки хвоста запись продолжается и переживает ещё один рестарт.
+	if err := r.CreateOrUpdate(repotest.Counter("requests", 5)); err != nil {
+		t.Fatal(err)
+	}
+
+	r.Close()
+	r = open(t, dir)
+	defer r.Close()
+
+	if got, err := r.Get(repotest.Counter("requests", 0)); err != nil || *got.Delta != 55 {
+		t.Fatalf("counter after second restart: got %+v, %v", got, err)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	repotest.Run(t, repotest.Suite{
+		New: func(t *testing.T) repotest.Repository {
+			r := open(t, t.TempDir())
+			t.Cleanup(func() { r.Close() })
+
+			return r
+		},
+	})
+}
@@ -0,0 +1,185 @@
+package logrepository
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+)
+
+const (
+	opSet    = "set"
+	opDelete = "del"
+
+	headerSize    = 8
+	maxRecordSize = 16 << 20
+
+	segmentExt = ".seg"
+	tmpExt     = ".tmp"
+)
+
+var (
+	ErrCorruptRecord = errors.New("corrupt record")
+
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// record — строка лога. set несёт итоговое состояние серии целиком,
+// поэтому при восстановлении последняя запись по ключу и есть состояние.
+type record struct {
+	Op     string         `json:"op"`
+	Metric models.Metrics `json:"metric"`
+}
+
+// На диске запись — crc32c тела, длина тела (оба little-endian uint32)
+// и само тело в JSON.
+func encodeRecord(r record) ([]byte, error) {
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, headerSize+len(payload))
+	binary.LittleEndian.PutUint32(buf[0:4], crc32.Checksum(payload, crcTable))
+	binary.LittleEndian.PutUint32(buf[4:8], uint32(len(payload)))
+	copy(buf[headerSize:], payload)
+
+	return buf, nil
+}
+
+// segmentName — файлы сортируются по (id, generation). Компакция пишет
+// результат с id последнего сжатого сегмента и следующим поколением,
+// чтобы он читался после всех сжатых и до более новых.
+type segmentName struct {
+	id         uint64
+	generation uint32
+}
+
+func (n segmentName) String() string {
+	return fmt.Sprintf("%016d-%04d%s", n.id, n.generation, segmentExt)
+}
+
+func (n segmentName) less(o segmentName) bool {
+	if n.id != o.id {
+		return n.id < o.id
+	}
+
+	return n.generation < o.generation
+}
+
+func parseSegmentName(file string) (segmentName, bool) {
+	base, ok := strings.CutSuffix(file, segmentExt)
+	if !ok {
+		return segmentName{}, false
+	}
+
+	idPart, genPart, ok := strings.Cut(base, "-")
+	if !ok {
+		return segmentName{}, false
+	}
+
+	id, err := strconv.ParseUint(idPart, 10, 64)
+	if err != nil {
+		return segmentName{}, false
+	}
+
+	gen, err := strconv.ParseUint(genPart, 10, 32)
+	if err != nil {
+		return segmentName{}, false
+	}
+
+	return segmentName{id: id, generation: uint32(gen)}, true
+}
+
+// listSegments возвращает сегменты каталога по порядку и удаляет
+// недописанные файлы компакции.
+func listSegments(dir string) ([]segmentName, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []segmentName
+
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+
+		if strings.HasSuffix(e.Name(), tmpExt) {
+			os.Remove(filepath.Join(dir, e.Name()))
+			continue
+		}
+
+		if n, ok := parseSegmentName(e.Name()); ok {
+			names = append(names, n)
+		}
+	}
+
+	sort.Slice(names, func(i, j int) bool { return names[i].less(names[j]) })
+
+	return names, nil
+}
+
+// readSegment читает записи по порядку и отдаёт каждую вместе со смещением.
+// Возвращает смещение конца последней целой записи; если дальше лежит
+// битая или недописанная запись, вместе с ним возвращается ErrCorruptRecord.
+func readSegment(path string, f func(r record, offset int64) error) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	header := make([]byte, headerSize)
+
+	var offset int64
+
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return offset, nil
+			}
+
+			return offset, ErrCorruptRecord
+		}
+
+		sum := binary.LittleEndian.Uint32(header[0:4])
+		size := binary.LittleEndian.Uint32(header[4:8])
+
+		if size > maxRecordSize {
+			return offset, ErrCorruptRecord
+		}
+
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			return offset, ErrCorruptRecord
+		}
+
+		if crc32.Checksum(payload, crcTable) != sum {
+			return offset, ErrCorruptRecord
+		}
+
+		var r record
+		if err := json.Unmarshal(payload, &r); err != nil {
+			return offset, ErrCorruptRecord
+		}
+
+		if err := f(r, offset); err != nil {
+			return offset, err
+		}
+
+		offset += headerSize + int64(size)
+	}
+}
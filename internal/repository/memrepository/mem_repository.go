@@ -9,24 +9,20 @@ import (
 	config "github.com/BeInBloom/spanish-inquisition/internal/config/server-config"
 	filestorage "github.com/BeInBloom/spanish-inquisition/internal/metric_storage/file_storage"
 	"github.com/BeInBloom/spanish-inquisition/internal/models"
+	"github.com/BeInBloom/spanish-inquisition/internal/query"
 	mapstorage "github.com/BeInBloom/spanish-inquisition/internal/storage"
 )
 
-const (
-	counter = "counter"
-	gauge   = "gauge"
-)
-
-var (
-	ErrNotCorrectType       = errors.New("not correct type")
-	ErrNotCorrectMetricType = errors.New("not correct metric type")
-	ErrRepoNotFound         = errors.New("repository not found")
-)
-
 type repository interface {
 	Create(models.Metrics) error
 	Get(models.Metrics) (models.Metrics, error)
 	Dump() []models.Metrics
+	Load(models.Metrics)
+	Replace([]models.Metrics)
+	Delete(models.Metrics) error
+	Reset(models.Metrics) error
+	History(item models.Metrics, since time.Time) ([]models.Point, error)
+	Expire(before time.Time, remove bool) int
 }
 
 type Gauge = float64
@@ -47,25 +43,42 @@ func (m *memRepository) Get(metric models.Metrics) (models.Metrics, error) {
 	const fn = "MemStorage.Get"
 
 	if metric.MType == "" || metric.ID == "" {
-		return models.Metrics{}, fmt.Errorf("%v: %v", fn, ErrNotCorrectType)
+		return models.Metrics{}, fmt.Errorf("%v: %w", fn, models.ErrInvalidMetric)
+	}
+
+	res, err := m.data.Get(metric)
+	if err != nil {
+		return models.Metrics{}, fmt.Errorf("%v: %w", fn, err)
 	}
 
-	return m.data.Get(metric)
+	return res, nil
 }
 
 func (m *memRepository) Dump() ([]models.Metrics, error) {
 	return m.data.Dump(), nil
 }
 
+func (m *memRepository) List(f query.Filter) (query.Page, error) {
+	return query.List(m.data.Dump(), f)
+}
+
+func (m *memRepository) Aggregate(agg query.Aggregation) ([]query.Sample, error) {
+	return query.Evaluate(m.data.Dump(), agg), nil
+}
+
+func (m *memRepository) Select(sel query.Selector) ([]query.Sample, error) {
+	return query.SelectSeries(m.data.Dump(), sel), nil
+}
+
 func (m *memRepository) CreateOrUpdate(metric models.Metrics) error {
 	const fn = "MemStorage.CreateOrUpdate"
 
-	if err := m.validateMetric(metric); err != nil {
-		return fmt.Errorf("%v: %v", fn, err)
+	if err := metric.Validate(); err != nil {
+		return fmt.Errorf("%v: %w", fn, err)
 	}
 
 	if err := m.data.Create(metric); err != nil {
-		return fmt.Errorf("%v: %v", fn, err)
+		return fmt.Errorf("%v: %w", fn, err)
 	}
 
 	//Да, я понимаю, что можно просто дописывать полученные даты в бек, но уже нету на это времени
@@ -81,6 +94,105 @@ func (m *memRepository) CreateOrUpdate(metric models.Metrics) error {
 	return nil
 }
 
+// Delete и Reset сразу пишут бекап: иначе после рестарта удалённая
+// или сброшенная метрика вернётся из последнего снимка.
+func (m *memRepository) Delete(metric models.Metrics) error {
+	const fn = "MemStorage.Delete"
+
+	if err := m.data.Delete(metric); err != nil {
+		return fmt.Errorf("%v: %w", fn, err)
+	}
+
+	if err := m.backup(); err != nil {
+		return fmt.Errorf("backup error: %v, %v", err, fn)
+	}
+
+	return nil
+}
+
+func (m *memRepository) Reset(metric models.Metrics) error {
+	const fn = "MemStorage.Reset"
+
+	if err := m.data.Reset(metric); err != nil {
+		return fmt.Errorf("%v: %w", fn, err)
+	}
+
+	if err := m.backup(); err != nil {
+		return fmt.Errorf("backup error: %v, %v", err, fn)
+	}
+
+	return nil
+}
+
+// Load, Replace и Drop применяют состояние, пришедшее с primary-узла при
+// репликации: метрики сохраняются как есть, вместе с временем обновления
+// и пометкой stale. Бекап пишется по расписанию: после рестарта реплика
+// всё равно начнёт со снимка primary.
+func (m *memRepository) Load(metric models.Metrics) error {
+	const fn = "MemStorage.Load"
+
+	if err := metric.Validate(); err != nil {
+		return fmt.Errorf("%v: %w", fn, err)
+	}
+
+	m.data.Load(metric)
+
+	return nil
+}
+
+func (m *memRepository) Replace(metrics []models.Metrics) error {
+	const fn = "MemStorage.Replace"
+
+	for _, metric := range metrics {
+		if err := metric.Validate(); err != nil {
+			return fmt.Errorf("%v: %w", fn, err)
+		}
+	}
+
+	m.data.Replace(metrics)
+
+	return nil
+}
+
+func (m *memRepository) Drop(metric models.Metrics) error {
+	const fn = "MemStorage.Drop"
+
+	if err := m.data.Delete(metric); err != nil && !errors.Is(err, mapstorage.ErrNotFound) {
+		return fmt.Errorf("%v: %v", fn, err)
+	}
+
+	return nil
+}
+
+func (m *memRepository) History(metric models.Metrics, since time.Time) ([]models.Point, error) {
+	const fn = "MemStorage.History"
+
+	points, err := m.data.History(metric, since)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", fn, err)
+	}
+
+	return points, nil
+}
+
+func (m *memRepository) MarkStale(before time.Time) (int, error) {
+	return m.data.Expire(before, false), nil
+}
+
+func (m *memRepository) DeleteStale(before time.Time) (int, error) {
+	const fn = "MemStorage.DeleteStale"
+
+	n := m.data.Expire(before, true)
+
+	if n > 0 && time.Duration(m.cfg.StoreInterval)*time.Second < 1 {
+		if err := m.backup(); err != nil {
+			return n, fmt.Errorf("backup error: %v, %v", err, fn)
+		}
+	}
+
+	return n, nil
+}
+
 func (m *memRepository) Close() error {
 	return m.backup()
 }
@@ -88,7 +200,7 @@ func (m *memRepository) Close() error {
 func (m *memRepository) Init(ctx context.Context) error {
 	const fn = "MemStorage.Init"
 
-	storage := mapstorage.New()
+	storage := mapstorage.New(m.cfg.HistoryRetention)
 
 	m.data = storage
 
@@ -116,23 +228,6 @@ func (m *memRepository) Check() error {
 	return nil
 }
 
-func (m *memRepository) validateMetric(metric models.Metrics) error {
-	switch metric.MType {
-	case gauge:
-		if metric.Value == nil {
-			return ErrNotCorrectMetricType
-		}
-	case counter:
-		if metric.Delta == nil {
-			return ErrNotCorrectMetricType
-		}
-	default:
-		return ErrNotCorrectMetricType
-	}
-
-	return nil
-}
-
 func (m *memRepository) restoreFromBak() error {
 	const fn = "MemStorage.restoreFromBak"
 
@@ -143,10 +238,18 @@ func (m *memRepository) restoreFromBak() error {
 	}
 
 	for _, item := range data {
-		if err := m.CreateOrUpdate(item); err != nil {
+		if err := item.Validate(); err != nil {
 			fmt.Printf("restore error: %v\n", err)
 			return err
 		}
+
+		// В старых бекапах времени обновления нет, считаем такие серии свежими.
+		if item.UpdatedAt == nil {
+			now := time.Now()
+			item.UpdatedAt = &now
+		}
+
+		m.data.Load(item)
 	}
 
 	return nil
@@ -0,0 +1,28 @@
+package memrepository
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	config "github.com/BeInBloom/spanish-inquisition/internal/config/server-config"
+	"github.com/BeInBloom/spanish-inquisition/internal/repository/repotest"
+)
+
+func TestConformance(t *testing.T) {
+	repotest.Run(t, repotest.Suite{
+		New: func(t *testing.T) repotest.Repository {
+			cfg := config.Config{}
+			cfg.BakConfig.Path = filepath.Join(t.TempDir(), "bak.json")
+			cfg.StoreInterval = 300
+
+			r := New(cfg)
+			if err := r.Init(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { r.Close() })
+
+			return r
+		},
+	})
+}
@@ -2,9 +2,13 @@ package repositoryfactory
 
 import (
 	"context"
+	"time"
 
 	config "github.com/BeInBloom/spanish-inquisition/internal/config/server-config"
 	"github.com/BeInBloom/spanish-inquisition/internal/models"
+	"github.com/BeInBloom/spanish-inquisition/internal/query"
+	cacherepository "github.com/BeInBloom/spanish-inquisition/internal/repository/cache_repository"
+	logrepository "github.com/BeInBloom/spanish-inquisition/internal/repository/log_repository"
 	"github.com/BeInBloom/spanish-inquisition/internal/repository/memrepository"
 	sqlrepository "github.com/BeInBloom/spanish-inquisition/internal/repository/sql_repository"
 )
@@ -13,12 +17,30 @@ type repository interface {
 	CreateOrUpdate(models.Metrics) error
 	Get(models.Metrics) (models.Metrics, error)
 	Dump() ([]models.Metrics, error)
+	List(query.Filter) (query.Page, error)
+	Aggregate(query.Aggregation) ([]query.Sample, error)
+	Select(query.Selector) ([]query.Sample, error)
+	History(item models.Metrics, since time.Time) ([]models.Point, error)
 	Check() error
+	Delete(models.Metrics) error
+	Reset(models.Metrics) error
+	MarkStale(before time.Time) (int, error)
+	DeleteStale(before time.Time) (int, error)
 	Init(context.Context) error
 	Close() error
 }
 
 func NewRepository(cfg config.Config) repository {
+	repo := newBackend(cfg)
+
+	if cfg.CacheConfig.Enabled {
+		return cacherepository.New(cfg.DBConfig, repo)
+	}
+
+	return repo
+}
+
+func newBackend(cfg config.Config) repository {
 	if cfg.DBConfig.Address != "" {
 		repo, err := newSQLRepository(cfg.DBConfig)
 		if err != nil {
@@ -28,6 +50,10 @@ func NewRepository(cfg config.Config) repository {
 		return repo
 	}
 
+	if cfg.LogStorageConfig.Dir != "" {
+		return newLogRepository(cfg.DBConfig)
+	}
+
 	return newMapRepository(cfg)
 }
 
@@ -35,6 +61,10 @@ func newMapRepository(cfg config.Config) repository {
 	return memrepository.New(cfg)
 }
 
+func newLogRepository(cfg config.DBConfig) repository {
+	return logrepository.New(cfg)
+}
+
 func newSQLRepository(cfg config.DBConfig) (repository, error) {
 	return sqlrepository.New(cfg)
 }
@@ -0,0 +1,558 @@
+// Package repotest — общий набор проверок для реализаций репозитория.
+// Каждое хранилище гоняет его в своих тестах, чтобы они не расходились
+// в поведении.
+package repotest
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/apperrors"
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+	"github.com/BeInBloom/spanish-inquisition/internal/query"
+)
+
+type Repository interface {
+	CreateOrUpdate(models.Metrics) error
+	Get(models.Metrics) (models.Metrics, error)
+	Dump() ([]models.Metrics, error)
+	Delete(models.Metrics) error
+	Reset(models.Metrics) error
+	List(query.Filter) (query.Page, error)
+	Select(query.Selector) ([]query.Sample, error)
+	Aggregate(query.Aggregation) ([]query.Sample, error)
+	History(item models.Metrics, since time.Time) ([]models.Point, error)
+	DeleteStale(before time.Time) (int, error)
+}
+
+type Suite struct {
+	// New возвращает готовый к работе репозиторий. Закрыть его
+	// должен сам New через t.Cleanup.
+	New func(t *testing.T) Repository
+}
+
+// Run гоняет проверки, каждую на свежем репозитории. Серии каждой
+// проверки живут под своим префиксом и удаляются в конце, так что
+// набор можно запускать и на общей базе.
+func Run(t *testing.T, s Suite) {
+	cases := []struct {
+		name string
+		f    func(t *testing.T, c *check)
+	}{
+		{"CounterAccumulates", testCounterAccumulates},
+		{"GaugeOverwrites", testGaugeOverwrites},
+		{"TypesAreSeparate", testTypesAreSeparate},
+		{"Validation", testValidation},
+		{"NotFound", testNotFound},
+		{"Reset", testReset},
+		{"Concurrency", testConcurrency},
+		{"DumpConsistency", testDumpConsistency},
+		{"ListMatch", testListMatch},
+		{"LabelMatchers", testLabelMatchers},
+		{"DeleteStaleHistory", testDeleteStaleHistory},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &check{
+				repo:   s.New(t),
+				prefix: fmt.Sprintf("conformance_%s_%d_", strings.ToLower(tc.name), time.Now().UnixNano()),
+			}
+			t.Cleanup(c.cleanup)
+
+			tc.f(t, c)
+		})
+	}
+}
+
+type check struct {
+	repo   Repository
+	prefix string
+}
+
+// Counter и Gauge собирают метрику для записи; ими пользуются и тесты
+// самих хранилищ.
+func Counter(id string, d int64) models.Metrics {
+	return models.Metrics{ID: id, MType: models.Counter, Delta: &d}
+}
+
+func Gauge(id string, v float64) models.Metrics {
+	return models.Metrics{ID: id, MType: models.Gauge, Value: &v}
+}
+
+func (c *check) counter(name string, d int64) models.Metrics {
+	return Counter(c.prefix+name, d)
+}
+
+func (c *check) gauge(name string, v float64) models.Metrics {
+	return Gauge(c.prefix+name, v)
+}
+
+func (c *check) write(t *testing.T, ms ...models.Metrics) {
+	t.Helper()
+
+	for _, m := range ms {
+		if err := c.repo.CreateOrUpdate(m); err != nil {
+			t.Fatalf("CreateOrUpdate(%s %s): %v", m.MType, m.ID, err)
+		}
+	}
+}
+
+func (c *check) get(t *testing.T, m models.Metrics) models.Metrics {
+	t.Helper()
+
+	got, err := c.repo.Get(models.Metrics{ID: m.ID, MType: m.MType})
+	if err != nil {
+		t.Fatalf("Get(%s %s): %v", m.MType, m.ID, err)
+	}
+
+	if got.ID != m.ID || got.MType != m.MType {
+		t.Fatalf("Get(%s %s): got series %s %s", m.MType, m.ID, got.MType, got.ID)
+	}
+
+	return got
+}
+
+// own возвращает серии этой проверки из Dump.
+func (c *check) own(t *testing.T) map[string]models.Metrics {
+	t.Helper()
+
+	all, err := c.repo.Dump()
+	if err != nil {
+		t.Fatalf("Dump: %v", err)
+	}
+
+	res := make(map[string]models.Metrics)
+	for _, m := range all {
+		if strings.HasPrefix(m.ID, c.prefix) {
+			res[m.MType+"/"+m.ID] = m
+		}
+	}
+
+	return res
+}
+
+func (c *check) cleanup() {
+	all, err := c.repo.Dump()
+	if err != nil {
+		return
+	}
+
+	for _, m := range all {
+		if strings.HasPrefix(m.ID, c.prefix) {
+			c.repo.Delete(m)
+		}
+	}
+}
+
+func testCounterAccumulates(t *testing.T, c *check) {
+	c.write(t, c.counter("requests", 3), c.counter("requests", 4), c.counter("requests", -2))
+
+	got := c.get(t, c.counter("requests", 0))
+	if got.Delta == nil || *got.Delta != 5 {
+		t.Fatalf("counter: got %+v, want delta 5", got)
+	}
+
+	if got.UpdatedAt == nil || got.Stale {
+		t.Fatalf("counter: got updated_at %v, stale %v", got.UpdatedAt, got.Stale)
+	}
+
+	// Прочитанное значение — снимок: следующая запись его не меняет.
+	c.write(t, c.counter("requests", 10))
+
+	if *got.Delta != 5 {
+		t.Fatalf("earlier Get result changed to %d", *got.Delta)
+	}
+
+	if now := c.get(t, c.counter("requests", 0)); *now.Delta != 15 {
+		t.Fatalf("counter: got %d, want 15", *now.Delta)
+	}
+}
+
+func testGaugeOverwrites(t *testing.T, c *check) {
+	c.write(t, c.gauge("load", 1.5), c.gauge("load", -0.25))
+
+	got := c.get(t, c.gauge("load", 0))
+	if got.Value == nil || *got.Value != -0.25 || got.Delta != nil {
+		t.Fatalf("gauge: got %+v, want value -0.25", got)
+	}
+
+	if got.UpdatedAt == nil {
+		t.Fatal("gauge: no updated_at")
+	}
+}
+
+func testTypesAreSeparate(t *testing.T, c *check) {
+	c.write(t, c.counter("x", 2), c.gauge("x", 9))
+
+	if got := c.get(t, c.counter("x", 0)); *got.Delta != 2 {
+		t.Fatalf("counter x: got %d, want 2", *got.Delta)
+	}
+
+	if got := c.get(t, c.gauge("x", 0)); *got.Value != 9 {
+		t.Fatalf("gauge x: got %v, want 9", *got.Value)
+	}
+}
+
+func testValidation(t *testing.T, c *check) {
+	invalid := []models.Metrics{
+		{ID: c.prefix + "no_delta", MType: models.Counter},
+		{ID: c.prefix + "no_value", MType: models.Gauge},
+		{ID: c.prefix + "histogram", MType: "histogram", Value: new(float64)},
+		{ID: c.prefix + "empty_type", Delta: new(int64)},
+		{ID: c.prefix + strings.Repeat("x", models.MaxIDLength), MType: models.Gauge, Value: new(float64)},
+	}
+
+	for _, m := range invalid {
+		if err := c.repo.CreateOrUpdate(m); !errors.Is(err, apperrors.ErrValidation) {
+			t.Errorf("CreateOrUpdate(%q %s): got %v, want validation error", m.MType, m.ID, err)
+		}
+	}
+
+	if got := c.own(t); len(got) != 0 {
+		t.Fatalf("invalid metrics were stored: %+v", got)
+	}
+}
+
+func testNotFound(t *testing.T, c *check) {
+	missing := c.counter("missing", 0)
+
+	if _, err := c.repo.Get(missing); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("Get: got %v, want not found", err)
+	}
+
+	if err := c.repo.Delete(missing); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("Delete: got %v, want not found", err)
+	}
+
+	if err := c.repo.Reset(missing); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("Reset: got %v, want not found", err)
+	}
+
+	// Серия того же имени, но другого типа — это другая серия.
+	c.write(t, c.gauge("missing", 1))
+
+	if _, err := c.repo.Get(missing); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("Get with other type: got %v, want not found", err)
+	}
+
+	if err := c.repo.Delete(c.gauge("missing", 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.repo.Get(c.gauge("missing", 0)); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("Get after Delete: got %v, want not found", err)
+	}
+}
+
+func testReset(t *testing.T, c *check) {
+	c.write(t, c.counter("requests", 7), c.gauge("load", 1))
+
+	if err := c.repo.Reset(c.counter("requests", 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := c.get(t, c.counter("requests", 0)); *got.Delta != 0 {
+		t.Fatalf("counter after Reset: got %d, want 0", *got.Delta)
+	}
+
+	if err := c.repo.Reset(c.gauge("load", 0)); !errors.Is(err, apperrors.ErrValidation) {
+		t.Fatalf("Reset of a gauge: got %v, want validation error", err)
+	}
+
+	c.write(t, c.counter("requests", 2))
+
+	if got := c.get(t, c.counter("requests", 0)); *got.Delta != 2 {
+		t.Fatalf("counter after Reset and write: got %d, want 2", *got.Delta)
+	}
+}
+
+func testConcurrency(t *testing.T, c *check) {
+	const (
+		workers = 8
+		writes  = 25
+	)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*writes*2)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+
+		go func(w int) {
+			defer wg.Done()
+
+			for i := 0; i < writes; i++ {
+				if err := c.repo.CreateOrUpdate(c.counter("shared", 1)); err != nil {
+					errs <- err
+				}
+
+				if err := c.repo.CreateOrUpdate(c.gauge(fmt.Sprintf("worker_%d", w), float64(i))); err != nil {
+					errs <- err
+				}
+			}
+		}(w)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	if got := c.get(t, c.counter("shared", 0)); *got.Delta != workers*writes {
+		t.Fatalf("shared counter: got %d, want %d", *got.Delta, workers*writes)
+	}
+
+	for w := 0; w < workers; w++ {
+		if got := c.get(t, c.gauge(fmt.Sprintf("worker_%d", w), 0)); *got.Value != writes-1 {
+			t.Fatalf("worker_%d gauge: got %v, want %d", w, *got.Value, writes-1)
+		}
+	}
+}
+
+func testDumpConsistency(t *testing.T, c *check) {
+	c.write(t,
+		c.counter("a", 1), c.counter("a", 2),
+		c.counter("b", 5),
+		c.gauge("a", 0.5),
+		c.gauge("c", 3), c.gauge("c", 4),
+	)
+
+	if err := c.repo.Delete(c.counter("b", 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	dump := c.own(t)
+
+	want := map[string]models.Metrics{
+		"counter/" + c.prefix + "a": c.counter("a", 3),
+		"gauge/" + c.prefix + "a":   c.gauge("a", 0.5),
+		"gauge/" + c.prefix + "c":   c.gauge("c", 4),
+	}
+
+	if len(dump) != len(want) {
+		t.Fatalf("Dump: got %d series, want %d: %+v", len(dump), len(want), dump)
+	}
+
+	for key, w := range want {
+		d, ok := dump[key]
+		if !ok {
+			t.Fatalf("Dump: no %s", key)
+		}
+
+		if !sameValue(d, w) {
+			t.Fatalf("Dump %s: got %+v, want %+v", key, d, w)
+		}
+
+		if g := c.get(t, w); !sameValue(g, d) {
+			t.Fatalf("Get %s disagrees with Dump: %+v vs %+v", key, g, d)
+		}
+	}
+}
+
+func sameValue(a, b models.Metrics) bool {
+	if (a.Delta == nil) != (b.Delta == nil) || (a.Value == nil) != (b.Value == nil) {
+		return false
+	}
+
+	if a.Delta != nil && *a.Delta != *b.Delta {
+		return false
+	}
+
+	return a.Value == nil || *a.Value == *b.Value
+}
+
+// testListMatch проверяет, что регулярка листинга понимается одинаково
+// всеми хранилищами: синтаксис Go, а не диалект базы.
+func testListMatch(t *testing.T, c *check) {
+	c.write(t,
+		c.gauge("load", 1),
+		c.gauge("loader", 2),
+		c.gauge(`load{host="a"}`, 3),
+		c.counter("requests", 1),
+	)
+
+	want := []string{c.prefix + "load", c.prefix + `load{host="a"}`}
+
+	var (
+		got    []string
+		cursor string
+	)
+
+	// Листаем по одной, чтобы заодно проверить курсор поверх регулярки.
+	for i := 0; ; i++ {
+		if i > len(want) {
+			t.Fatalf("List: too many pages, got %v", got)
+		}
+
+		page, err := c.repo.List(query.Filter{
+			Prefix: c.prefix,
+			Match:  `load\b`,
+			Sort:   query.SortID,
+			Limit:  1,
+			Cursor: cursor,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, m := range page.Metrics {
+			got = append(got, m.ID)
+		}
+
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("List: got %v, want %v", got, want)
+	}
+}
+
+// testLabelMatchers проверяет матчеры на значениях, которые в ID хранятся
+// экранированными: сравниваться должно исходное значение метки.
+func testLabelMatchers(t *testing.T, c *check) {
+	name := c.prefix + "requests"
+
+	paths := map[string]float64{
+		`say "hi"`:   1,
+		`C:\tmp`:     2,
+		"two\nlines": 4,
+		"plain":      8,
+	}
+
+	for path, v := range paths {
+		c.write(t, models.Metrics{
+			ID:    models.SeriesID(name, map[string]string{"path": path}),
+			MType: models.Gauge,
+			Value: &v,
+		})
+	}
+
+	tests := []struct {
+		op, value string
+		want      []string
+	}{
+		{"=", `C:\tmp`, []string{`C:\tmp`}},
+		{"!=", "plain", []string{`C:\tmp`, `say "hi"`, "two\nlines"}},
+		{"=~", `say "hi"`, []string{`say "hi"`}},
+		{"=~", `C:\\tmp`, []string{`C:\tmp`}},
+		{"=~", "two\nlines", []string{"two\nlines"}},
+		{"=~", "pla", nil},
+		{"!~", `plain|C:\\.*|.*"hi"`, []string{"two\nlines"}},
+	}
+
+	for _, tt := range tests {
+		selector := fmt.Sprintf("%s{path%s%q}", name, tt.op, tt.value)
+
+		expr, err := query.Parse(selector)
+		if err != nil {
+			t.Fatalf("Parse(%s): %v", selector, err)
+		}
+
+		samples, err := c.repo.Select(expr.(query.Selector))
+		if err != nil {
+			t.Fatalf("Select(%s): %v", selector, err)
+		}
+
+		var got []string
+		for _, s := range samples {
+			got = append(got, s.Labels["path"])
+		}
+
+		if !sameStrings(got, tt.want) {
+			t.Errorf("Select(%s): got %q, want %q", selector, got, tt.want)
+		}
+
+		var sum float64
+		for _, p := range tt.want {
+			sum += paths[p]
+		}
+
+		expr, err = query.Parse("sum(" + selector + ")")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		samples, err = c.repo.Aggregate(expr.(query.Aggregation))
+		if err != nil {
+			t.Fatalf("Aggregate(sum(%s)): %v", selector, err)
+		}
+
+		if len(tt.want) == 0 {
+			if len(samples) != 0 {
+				t.Errorf("Aggregate(sum(%s)): got %+v, want nothing", selector, samples)
+			}
+
+			continue
+		}
+
+		if len(samples) != 1 || samples[0].Value != sum || samples[0].Series != len(tt.want) {
+			t.Errorf("Aggregate(sum(%s)): got %+v, want %v over %d series", selector, samples, sum, len(tt.want))
+		}
+
+		expr, err = query.Parse("count(" + selector + ") by (path)")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		samples, err = c.repo.Aggregate(expr.(query.Aggregation))
+		if err != nil {
+			t.Fatalf("Aggregate(count by path(%s)): %v", selector, err)
+		}
+
+		got = got[:0]
+		for _, s := range samples {
+			got = append(got, s.Labels["path"])
+		}
+
+		if !sameStrings(got, tt.want) {
+			t.Errorf("Aggregate(count by path(%s)): got groups %q, want %q", selector, got, tt.want)
+		}
+	}
+}
+
+// testDeleteStaleHistory проверяет, что удалённая по TTL серия уносит
+// с собой историю и вернувшаяся серия начинает её заново.
+func testDeleteStaleHistory(t *testing.T, c *check) {
+	c.write(t, c.counter("requests", 5), c.counter("requests", 7))
+
+	time.Sleep(10 * time.Millisecond)
+
+	if n, err := c.repo.DeleteStale(time.Now()); err != nil || n < 1 {
+		t.Fatalf("DeleteStale: got %d, %v", n, err)
+	}
+
+	if _, err := c.repo.Get(c.counter("requests", 0)); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Fatalf("Get after DeleteStale: got %v, want not found", err)
+	}
+
+	c.write(t, c.counter("requests", 2))
+
+	points, err := c.repo.History(c.counter("requests", 0), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(points) != 1 || points[0].Value != 2 {
+		t.Fatalf("History: got %+v, want one point with value 2", points)
+	}
+}
+
+func sameStrings(a, b []string) bool {
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+
+	return strings.Join(a, "\x00") == strings.Join(b, "\x00")
+}
@@ -0,0 +1,48 @@
+package sqlrepository
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	config "github.com/BeInBloom/spanish-inquisition/internal/config/server-config"
+	"github.com/BeInBloom/spanish-inquisition/internal/repository/repotest"
+)
+
+func conformance(t *testing.T, cfg func(t *testing.T) config.DBConfig) {
+	repotest.Run(t, repotest.Suite{
+		New: func(t *testing.T) repotest.Repository {
+			r, err := New(cfg(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { r.Close() })
+
+			if err := r.Init(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			return r
+		},
+	})
+}
+
+func TestConformance_SQLite(t *testing.T) {
+	conformance(t, func(t *testing.T) config.DBConfig {
+		return config.DBConfig{DriverName: "sqlite", Address: filepath.Join(t.TempDir(), "metrics.db")}
+	})
+}
+
+// Postgres проверяется, только если задан DATABASE_DSN. Набор пишет
+// серии под своим префиксом и удаляет их, чужие данные не трогает.
+func TestConformance_Postgres(t *testing.T) {
+	dsn := os.Getenv("DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("DATABASE_DSN is not set")
+	}
+
+	conformance(t, func(t *testing.T) config.DBConfig {
+		return config.DBConfig{DriverName: "pgx", Address: dsn}
+	})
+}
@@ -0,0 +1,111 @@
+package sqlrepository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/apperrors"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+var (
+	ErrUnknownDriver = errors.New("unknown database driver")
+)
+
+// dialect собирает то, чем базы расходятся: схему, плейсхолдеры,
+// доставание метки из ID и коды ошибок. Всё остальное — общий SQL.
+type dialect struct {
+	name        string
+	driver      string
+	placeholder sq.PlaceholderFormat
+	schema      []string
+
+	// labelExpr возвращает выражение с экранированным значением метки
+	// (пустая строка, если метки нет) и его аргументы.
+	labelExpr func(label string) (string, []any)
+	// errKind относит ошибку драйвера к apperrors.ErrUnavailable (сбой,
+	// который стоит повторить) или apperrors.ErrValidation (база отвергла
+	// данные). nil — ни то ни другое.
+	errKind func(err error) error
+
+	// prepare донастраивает DSN и пул соединений.
+	prepare func(dsn string) string
+	tune    func(db *sql.DB)
+}
+
+func dialectFor(driver string) (dialect, error) {
+	switch driver {
+	case "", "pgx", "postgres":
+		return postgres, nil
+	case "sqlite":
+		return sqlite, nil
+	default:
+		return dialect{}, fmt.Errorf("%w: %q", ErrUnknownDriver, driver)
+	}
+}
+
+var postgres = dialect{
+	name:        "postgres",
+	driver:      "pgx",
+	placeholder: sq.Dollar,
+	schema: []string{
+		`CREATE TABLE IF NOT EXISTS metric (
+            id VARCHAR(255) NOT NULL,
+            type VARCHAR(7) NOT NULL CHECK (type IN ('gauge', 'counter')),
+            delta BIGINT,
+            value DOUBLE PRECISION,
+            PRIMARY KEY (id, type)
+        )`,
+		`ALTER TABLE metric ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now()`,
+		`ALTER TABLE metric ADD COLUMN IF NOT EXISTS stale BOOLEAN NOT NULL DEFAULT false`,
+		`CREATE TABLE IF NOT EXISTS metric_history (
+            id VARCHAR(255) NOT NULL,
+            ts TIMESTAMPTZ NOT NULL,
+            value DOUBLE PRECISION NOT NULL
+        )`,
+		`CREATE INDEX IF NOT EXISTS metric_history_id_ts ON metric_history (id, ts)`,
+	},
+	labelExpr: func(label string) (string, []any) {
+		return "COALESCE(substring(id from ?::text), '')", []any{labelPattern(label)}
+	},
+	errKind: postgresErrKind,
+	prepare: func(dsn string) string { return dsn },
+	tune:    func(db *sql.DB) {},
+}
+
+// postgresErrKind смотрит на класс SQLSTATE: 08 — соединение, 40 —
+// откат из-за конкурентной транзакции, 53 и 57 — нехватка ресурсов
+// и остановка сервера; 22 и 23 — данные не влезли в колонку или нарушили
+// ограничение.
+func postgresErrKind(err error) error {
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) || pgconn.SafeToRetry(err) || pgconn.Timeout(err) {
+		return apperrors.ErrUnavailable
+	}
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return nil
+	}
+
+	switch {
+	case strings.HasPrefix(pgErr.Code, "08"), strings.HasPrefix(pgErr.Code, "40"),
+		strings.HasPrefix(pgErr.Code, "53"), strings.HasPrefix(pgErr.Code, "57"):
+		return apperrors.ErrUnavailable
+	case strings.HasPrefix(pgErr.Code, "22"), strings.HasPrefix(pgErr.Code, "23"):
+		return apperrors.ErrValidation
+	default:
+		return nil
+	}
+}
+
+// labelPattern — регулярка Postgres, первая группа которой ловит
+// экранированное значение метки из ID вида name{k="v",...}.
+func labelPattern(label string) string {
+	return `[{,]` + regexp.QuoteMeta(label) + `="((?:[^"\\]|\\.)*)"`
+}
@@ -3,49 +3,131 @@ package sqlrepository
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/BeInBloom/spanish-inquisition/internal/apperrors"
 	config "github.com/BeInBloom/spanish-inquisition/internal/config/server-config"
 	"github.com/BeInBloom/spanish-inquisition/internal/models"
+	"github.com/BeInBloom/spanish-inquisition/internal/query"
 	"github.com/BeInBloom/spanish-inquisition/internal/wrappers"
 	sq "github.com/Masterminds/squirrel"
-	_ "github.com/jackc/pgx/v5/stdlib"
 )
 
 var (
-	ErrCantOpenDB           = errors.New("can't open db")
-	ErrNotCorrectType       = errors.New("not correct type")
-	ErrNotCorrectMetricType = errors.New("not correct metric type")
-	ErrRepoNotFound         = errors.New("repository not found")
+	ErrCantOpenDB = errors.New("can't open db")
 )
 
+// Запросы пишутся с плейсхолдерами "?", builder и rebind переводят их
+// в формат нужной базы.
 type sqlRepository struct {
-	db *sql.DB
+	db               *sql.DB
+	dialect          dialect
+	builder          sq.StatementBuilderType
+	historyRetention time.Duration
 }
 
 func New(cfg config.DBConfig) (*sqlRepository, error) {
-	db, err := sql.Open(cfg.DriverName, cfg.Address)
+	d, err := dialectFor(cfg.DriverName)
 	if err != nil {
 		return nil, errors.Join(ErrCantOpenDB, err)
 	}
 
+	db, err := sql.Open(d.driver, d.prepare(cfg.Address))
+	if err != nil {
+		return nil, errors.Join(ErrCantOpenDB, err)
+	}
+
+	d.tune(db)
+
 	if err := db.Ping(); err != nil {
 		return nil, errors.Join(ErrCantOpenDB, err)
 	}
 
+	historyRetention := cfg.HistoryRetention
+	if historyRetention <= 0 {
+		historyRetention = time.Hour
+	}
+
 	return &sqlRepository{
-		db: db,
+		db:               db,
+		dialect:          d,
+		builder:          sq.StatementBuilder.PlaceholderFormat(d.placeholder),
+		historyRetention: historyRetention,
 	}, nil
 }
 
+func (r *sqlRepository) rebind(query string) string {
+	query, _ = r.dialect.placeholder.ReplacePlaceholders(query)
+	return query
+}
+
+// retry повторяет запрос к базе, пока ошибка похожа на сбой соединения
+// или временную блокировку; если база так и не ответила, это недоступность
+// хранилища. Остальные ошибки не повторяются: отвергнутые базой данные —
+// ошибка запроса, всё прочее — внутренняя ошибка.
+func (r *sqlRepository) retry(f func() error) error {
+	var final error
+
+	g := func() error {
+		final = nil
+
+		err := f()
+		if err == nil {
+			return nil
+		}
+
+		switch kind := r.errKind(err); kind {
+		case apperrors.ErrUnavailable:
+			return err
+		case nil:
+			final = err
+		default:
+			final = apperrors.Wrap(kind, err)
+		}
+
+		return nil
+	}
+
+	if err := wrappers.RetryWrapper(g, 3, 2*time.Second); err != nil {
+		return apperrors.Wrap(apperrors.ErrUnavailable, err)
+	}
+
+	return final
+}
+
+// errKind добавляет к ошибкам диалекта общие для database/sql сбои
+// соединения.
+func (r *sqlRepository) errKind(err error) error {
+	var netErr net.Error
+
+	switch {
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, sql.ErrConnDone),
+		errors.Is(err, context.DeadlineExceeded), errors.Is(err, io.ErrUnexpectedEOF),
+		errors.As(err, &netErr):
+		return apperrors.ErrUnavailable
+	default:
+		return r.dialect.errKind(err)
+	}
+}
+
 func (r *sqlRepository) Close() error {
 	return r.db.Close()
 }
 
 func (r *sqlRepository) Check() error {
-	return r.db.Ping()
+	if err := r.db.Ping(); err != nil {
+		return apperrors.Wrap(apperrors.ErrUnavailable, err)
+	}
+
+	return nil
 }
 
 func (r *sqlRepository) Dump() ([]models.Metrics, error) {
@@ -54,17 +136,17 @@ func (r *sqlRepository) Dump() ([]models.Metrics, error) {
 	var res []models.Metrics
 
 	f := func() error {
-		query := sq.Select("id", "type", "delta", "value").
+		query := r.builder.Select("id", "type", "delta", "value", "updated_at", "stale").
 			From("metric")
 
 		sqlQuery, args, err := query.ToSql()
 		if err != nil {
-			return fmt.Errorf("%v: %v", fn, err)
+			return fmt.Errorf("%v: %w", fn, err)
 		}
 
 		rows, err := r.db.Query(sqlQuery, args...)
 		if err != nil {
-			return fmt.Errorf("%v: %v", fn, err)
+			return fmt.Errorf("%v: %w", fn, err)
 		}
 
 		defer rows.Close()
@@ -72,57 +154,388 @@ func (r *sqlRepository) Dump() ([]models.Metrics, error) {
 		for rows.Next() {
 			var m models.Metrics
 
-			if err := rows.Scan(&m.ID, &m.MType, &m.Delta, &m.Value); err != nil {
-				return fmt.Errorf("%v: %v", fn, err)
+			if err := rows.Scan(&m.ID, &m.MType, &m.Delta, &m.Value, &m.UpdatedAt, &m.Stale); err != nil {
+				return fmt.Errorf("%v: %w", fn, err)
 			}
 
 			res = append(res, m)
 		}
 
 		if err := rows.Err(); err != nil {
-			return fmt.Errorf("%v: %v", fn, err)
+			return fmt.Errorf("%v: %w", fn, err)
 		}
 
 		return nil
 	}
 
-	if err := wrappers.RetryWrapper(f, 3, 2*time.Second); err != nil {
+	if err := r.retry(f); err != nil {
 		return nil, err
 	}
 
 	return res, nil
 }
 
+// List фильтрует и листает метрики средствами базы: keyset-пагинация
+// по тем же колонкам, по которым идёт сортировка. Регулярка match
+// проверяется на Go, а не в базе: у регулярок Postgres другой синтаксис
+// (например, \b там — backspace), и результат разошёлся бы с другими
+// хранилищами. База при этом отдаёт строки уже по порядку, так что
+// чтение прекращается, как только набралась страница.
+func (r *sqlRepository) List(f query.Filter) (query.Page, error) {
+	const fn = "sqlRepository.List"
+
+	if err := f.Validate(); err != nil {
+		return query.Page{}, fmt.Errorf("%v: %w", fn, err)
+	}
+
+	cursor, _ := f.DecodeCursor()
+	match := regexp.MustCompile(f.Match)
+
+	q := r.builder.Select("id", "type", "delta", "value", "updated_at", "stale").
+		From("metric")
+
+	if f.Type != "" {
+		q = q.Where(sq.Eq{"type": f.Type})
+	}
+
+	if f.Prefix != "" {
+		q = q.Where(idPrefix(f.Prefix))
+	}
+
+	var columns []string
+
+	switch f.Field() {
+	case query.SortType:
+		columns = []string{"type", "id"}
+	case query.SortUpdatedAt:
+		columns = []string{"updated_at", "type", "id"}
+	default:
+		columns = []string{"id", "type"}
+	}
+
+	op, dir := ">", "ASC"
+	if f.Desc() {
+		op, dir = "<", "DESC"
+	}
+
+	if cursor != nil {
+		values := map[string]any{"id": cursor.ID, "type": cursor.Type, "updated_at": cursor.UpdatedAt.UTC()}
+
+		args := make([]any, 0, len(columns))
+		for _, c := range columns {
+			args = append(args, values[c])
+		}
+
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+		q = q.Where(fmt.Sprintf("(%s) %s (%s)", strings.Join(columns, ", "), op, placeholders), args...)
+	}
+
+	for _, c := range columns {
+		q = q.OrderBy(c + " " + dir)
+	}
+
+	if f.Match == "" {
+		q = q.Limit(uint64(f.Limit) + 1)
+	}
+
+	sqlQuery, args, err := q.ToSql()
+	if err != nil {
+		return query.Page{}, fmt.Errorf("%v: %w", fn, err)
+	}
+
+	var res []models.Metrics
+
+	g := func() error {
+		res = res[:0]
+
+		rows, err := r.db.Query(sqlQuery, args...)
+		if err != nil {
+			return fmt.Errorf("%v: %w", fn, err)
+		}
+
+		defer rows.Close()
+
+		for rows.Next() {
+			var m models.Metrics
+
+			if err := rows.Scan(&m.ID, &m.MType, &m.Delta, &m.Value, &m.UpdatedAt, &m.Stale); err != nil {
+				return fmt.Errorf("%v: %w", fn, err)
+			}
+
+			if !match.MatchString(m.ID) {
+				continue
+			}
+
+			res = append(res, m)
+			if len(res) > f.Limit {
+				break
+			}
+		}
+
+		return rows.Err()
+	}
+
+	if err := r.retry(g); err != nil {
+		return query.Page{}, err
+	}
+
+	page := query.Page{Metrics: res}
+
+	if len(res) > f.Limit {
+		page.Metrics = res[:f.Limit]
+		page.NextCursor = f.EncodeCursor(page.Metrics[f.Limit-1])
+	}
+
+	if page.Metrics == nil {
+		page.Metrics = []models.Metrics{}
+	}
+
+	return page, nil
+}
+
+// Aggregate считает агрегацию агрегатными функциями базы. Регулярки
+// в матчерах база не проверяет (см. selectorWhere), поэтому с ними серии
+// выбираются из базы и агрегируются на Go.
+func (r *sqlRepository) Aggregate(agg query.Aggregation) ([]query.Sample, error) {
+	const fn = "sqlRepository.Aggregate"
+
+	var aggExpr string
+
+	switch agg.Op {
+	case query.AggSum:
+		aggExpr = "SUM(COALESCE(value, CAST(delta AS DOUBLE PRECISION)))"
+	case query.AggAvg:
+		aggExpr = "AVG(COALESCE(value, CAST(delta AS DOUBLE PRECISION)))"
+	case query.AggMin:
+		aggExpr = "MIN(COALESCE(value, CAST(delta AS DOUBLE PRECISION)))"
+	case query.AggMax:
+		aggExpr = "MAX(COALESCE(value, CAST(delta AS DOUBLE PRECISION)))"
+	case query.AggCount:
+		aggExpr = "CAST(COUNT(*) AS DOUBLE PRECISION)"
+	default:
+		return nil, fmt.Errorf("%v: %w: %q", fn, query.ErrBadExpr, agg.Op)
+	}
+
+	if hasRegexp(agg.Selector) {
+		metrics, err := r.selectMetrics(fn, agg.Selector)
+		if err != nil {
+			return nil, err
+		}
+
+		return query.Evaluate(metrics, agg), nil
+	}
+
+	q := r.selectorWhere(r.builder.Select().From("metric"), agg.Selector)
+
+	groupBy := make([]string, 0, len(agg.By))
+
+	for i, l := range agg.By {
+		expr, args := r.dialect.labelExpr(l)
+		q = q.Column(sq.Expr(expr, args...))
+		groupBy = append(groupBy, fmt.Sprint(i+1))
+	}
+
+	q = q.Column(aggExpr).Column("COUNT(*)")
+
+	if len(groupBy) > 0 {
+		q = q.GroupBy(groupBy...).OrderBy(groupBy...)
+	}
+
+	sqlQuery, args, err := q.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", fn, err)
+	}
+
+	var res []query.Sample
+
+	f := func() error {
+		res = res[:0]
+
+		rows, err := r.db.Query(sqlQuery, args...)
+		if err != nil {
+			return fmt.Errorf("%v: %w", fn, err)
+		}
+
+		defer rows.Close()
+
+		for rows.Next() {
+			values := make([]string, len(agg.By))
+
+			var value sql.NullFloat64
+			var series int
+
+			dest := make([]any, 0, len(agg.By)+2)
+			for i := range values {
+				dest = append(dest, &values[i])
+			}
+			dest = append(dest, &value, &series)
+
+			if err := rows.Scan(dest...); err != nil {
+				return fmt.Errorf("%v: %w", fn, err)
+			}
+
+			if series == 0 {
+				continue
+			}
+
+			labels := make(map[string]string, len(agg.By))
+			for i, l := range agg.By {
+				labels[l] = models.UnescapeLabelValue(values[i])
+			}
+
+			res = append(res, query.Sample{Labels: labels, Value: value.Float64, Series: series})
+		}
+
+		return rows.Err()
+	}
+
+	if err := r.retry(f); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Select отдаёт значения всех серий под селектором, метки разбираются из ID.
+func (r *sqlRepository) Select(sel query.Selector) ([]query.Sample, error) {
+	const fn = "sqlRepository.Select"
+
+	metrics, err := r.selectMetrics(fn, sel)
+	if err != nil {
+		return nil, err
+	}
+
+	return query.SelectSeries(metrics, sel), nil
+}
+
+// selectMetrics достаёт серии, отобранные selectorWhere. Окончательно
+// селектор проверяется уже на Go, в query.
+func (r *sqlRepository) selectMetrics(fn string, sel query.Selector) ([]models.Metrics, error) {
+	q := r.selectorWhere(r.builder.Select("id", "delta", "value").From("metric"), sel)
+
+	sqlQuery, args, err := q.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", fn, err)
+	}
+
+	var res []models.Metrics
+
+	f := func() error {
+		res = res[:0]
+
+		rows, err := r.db.Query(sqlQuery, args...)
+		if err != nil {
+			return fmt.Errorf("%v: %w", fn, err)
+		}
+
+		defer rows.Close()
+
+		for rows.Next() {
+			var m models.Metrics
+
+			if err := rows.Scan(&m.ID, &m.Delta, &m.Value); err != nil {
+				return fmt.Errorf("%v: %w", fn, err)
+			}
+
+			res = append(res, m)
+		}
+
+		return rows.Err()
+	}
+
+	if err := r.retry(f); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// selectorWhere добавляет к запросу условия селектора: имя до меток
+// и матчеры = и != по меткам, вытащенным из ID. Экранированные значения
+// сравниваются так же точно, как исходные, а регулярки — нет: они
+// проверяются на Go по разэкранированному значению и в синтаксисе RE2.
+func (r *sqlRepository) selectorWhere(q sq.SelectBuilder, sel query.Selector) sq.SelectBuilder {
+	q = q.Where(sq.Or{
+		sq.Eq{"id": sel.Name},
+		idPrefix(sel.Name + "{"),
+	})
+
+	for _, m := range sel.Matchers {
+		label, args := r.dialect.labelExpr(m.Label)
+
+		switch m.Op {
+		case query.MatchEqual:
+			q = q.Where(label+" = ?", append(args, models.EscapeLabelValue(m.Value))...)
+		case query.MatchNotEqual:
+			q = q.Where(label+" <> ?", append(args, models.EscapeLabelValue(m.Value))...)
+		}
+	}
+
+	return q
+}
+
+func hasRegexp(sel query.Selector) bool {
+	for _, m := range sel.Matchers {
+		if m.Op == query.MatchRegexp || m.Op == query.MatchNotRegexp {
+			return true
+		}
+	}
+
+	return false
+}
+
+// idPrefix сравнивает начало ID без LIKE: у баз разные правила
+// экранирования и регистра в LIKE.
+func idPrefix(prefix string) sq.Sqlizer {
+	return sq.Expr("substr(id, 1, ?) = ?", utf8.RuneCountInString(prefix), prefix)
+}
+
 func (r *sqlRepository) Get(m models.Metrics) (models.Metrics, error) {
 	const fn = "sqlRepository.Get"
 	const query = `
-		SELECT id, type, delta, value
+		SELECT id, type, delta, value, updated_at, stale
 		FROM metric
-		WHERE id = $1 AND type = $2`
+		WHERE id = ? AND type = ?`
 
-	var metric models.Metrics
+	var (
+		metric   models.Metrics
+		notFound bool
+	)
 
+	// Отсутствие строки — ответ, а не сбой, его не повторяем.
 	f := func() error {
-		row := r.db.QueryRow(query, m.ID, m.MType)
-		if err := row.Scan(&m.ID, &metric.MType, &metric.Delta, &metric.Value); err != nil {
-			return fmt.Errorf("%v: %v", fn, err)
+		row := r.db.QueryRow(r.rebind(query), m.ID, m.MType)
+
+		err := row.Scan(&metric.ID, &metric.MType, &metric.Delta, &metric.Value, &metric.UpdatedAt, &metric.Stale)
+		if errors.Is(err, sql.ErrNoRows) {
+			notFound = true
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%v: %w", fn, err)
 		}
 
 		return nil
 	}
 
-	if err := wrappers.RetryWrapper(f, 3, 2*time.Second); err != nil {
+	if err := r.retry(f); err != nil {
 		return models.Metrics{}, err
 	}
 
+	if notFound {
+		return models.Metrics{}, fmt.Errorf("%v: %w", fn, models.ErrMetricNotFound)
+	}
+
 	return metric, nil
 }
 
-func (r *sqlRepository) CreateOrUpdate(m models.Metrics) error {
-	const query = `
-        INSERT INTO metric (id, type, delta, value)
-        VALUES ($1, $2, $3, $4)
+const (
+	upsertQuery = `
+        INSERT INTO metric (id, type, delta, value, updated_at, stale)
+        VALUES (?, ?, ?, ?, ?, ?)
         ON CONFLICT (id, type) DO UPDATE SET
+            updated_at = EXCLUDED.updated_at,
+            stale = EXCLUDED.stale,
             delta = CASE
                 WHEN metric.type = 'counter' THEN COALESCE(metric.delta, 0) + COALESCE(EXCLUDED.delta, 0)
                 ELSE EXCLUDED.delta
@@ -130,55 +543,132 @@ func (r *sqlRepository) CreateOrUpdate(m models.Metrics) error {
             value = CASE
                 WHEN metric.type = 'gauge' THEN EXCLUDED.value
                 ELSE metric.value
-            END;
-    `
+            END
+        RETURNING delta`
+	pruneHistoryQuery  = `DELETE FROM metric_history WHERE id = ? AND ts < ?`
+	insertHistoryQuery = `INSERT INTO metric_history (id, ts, value) VALUES (?, ?, ?)`
+)
 
-	if err := r.validateMetric(m); err != nil {
+// CreateOrUpdate заодно пишет накопленное значение counter'а в metric_history
+// и чистит его историю старше historyRetention.
+func (r *sqlRepository) CreateOrUpdate(m models.Metrics) error {
+	if err := m.Validate(); err != nil {
 		return fmt.Errorf("failed to create or update metric: %w", err)
 	}
 
 	f := func() error {
-		var delta sql.NullInt64
-		var value sql.NullFloat64
-
-		if m.Delta != nil {
-			delta = sql.NullInt64{Int64: *m.Delta, Valid: true}
+		if err := r.inTx(func(tx *sql.Tx) error { return r.upsert(tx, m, time.Now().UTC()) }); err != nil {
+			fmt.Printf("failed to create or update metric: %v\n", err)
+			return fmt.Errorf("failed to create or update metric: %w", err)
 		}
-		if m.Value != nil {
-			value = sql.NullFloat64{Float64: *m.Value, Valid: true}
+
+		return nil
+	}
+
+	if err := r.retry(f); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// CreateOrUpdateBatch пишет пачку одной транзакцией: либо вся, либо ничего.
+func (r *sqlRepository) CreateOrUpdateBatch(ms []models.Metrics) error {
+	const fn = "sqlRepository.CreateOrUpdateBatch"
+
+	for _, m := range ms {
+		if err := m.Validate(); err != nil {
+			return fmt.Errorf("%v: %w", fn, err)
 		}
+	}
+
+	f := func() error {
+		now := time.Now().UTC()
 
-		_, err := r.db.Exec(query, m.ID, m.MType, delta, value)
+		err := r.inTx(func(tx *sql.Tx) error {
+			for _, m := range ms {
+				if err := r.upsert(tx, m, now); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
 		if err != nil {
-			fmt.Printf("failed to create or update metric: %v\n", err)
-			return fmt.Errorf("failed to create or update metric: %w", err)
+			return fmt.Errorf("%v: %w", fn, err)
 		}
 
 		return nil
 	}
 
-	if err := wrappers.RetryWrapper(f, 3, 2*time.Second); err != nil {
+	if err := r.retry(f); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+func (r *sqlRepository) upsert(tx *sql.Tx, m models.Metrics, now time.Time) error {
+	var delta sql.NullInt64
+	var value sql.NullFloat64
+
+	if m.Delta != nil {
+		delta = sql.NullInt64{Int64: *m.Delta, Valid: true}
+	}
+	if m.Value != nil {
+		value = sql.NullFloat64{Float64: *m.Value, Valid: true}
+	}
+
+	var total sql.NullInt64
+
+	row := tx.QueryRow(r.rebind(upsertQuery), m.ID, m.MType, delta, value, now, false)
+	if err := row.Scan(&total); err != nil {
+		return err
+	}
+
+	if m.MType != models.Counter {
+		return nil
+	}
+
+	if _, err := tx.Exec(r.rebind(pruneHistoryQuery), m.ID, now.Add(-r.historyRetention)); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(r.rebind(insertHistoryQuery), m.ID, now, float64(total.Int64))
+
+	return err
+}
+
+// inTx выполняет f в транзакции и откатывает её при ошибке.
+func (r *sqlRepository) inTx(f func(tx *sql.Tx) error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := f(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
 // func (r *sqlRepository) CreateOrUpdate(m models.Metrics) error {
 // 	const fn = "sqlRepository.CreateOrUpdate"
 
-// 	if err := r.validateMetric(m); err != nil {
-// 		return fmt.Errorf("%v: %v", fn, err)
+// 	if err := m.Validate(); err != nil {
+// 		return fmt.Errorf("%v: %w", fn, err)
 // 	}
 
 // 	var deltaValue sql.NullInt64
 // 	var floatValue sql.NullFloat64
 
 // 	if err := deltaValue.Scan(m.Delta); err != nil {
-// 		return fmt.Errorf("%v: %v", fn, err)
+// 		return fmt.Errorf("%v: %w", fn, err)
 // 	}
 // 	if err := floatValue.Scan(m.Value); err != nil {
-// 		return fmt.Errorf("%v: %v", fn, err)
+// 		return fmt.Errorf("%v: %w", fn, err)
 // 	}
 
 // 	query := sq.Insert("metric").
@@ -190,48 +680,242 @@ func (r *sqlRepository) CreateOrUpdate(m models.Metrics) error {
 
 // 	sqlQuery, args, err := query.ToSql()
 // 	if err != nil {
-// 		return fmt.Errorf("%v: %v", fn, err)
+// 		return fmt.Errorf("%v: %w", fn, err)
 // 	}
 
 // 	_, err = r.db.Exec(sqlQuery, args...)
 // 	if err != nil {
-// 		return fmt.Errorf("%v: %v", fn, err)
+// 		return fmt.Errorf("%v: %w", fn, err)
 // 	}
 
 // 	return nil
 // }
 
 func (r *sqlRepository) Init(ctx context.Context) error {
-	const query = `
-    CREATE TABLE IF NOT EXISTS metric (
-        id VARCHAR(255) NOT NULL,
-        type VARCHAR(7) NOT NULL CHECK (type IN ('gauge', 'counter')),
-        delta BIGINT,
-        value DOUBLE PRECISION,
-        PRIMARY KEY (id, type)
-    );`
-
-	_, err := r.db.ExecContext(ctx, query)
-	if err != nil {
-		panic(err)
+	for _, query := range r.dialect.schema {
+		if _, err := r.db.ExecContext(ctx, query); err != nil {
+			panic(err)
+		}
 	}
 
 	return nil
 }
 
-func (r *sqlRepository) validateMetric(metric models.Metrics) error {
-	switch metric.MType {
-	case models.Gauge:
-		if metric.Value == nil {
-			return ErrNotCorrectMetricType
+func (r *sqlRepository) Delete(m models.Metrics) error {
+	const fn = "sqlRepository.Delete"
+
+	var n int64
+
+	f := func() error {
+		err := r.inTx(func(tx *sql.Tx) error {
+			res, err := tx.Exec(r.rebind(`DELETE FROM metric WHERE id = ? AND type = ?`), m.ID, m.MType)
+			if err != nil {
+				return err
+			}
+
+			if n, err = res.RowsAffected(); err != nil || n == 0 || m.MType != models.Counter {
+				return err
+			}
+
+			_, err = tx.Exec(r.rebind(`DELETE FROM metric_history WHERE id = ?`), m.ID)
+
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("%v: %w", fn, err)
 		}
-	case models.Counter:
-		if metric.Delta == nil {
-			return ErrNotCorrectMetricType
+
+		return nil
+	}
+
+	if err := r.retry(f); err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return fmt.Errorf("%v: %w", fn, models.ErrMetricNotFound)
+	}
+
+	return nil
+}
+
+func (r *sqlRepository) Reset(m models.Metrics) error {
+	const fn = "sqlRepository.Reset"
+
+	if m.MType != models.Counter {
+		return fmt.Errorf("%v: %w", fn, models.ErrUnexpectedMetricType)
+	}
+
+	var n int64
+
+	f := func() error {
+		now := time.Now().UTC()
+
+		err := r.inTx(func(tx *sql.Tx) error {
+			res, err := tx.Exec(r.rebind(`
+                UPDATE metric SET delta = 0, updated_at = ?, stale = ?
+                WHERE id = ? AND type = 'counter'`), now, false, m.ID)
+			if err != nil {
+				return err
+			}
+
+			if n, err = res.RowsAffected(); err != nil || n == 0 {
+				return err
+			}
+
+			_, err = tx.Exec(r.rebind(insertHistoryQuery), m.ID, now, 0.0)
+
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("%v: %w", fn, err)
 		}
-	default:
-		return ErrNotCorrectMetricType
+
+		return nil
+	}
+
+	if err := r.retry(f); err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return fmt.Errorf("%v: %w", fn, models.ErrMetricNotFound)
 	}
 
 	return nil
 }
+
+// History отдаёт точки counter'а начиная с последней точки до since.
+func (r *sqlRepository) History(m models.Metrics, since time.Time) ([]models.Point, error) {
+	const fn = "sqlRepository.History"
+	const historyQuery = `
+        SELECT ts, value FROM metric_history
+        WHERE id = ? AND ts >= COALESCE(
+            (SELECT max(ts) FROM metric_history WHERE id = ? AND ts < ?),
+            ?
+        )
+        ORDER BY ts;
+    `
+
+	if m.MType != models.Counter {
+		return nil, fmt.Errorf("%v: %w", fn, models.ErrUnexpectedMetricType)
+	}
+
+	since = since.UTC()
+
+	var res []models.Point
+
+	f := func() error {
+		res = res[:0]
+
+		rows, err := r.db.Query(r.rebind(historyQuery), m.ID, m.ID, since, since)
+		if err != nil {
+			return fmt.Errorf("%v: %w", fn, err)
+		}
+
+		defer rows.Close()
+
+		for rows.Next() {
+			var p models.Point
+
+			if err := rows.Scan(&p.Time, &p.Value); err != nil {
+				return fmt.Errorf("%v: %w", fn, err)
+			}
+
+			res = append(res, p)
+		}
+
+		return rows.Err()
+	}
+
+	if err := r.retry(f); err != nil {
+		return nil, err
+	}
+
+	if len(res) == 0 {
+		return nil, fmt.Errorf("%v: %w", fn, models.ErrMetricNotFound)
+	}
+
+	return res, nil
+}
+
+func (r *sqlRepository) MarkStale(before time.Time) (int, error) {
+	const fn = "sqlRepository.MarkStale"
+
+	query := r.builder.Update("metric").
+		Set("stale", true).
+		Where(sq.And{sq.Lt{"updated_at": before.UTC()}, sq.Eq{"stale": false}})
+
+	return r.execCount(fn, query)
+}
+
+// DeleteStale удаляет вместе с сериями и их историю, как Delete: иначе
+// вернувшаяся серия получила бы в History точки удалённой.
+func (r *sqlRepository) DeleteStale(before time.Time) (int, error) {
+	const fn = "sqlRepository.DeleteStale"
+
+	before = before.UTC()
+
+	var n int64
+
+	f := func() error {
+		err := r.inTx(func(tx *sql.Tx) error {
+			_, err := tx.Exec(r.rebind(`
+                DELETE FROM metric_history WHERE id IN (
+                    SELECT id FROM metric WHERE type = 'counter' AND updated_at < ?
+                )`), before)
+			if err != nil {
+				return err
+			}
+
+			res, err := tx.Exec(r.rebind(`DELETE FROM metric WHERE updated_at < ?`), before)
+			if err != nil {
+				return err
+			}
+
+			n, err = res.RowsAffected()
+
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("%v: %w", fn, err)
+		}
+
+		return nil
+	}
+
+	if err := r.retry(f); err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
+}
+
+func (r *sqlRepository) execCount(fn string, query sq.Sqlizer) (int, error) {
+	sqlQuery, args, err := query.ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("%v: %w", fn, err)
+	}
+
+	var n int64
+
+	f := func() error {
+		res, err := r.db.Exec(sqlQuery, args...)
+		if err != nil {
+			return fmt.Errorf("%v: %w", fn, err)
+		}
+
+		n, err = res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("%v: %w", fn, err)
+		}
+
+		return nil
+	}
+
+	if err := r.retry(f); err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
+}
@@ -0,0 +1,104 @@
+package sqlrepository
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/apperrors"
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+	sq "github.com/Masterminds/squirrel"
+	sqlitedriver "modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// В SQLite нет разбора строк, нужного для меток, поэтому он закрыт
+// функцией на Go: label_value достаёт метку из ID так же, как substring
+// с labelPattern в Postgres.
+func init() {
+	sqlitedriver.MustRegisterDeterministicScalarFunction("label_value", 2, sqliteLabelValue)
+}
+
+var sqlite = dialect{
+	name:        "sqlite",
+	driver:      "sqlite",
+	placeholder: sq.Question,
+	schema: []string{
+		`CREATE TABLE IF NOT EXISTS metric (
+            id TEXT NOT NULL,
+            type TEXT NOT NULL CHECK (type IN ('gauge', 'counter')),
+            delta INTEGER,
+            value REAL,
+            updated_at TIMESTAMP NOT NULL,
+            stale BOOLEAN NOT NULL DEFAULT false,
+            PRIMARY KEY (id, type)
+        )`,
+		`CREATE TABLE IF NOT EXISTS metric_history (
+            id TEXT NOT NULL,
+            ts TIMESTAMP NOT NULL,
+            value REAL NOT NULL
+        )`,
+		`CREATE INDEX IF NOT EXISTS metric_history_id_ts ON metric_history (id, ts)`,
+	},
+	labelExpr: func(label string) (string, []any) {
+		return "label_value(id, ?)", []any{label}
+	},
+	errKind: sqliteErrKind,
+	prepare: sqliteDSN,
+	// Писатель в SQLite всё равно один, а с одним соединением не бывает
+	// "database is locked" и работает :memory:.
+	tune: func(db *sql.DB) { db.SetMaxOpenConns(1) },
+}
+
+// sqliteErrKind смотрит на основной код ошибки: занятая или недоступная
+// база — сбой, нарушение ограничения или неподходящее значение — ошибка данных.
+func sqliteErrKind(err error) error {
+	var sqliteErr *sqlitedriver.Error
+	if !errors.As(err, &sqliteErr) {
+		return nil
+	}
+
+	switch sqliteErr.Code() & 0xff {
+	case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED, sqlite3.SQLITE_IOERR,
+		sqlite3.SQLITE_FULL, sqlite3.SQLITE_CANTOPEN, sqlite3.SQLITE_PROTOCOL:
+		return apperrors.ErrUnavailable
+	case sqlite3.SQLITE_CONSTRAINT, sqlite3.SQLITE_TOOBIG, sqlite3.SQLITE_MISMATCH:
+		return apperrors.ErrValidation
+	default:
+		return nil
+	}
+}
+
+// sqliteDSN включает формат времени, который сравнивается как строка
+// в хронологическом порядке (все времена пишутся в UTC), и ожидание
+// блокировки вместо немедленной ошибки.
+func sqliteDSN(dsn string) string {
+	params := []string{"_time_format=sqlite", "_pragma=busy_timeout(5000)"}
+
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+
+	for _, p := range params {
+		key, _, _ := strings.Cut(p, "=")
+		if strings.Contains(dsn, key+"=") {
+			continue
+		}
+
+		dsn += sep + p
+		sep = "&"
+	}
+
+	return dsn
+}
+
+func sqliteLabelValue(_ *sqlitedriver.FunctionContext, args []driver.Value) (driver.Value, error) {
+	id, _ := args[0].(string)
+	label, _ := args[1].(string)
+
+	_, labels := models.ParseSeriesID(id)
+
+	return models.EscapeLabelValue(labels[label]), nil
+}
@@ -0,0 +1,142 @@
+package sqlrepository
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/apperrors"
+	config "github.com/BeInBloom/spanish-inquisition/internal/config/server-config"
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+	"github.com/BeInBloom/spanish-inquisition/internal/query"
+	"github.com/BeInBloom/spanish-inquisition/internal/repository/repotest"
+)
+
+func TestSQLite(t *testing.T) {
+	r, err := New(config.DBConfig{DriverName: "sqlite", Address: filepath.Join(t.TempDir(), "metrics.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if err := r.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	writes := []models.Metrics{
+		repotest.Counter(`requests{code="200"}`, 3),
+		repotest.Counter(`requests{code="200"}`, 4),
+		repotest.Counter(`requests{code="500"}`, 1),
+		repotest.Gauge(`load{host="a"}`, 0.5),
+		repotest.Gauge(`load{host="b"}`, 1.5),
+		repotest.Gauge(`load{host="b"}`, 2.5),
+	}
+
+	if err := r.CreateOrUpdateBatch(writes[:2]); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range writes[2:] {
+		if err := r.CreateOrUpdate(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := r.Get(repotest.Counter(`requests{code="200"}`, 0))
+	if err != nil || got.Delta == nil || *got.Delta != 7 || got.UpdatedAt == nil {
+		t.Fatalf("Get counter: got %+v, %v", got, err)
+	}
+
+	page, err := r.List(query.Filter{Prefix: "load", Match: `host="b"`, Limit: 10})
+	if err != nil || len(page.Metrics) != 1 || *page.Metrics[0].Value != 2.5 {
+		t.Fatalf("List: got %+v, %v", page, err)
+	}
+
+	sel, err := query.Parse(`sum by (code) (requests{code=~"2.."})`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	samples, err := r.Aggregate(sel.(query.Aggregation))
+	if err != nil || len(samples) != 1 || samples[0].Labels["code"] != "200" || samples[0].Value != 7 {
+		t.Fatalf("Aggregate: got %+v, %v", samples, err)
+	}
+
+	samples, err = r.Select(query.Selector{Name: "load", Matchers: []query.Matcher{{Label: "host", Op: query.MatchNotEqual, Value: "a"}}})
+	if err != nil || len(samples) != 1 || samples[0].Value != 2.5 {
+		t.Fatalf("Select: got %+v, %v", samples, err)
+	}
+
+	if err := r.Reset(repotest.Counter(`requests{code="200"}`, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	points, err := r.History(repotest.Counter(`requests{code="200"}`, 0), time.Now().Add(-time.Minute))
+	if err != nil || len(points) != 3 || points[2].Value != 0 {
+		t.Fatalf("History: got %+v, %v", points, err)
+	}
+
+	if n, err := r.MarkStale(time.Now().Add(time.Minute)); err != nil || n != 4 {
+		t.Fatalf("MarkStale: got %d, %v", n, err)
+	}
+
+	if err := r.Delete(repotest.Gauge(`load{host="a"}`, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Delete(repotest.Gauge(`load{host="a"}`, 0)); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Fatalf("second Delete: got %v", err)
+	}
+}
+
+func TestSQLite_Retry(t *testing.T) {
+	r, err := New(config.DBConfig{DriverName: "sqlite", Address: filepath.Join(t.TempDir(), "metrics.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if err := r.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Данные, которые отвергла база, — ошибка запроса, и повторять её незачем.
+	calls := 0
+	err = r.retry(func() error {
+		calls++
+		_, err := r.db.Exec(r.rebind(`INSERT INTO metric (id, type, updated_at) VALUES (?, ?, ?)`), "x", "histogram", time.Now())
+		return err
+	})
+	if !errors.Is(err, apperrors.ErrValidation) || calls != 1 {
+		t.Fatalf("constraint: got %v after %d calls, want validation error after 1", err, calls)
+	}
+
+	// Ошибка без вида — внутренняя, не недоступность.
+	calls = 0
+	err = r.retry(func() error {
+		calls++
+		_, err := r.db.Exec("SELECT * FROM no_such_table")
+		return err
+	})
+	if err == nil || errors.Is(err, apperrors.ErrUnavailable) || errors.Is(err, apperrors.ErrValidation) || calls != 1 {
+		t.Fatalf("bad query: got %v after %d calls, want internal error after 1", err, calls)
+	}
+
+	// Сбой соединения повторяется.
+	calls = 0
+	err = r.retry(func() error {
+		calls++
+		if calls == 1 {
+			return fmt.Errorf("sqlRepository.Get: %w", driver.ErrBadConn)
+		}
+
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Fatalf("bad conn: got %v after %d calls, want success after 2", err, calls)
+	}
+}
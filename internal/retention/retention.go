@@ -0,0 +1,86 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	config "github.com/BeInBloom/spanish-inquisition/internal/config/server-config"
+)
+
+const (
+	ModeMark   = "mark"
+	ModeDelete = "delete"
+
+	defaultSweepInterval = time.Minute
+)
+
+var (
+	ErrUnknownMode = errors.New("unknown retention mode")
+)
+
+type expirer interface {
+	MarkStale(before time.Time) (int, error)
+	DeleteStale(before time.Time) (int, error)
+}
+
+// sweeper периодически проходит по хранилищу и помечает устаревшими
+// или удаляет серии, которые не обновлялись дольше TTL.
+type sweeper struct {
+	cfg  config.RetentionConfig
+	repo expirer
+}
+
+func New(ctx context.Context, cfg config.RetentionConfig, repo expirer) (*sweeper, error) {
+	const fn = "retention.New"
+
+	switch cfg.Mode {
+	case "":
+		cfg.Mode = ModeMark
+	case ModeMark, ModeDelete:
+	default:
+		return nil, fmt.Errorf("%s: %w: %q", fn, ErrUnknownMode, cfg.Mode)
+	}
+
+	if cfg.SweepInterval <= 0 {
+		cfg.SweepInterval = defaultSweepInterval
+	}
+
+	s := &sweeper{
+		cfg:  cfg,
+		repo: repo,
+	}
+
+	if cfg.TTL > 0 {
+		go s.run(ctx)
+	}
+
+	return s, nil
+}
+
+func (s *sweeper) run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.SweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.sweep(time.Now()); err != nil {
+				fmt.Printf("retention sweep error: %v\n", err)
+			}
+		}
+	}
+}
+
+func (s *sweeper) sweep(now time.Time) (int, error) {
+	before := now.Add(-s.cfg.TTL)
+
+	if s.cfg.Mode == ModeDelete {
+		return s.repo.DeleteStale(before)
+	}
+
+	return s.repo.MarkStale(before)
+}
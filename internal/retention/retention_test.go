@@ -0,0 +1,182 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/apperrors"
+	config "github.com/BeInBloom/spanish-inquisition/internal/config/server-config"
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+	"github.com/BeInBloom/spanish-inquisition/internal/repository/memrepository"
+)
+
+type sweep struct {
+	mode   string
+	before time.Time
+}
+
+type fakeExpirer struct {
+	mutex  sync.Mutex
+	sweeps []sweep
+}
+
+func (f *fakeExpirer) MarkStale(before time.Time) (int, error) {
+	return f.record(ModeMark, before)
+}
+
+func (f *fakeExpirer) DeleteStale(before time.Time) (int, error) {
+	return f.record(ModeDelete, before)
+}
+
+func (f *fakeExpirer) record(mode string, before time.Time) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.sweeps = append(f.sweeps, sweep{mode: mode, before: before})
+
+	return 1, nil
+}
+
+func (f *fakeExpirer) count() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return len(f.sweeps)
+}
+
+func TestSweeper_Sweep(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		mode string
+		want string
+	}{
+		{"", ModeMark},
+		{ModeMark, ModeMark},
+		{ModeDelete, ModeDelete},
+	}
+
+	for _, tt := range tests {
+		repo := &fakeExpirer{}
+
+		// Без TTL фоновый проход не запускается, sweep зовём сами.
+		s, err := New(ctx, config.RetentionConfig{Mode: tt.mode}, repo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.cfg.TTL = time.Hour
+
+		if _, err := s.sweep(now); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(repo.sweeps) != 1 || repo.sweeps[0].mode != tt.want || !repo.sweeps[0].before.Equal(now.Add(-time.Hour)) {
+			t.Errorf("mode %q: got %+v, want one %s sweep before %v", tt.mode, repo.sweeps, tt.want, now.Add(-time.Hour))
+		}
+	}
+
+	if _, err := New(ctx, config.RetentionConfig{Mode: "archive"}, &fakeExpirer{}); !errors.Is(err, ErrUnknownMode) {
+		t.Fatalf("got %v, want %v", err, ErrUnknownMode)
+	}
+}
+
+func TestSweeper_Run(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	repo := &fakeExpirer{}
+
+	if _, err := New(ctx, config.RetentionConfig{TTL: time.Minute, SweepInterval: 5 * time.Millisecond}, repo); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for repo.count() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d sweeps in a second, want at least 3", repo.count())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	time.Sleep(20 * time.Millisecond)
+
+	stopped := repo.count()
+	time.Sleep(30 * time.Millisecond)
+
+	if repo.count() != stopped {
+		t.Fatal("sweeper kept running after the context was cancelled")
+	}
+
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	for _, s := range repo.sweeps {
+		if s.mode != ModeMark || time.Since(s.before) < time.Minute {
+			t.Fatalf("unexpected sweep %+v", s)
+		}
+	}
+}
+
+func TestSweeper_MarkThenDelete(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	repoCfg := config.Config{}
+	repoCfg.BakConfig.Path = filepath.Join(t.TempDir(), "bak.json")
+	repoCfg.StoreInterval = 300
+
+	repo := memrepository.New(repoCfg)
+	if err := repo.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	value := 1.0
+	load := models.Metrics{ID: "load", MType: models.Gauge, Value: &value}
+	if err := repo.CreateOrUpdate(load); err != nil {
+		t.Fatal(err)
+	}
+
+	marker, err := New(ctx, config.RetentionConfig{Mode: ModeMark}, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	marker.cfg.TTL = time.Hour
+
+	deleter, err := New(ctx, config.RetentionConfig{Mode: ModeDelete}, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleter.cfg.TTL = 2 * time.Hour
+
+	later := time.Now().Add(90 * time.Minute)
+
+	if n, err := marker.sweep(later); err != nil || n != 1 {
+		t.Fatalf("mark: got %d, %v", n, err)
+	}
+
+	got, err := repo.Get(load)
+	if err != nil || !got.Stale {
+		t.Fatalf("after mark: got %+v, %v", got, err)
+	}
+
+	// Серия устарела, но ещё не старше TTL удаления.
+	if n, err := deleter.sweep(later); err != nil || n != 0 {
+		t.Fatalf("early delete: got %d, %v", n, err)
+	}
+
+	if n, err := deleter.sweep(later.Add(time.Hour)); err != nil || n != 1 {
+		t.Fatalf("delete: got %d, %v", n, err)
+	}
+
+	if _, err := repo.Get(load); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Fatalf("after delete: got %v, want not found", err)
+	}
+}
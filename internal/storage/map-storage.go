@@ -1,20 +1,29 @@
 package mapstorage
 
 import (
-	"errors"
 	"sync"
+	"time"
 
 	"github.com/BeInBloom/spanish-inquisition/internal/models"
 )
 
+const (
+	defaultHistoryRetention = time.Hour
+	maxHistoryPoints        = 4096
+)
+
 var (
-	ErrNotFound             = errors.New("not found")
-	ErrUnexpectedMetricType = errors.New("unexpected metric type")
+	ErrNotFound             = models.ErrMetricNotFound
+	ErrUnexpectedMetricType = models.ErrUnexpectedMetricType
 )
 
+// history хранит накопленные значения counter'ов по времени для расчёта rate.
+// Точки старше historyRetention выкидываются при записи.
 type storage struct {
-	mutex sync.Mutex
-	data  map[string]models.Metrics
+	mutex            sync.Mutex
+	data             map[string]models.Metrics
+	history          map[string][]models.Point
+	historyRetention time.Duration
 }
 
 func (s *storage) Get(item models.Metrics) (models.Metrics, error) {
@@ -63,12 +72,133 @@ func (s *storage) Create(item models.Metrics) error {
 
 }
 
+// Load кладёт метрику как есть, вместе с её временем обновления.
+// Нужен для восстановления из бекапа и применения реплики, чтобы
+// не продлевать жизнь старым сериям.
+func (s *storage) Load(item models.Metrics) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.load(item)
+}
+
+// Replace заменяет всё содержимое хранилища, история counter'ов
+// начинается заново.
+func (s *storage) Replace(items []models.Metrics) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.data = make(map[string]models.Metrics, len(items))
+	s.history = make(map[string][]models.Point)
+
+	for _, item := range items {
+		s.load(item)
+	}
+}
+
+func (s *storage) load(item models.Metrics) {
+	key := s.getKey(item)
+	s.data[key] = item
+
+	if item.MType != models.Counter || item.Delta == nil || item.UpdatedAt == nil {
+		return
+	}
+
+	// Повторно присланное состояние (например, пометка stale) не должно
+	// добавлять точку в историю.
+	if points := s.history[key]; len(points) > 0 && !points[len(points)-1].Time.Before(*item.UpdatedAt) {
+		return
+	}
+
+	s.appendHistory(key, *item.UpdatedAt, float64(*item.Delta))
+}
+
+func (s *storage) Delete(item models.Metrics) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key := s.getKey(item)
+
+	if _, ok := s.data[key]; !ok {
+		return ErrNotFound
+	}
+
+	delete(s.data, key)
+	delete(s.history, key)
+
+	return nil
+}
+
+// Reset обнуляет counter. Значение заменяется новым указателем,
+// потому что старый мог уже уйти наружу через Get или Dump.
+func (s *storage) Reset(item models.Metrics) error {
+	if item.MType != models.Counter {
+		return ErrUnexpectedMetricType
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key := s.getKey(item)
+
+	old, ok := s.data[key]
+	if !ok {
+		return ErrNotFound
+	}
+
+	var zero int64
+	now := time.Now()
+
+	old.Delta = &zero
+	old.UpdatedAt = &now
+	old.Stale = false
+	s.data[key] = old
+
+	s.appendHistory(key, now, 0)
+
+	return nil
+}
+
+// Expire помечает устаревшими или удаляет серии, которые не обновлялись
+// с момента before, и возвращает число затронутых серий.
+func (s *storage) Expire(before time.Time, remove bool) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var n int
+
+	for key, item := range s.data {
+		if item.UpdatedAt == nil || !item.UpdatedAt.Before(before) {
+			continue
+		}
+
+		if remove {
+			delete(s.data, key)
+			delete(s.history, key)
+			n++
+			continue
+		}
+
+		if !item.Stale {
+			item.Stale = true
+			s.data[key] = item
+			n++
+		}
+	}
+
+	return n
+}
+
 func (s *storage) createGauge(item models.Metrics) {
 	const fn = "storage.createGauge"
 
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
+	now := time.Now()
+	item.UpdatedAt = &now
+	item.Stale = false
+
 	key := s.getKey(item)
 	s.data[key] = item
 }
@@ -80,26 +210,89 @@ func (s *storage) createCounter(item models.Metrics) {
 	defer s.mutex.Unlock()
 
 	key := s.getKey(item)
+	now := time.Now()
 
-	_, ok := s.data[key]
+	old, ok := s.data[key]
 	if !ok {
-		s.data[s.getKey(item)] = item
+		item.UpdatedAt = &now
+		item.Stale = false
+		s.data[key] = item
+
+		if item.Delta != nil {
+			s.appendHistory(key, now, float64(*item.Delta))
+		}
+
 		return
 	}
 
-	if s.data[key].Delta != nil && item.Delta != nil {
-		*s.data[key].Delta += *item.Delta
+	// Сумма кладётся в новый указатель: старый мог уже уйти наружу
+	// через Get или Dump, как и в Reset.
+	if old.Delta != nil && item.Delta != nil {
+		sum := *old.Delta + *item.Delta
+		old.Delta = &sum
+	}
+
+	old.UpdatedAt = &now
+	old.Stale = false
+	s.data[key] = old
+
+	if old.Delta != nil {
+		s.appendHistory(key, now, float64(*old.Delta))
+	}
+}
+
+// History возвращает точки counter'а начиная с последней точки до since,
+// чтобы у окна была база для расчёта прироста.
+func (s *storage) History(item models.Metrics, since time.Time) ([]models.Point, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key := s.getKey(item)
+
+	points, ok := s.history[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	from := 0
+	for i, p := range points {
+		if p.Time.Before(since) {
+			from = i
+		}
 	}
+
+	return append([]models.Point(nil), points[from:]...), nil
+}
+
+func (s *storage) appendHistory(key string, t time.Time, value float64) {
+	points := append(s.history[key], models.Point{Time: t, Value: value})
+
+	cutoff := t.Add(-s.historyRetention)
+
+	drop := 0
+	for drop < len(points)-1 && points[drop].Time.Before(cutoff) {
+		drop++
+	}
+
+	if len(points)-drop > maxHistoryPoints {
+		drop = len(points) - maxHistoryPoints
+	}
+
+	s.history[key] = points[drop:]
 }
 
 func (s *storage) getKey(item models.Metrics) string {
 	return item.MType + item.ID
 }
 
-func New() *storage {
-	data := make(map[string]models.Metrics)
+func New(historyRetention time.Duration) *storage {
+	if historyRetention <= 0 {
+		historyRetention = defaultHistoryRetention
+	}
 
 	return &storage{
-		data: data,
+		data:             make(map[string]models.Metrics),
+		history:          make(map[string][]models.Point),
+		historyRetention: historyRetention,
 	}
 }
@@ -0,0 +1,43 @@
+package mapstorage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+)
+
+func TestStorage_Expire(t *testing.T) {
+	s := New(0)
+
+	value := 1.0
+	old := time.Now().Add(-time.Hour)
+
+	s.Load(models.Metrics{ID: "Dead", MType: models.Gauge, Value: &value, UpdatedAt: &old})
+	if err := s.Create(models.Metrics{ID: "Alive", MType: models.Gauge, Value: &value}); err != nil {
+		t.Fatal(err)
+	}
+
+	cutoff := time.Now().Add(-time.Minute)
+
+	if n := s.Expire(cutoff, false); n != 1 {
+		t.Fatalf("marked %d series, want 1", n)
+	}
+
+	dead, err := s.Get(models.Metrics{ID: "Dead", MType: models.Gauge})
+	if err != nil || !dead.Stale {
+		t.Fatalf("Dead must be stale, got %+v, %v", dead, err)
+	}
+
+	if err := s.Create(models.Metrics{ID: "Dead", MType: models.Gauge, Value: &value}); err != nil {
+		t.Fatal(err)
+	}
+
+	if dead, _ := s.Get(models.Metrics{ID: "Dead", MType: models.Gauge}); dead.Stale {
+		t.Fatal("update must clear the stale flag")
+	}
+
+	if n := s.Expire(time.Now().Add(time.Minute), true); n != 2 || len(s.Dump()) != 0 {
+		t.Fatalf("removed %d series, %d left", n, len(s.Dump()))
+	}
+}
@@ -0,0 +1,230 @@
+package webhooks
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/BeInBloom/spanish-inquisition/internal/apperrors"
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrBadSubscription = apperrors.New(apperrors.ErrValidation, "bad_subscription", "bad subscription")
+	ErrNotFound        = apperrors.New(apperrors.ErrNotFound, "subscription_not_found", "subscription not found")
+	ErrExists          = apperrors.New(apperrors.ErrConflict, "subscription_exists", "subscription already exists")
+)
+
+// Subscription срабатывает на создание серии (OnCreate) и/или на изменение
+// значения больше чем на ChangePercent процентов. Match — регулярка на ID
+// целиком, пустая подходит ко всем сериям.
+type Subscription struct {
+	ID            string  `yaml:"id" json:"id"`
+	URL           string  `yaml:"url" json:"url"`
+	Secret        string  `yaml:"secret,omitempty" json:"secret,omitempty"`
+	Match         string  `yaml:"match,omitempty" json:"match,omitempty"`
+	Type          string  `yaml:"type,omitempty" json:"type,omitempty"`
+	OnCreate      bool    `yaml:"on_create,omitempty" json:"on_create,omitempty"`
+	ChangePercent float64 `yaml:"change_percent,omitempty" json:"change_percent,omitempty"`
+}
+
+type compiledSubscription struct {
+	Subscription
+	re *regexp.Regexp
+}
+
+// registry хранит подписки. Если задан path, каждое изменение
+// переписывает файл, чтобы подписки из API переживали рестарт.
+type registry struct {
+	path string
+
+	mutex sync.RWMutex
+	subs  map[string]compiledSubscription
+}
+
+func newRegistry(path string) (*registry, error) {
+	r := &registry{
+		path: path,
+		subs: make(map[string]compiledSubscription),
+	}
+
+	if path == "" {
+		return r, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return r, nil
+		}
+
+		return nil, err
+	}
+
+	var file struct {
+		Subscriptions []Subscription `yaml:"subscriptions"`
+	}
+
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	for _, s := range file.Subscriptions {
+		c, err := compile(s)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := r.subs[s.ID]; ok {
+			return nil, fmt.Errorf("%w: %q", ErrExists, s.ID)
+		}
+
+		r.subs[s.ID] = c
+	}
+
+	return r, nil
+}
+
+// List отдаёт подписки без секретов.
+func (r *registry) List() []Subscription {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	res := make([]Subscription, 0, len(r.subs))
+	for _, s := range r.subs {
+		s.Secret = ""
+		res = append(res, s.Subscription)
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+
+	return res
+}
+
+func (r *registry) Add(s Subscription) error {
+	const fn = "webhooks.Add"
+
+	c, err := compile(s)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.subs[s.ID]; ok {
+		return fmt.Errorf("%s: %w: %q", fn, ErrExists, s.ID)
+	}
+
+	r.subs[s.ID] = c
+
+	if err := r.save(); err != nil {
+		delete(r.subs, s.ID)
+		return fmt.Errorf("%s: %v", fn, err)
+	}
+
+	return nil
+}
+
+func (r *registry) Remove(id string) error {
+	const fn = "webhooks.Remove"
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	old, ok := r.subs[id]
+	if !ok {
+		return fmt.Errorf("%s: %w: %q", fn, ErrNotFound, id)
+	}
+
+	delete(r.subs, id)
+
+	if err := r.save(); err != nil {
+		r.subs[id] = old
+		return fmt.Errorf("%s: %v", fn, err)
+	}
+
+	return nil
+}
+
+func (r *registry) size() int {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return len(r.subs)
+}
+
+func (r *registry) snapshot() []compiledSubscription {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	res := make([]compiledSubscription, 0, len(r.subs))
+	for _, s := range r.subs {
+		res = append(res, s)
+	}
+
+	return res
+}
+
+// save вызывается под мьютексом.
+func (r *registry) save() error {
+	if r.path == "" {
+		return nil
+	}
+
+	subs := make([]Subscription, 0, len(r.subs))
+	for _, s := range r.subs {
+		subs = append(subs, s.Subscription)
+	}
+
+	sort.Slice(subs, func(i, j int) bool { return subs[i].ID < subs[j].ID })
+
+	data, err := yaml.Marshal(struct {
+		Subscriptions []Subscription `yaml:"subscriptions"`
+	}{subs})
+	if err != nil {
+		return err
+	}
+
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, r.path)
+}
+
+func compile(s Subscription) (compiledSubscription, error) {
+	if s.ID == "" {
+		return compiledSubscription{}, fmt.Errorf("%w: empty id", ErrBadSubscription)
+	}
+
+	if u, err := url.Parse(s.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return compiledSubscription{}, fmt.Errorf("%w: %s: bad url %q", ErrBadSubscription, s.ID, s.URL)
+	}
+
+	if s.Type != "" && s.Type != models.Gauge && s.Type != models.Counter {
+		return compiledSubscription{}, fmt.Errorf("%w: %s: bad type %q", ErrBadSubscription, s.ID, s.Type)
+	}
+
+	if !s.OnCreate && s.ChangePercent <= 0 {
+		return compiledSubscription{}, fmt.Errorf("%w: %s: neither on_create nor change_percent is set", ErrBadSubscription, s.ID)
+	}
+
+	match := s.Match
+	if match == "" {
+		match = ".*"
+	}
+
+	re, err := regexp.Compile("^(?:" + match + ")$")
+	if err != nil {
+		return compiledSubscription{}, fmt.Errorf("%w: %s: %v", ErrBadSubscription, s.ID, err)
+	}
+
+	return compiledSubscription{Subscription: s, re: re}, nil
+}
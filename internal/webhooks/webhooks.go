@@ -0,0 +1,333 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	config "github.com/BeInBloom/spanish-inquisition/internal/config/server-config"
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+	"github.com/BeInBloom/spanish-inquisition/internal/pubsub"
+	"github.com/BeInBloom/spanish-inquisition/internal/wrappers"
+)
+
+const (
+	KindCreated = "created"
+	KindChange  = "change"
+
+	signatureHeader = "HashSHA256"
+
+	eventsBuffer    = 1024
+	queueSize       = 256
+	workers         = 4
+	deliveryTimeout = 5 * time.Second
+	attempts        = 3
+	retryStep       = 2 * time.Second
+)
+
+type subscriber interface {
+	Subscribe(f pubsub.Filter, buffer int) *pubsub.Subscription
+	Unsubscribe(s *pubsub.Subscription)
+}
+
+// Payload — тело запроса на вебхук. Для counter'а Metric содержит
+// накопленное после записи значение. ChangePercent не заполняется,
+// если предыдущее значение было нулевым.
+type Payload struct {
+	Subscription  string          `json:"subscription"`
+	Kind          string          `json:"kind"`
+	Metric        models.Metrics  `json:"metric"`
+	Previous      *models.Metrics `json:"previous,omitempty"`
+	ChangePercent *float64        `json:"change_percent,omitempty"`
+	Time          time.Time       `json:"time"`
+}
+
+type delivery struct {
+	sub     Subscription
+	payload Payload
+}
+
+type deadLetter struct {
+	Time    time.Time `json:"time"`
+	URL     string    `json:"url"`
+	Error   string    `json:"error"`
+	Payload Payload   `json:"payload"`
+}
+
+// dispatcher читает события записи из hub, сверяет их с подписками
+// и доставляет асинхронно пулом воркеров. То, что не удалось доставить
+// за все попытки или не влезло в очередь, уходит в dead-letter файл.
+//
+// На hub dispatcher подписан, только пока есть хоть одна подписка:
+// publisher читает предыдущее состояние серии, лишь когда у hub есть
+// слушатели, и пустой dispatcher не должен добавлять чтение к каждой записи.
+type dispatcher struct {
+	*registry
+
+	ctx      context.Context
+	hub      subscriber
+	subMutex sync.Mutex
+	sub      *pubsub.Subscription
+
+	client         *http.Client
+	deadLetterPath string
+	deadLetterMu   sync.Mutex
+	queue          chan delivery
+}
+
+func New(ctx context.Context, cfg config.WebhooksConfig, hub subscriber) (*dispatcher, error) {
+	const fn = "webhooks.New"
+
+	reg, err := newRegistry(cfg.Path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn, err)
+	}
+
+	d := &dispatcher{
+		registry:       reg,
+		ctx:            ctx,
+		hub:            hub,
+		client:         &http.Client{Timeout: deliveryTimeout},
+		deadLetterPath: cfg.DeadLetterPath,
+		queue:          make(chan delivery, queueSize),
+	}
+
+	d.listen()
+
+	for i := 0; i < workers; i++ {
+		go d.deliver(ctx)
+	}
+
+	return d, nil
+}
+
+func (d *dispatcher) Add(s Subscription) error {
+	if err := d.registry.Add(s); err != nil {
+		return err
+	}
+
+	d.listen()
+
+	return nil
+}
+
+func (d *dispatcher) Remove(id string) error {
+	if err := d.registry.Remove(id); err != nil {
+		return err
+	}
+
+	d.listen()
+
+	return nil
+}
+
+// listen подписывается на hub, если подписки появились, и отписывается,
+// если их не осталось.
+func (d *dispatcher) listen() {
+	d.subMutex.Lock()
+	defer d.subMutex.Unlock()
+
+	empty := d.size() == 0
+
+	switch {
+	case d.ctx.Err() != nil:
+		return
+	case !empty && d.sub == nil:
+		d.sub = d.hub.Subscribe(pubsub.Filter{}, eventsBuffer)
+		go d.match(d.sub)
+	case empty && d.sub != nil:
+		d.hub.Unsubscribe(d.sub)
+		d.sub = nil
+	}
+}
+
+func (d *dispatcher) match(sub *pubsub.Subscription) {
+	defer d.hub.Unsubscribe(sub)
+
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case e, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+
+			if dropped := sub.TakeDropped(); dropped > 0 {
+				fmt.Printf("webhooks: %d events dropped, dispatcher is too slow\n", dropped)
+			}
+
+			for _, s := range d.snapshot() {
+				p, ok := s.payload(e)
+				if !ok {
+					continue
+				}
+
+				select {
+				case d.queue <- delivery{sub: s.Subscription, payload: p}:
+				default:
+					d.writeDeadLetter(s.Subscription, p, fmt.Errorf("delivery queue is full"))
+				}
+			}
+		}
+	}
+}
+
+func (d *dispatcher) deliver(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-d.queue:
+			if err := wrappers.RetryWrapper(func() error { return d.send(ctx, job) }, attempts, retryStep); err != nil {
+				d.writeDeadLetter(job.sub, job.payload, err)
+			}
+		}
+	}
+}
+
+func (d *dispatcher) send(ctx context.Context, job delivery) error {
+	body, err := json.Marshal(job.payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, job.sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if job.sub.Secret != "" {
+		h := hmac.New(sha256.New, []byte(job.sub.Secret))
+		h.Write(body)
+		req.Header.Set(signatureHeader, hex.EncodeToString(h.Sum(nil)))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func (d *dispatcher) writeDeadLetter(sub Subscription, p Payload, cause error) {
+	line, err := json.Marshal(deadLetter{Time: time.Now(), URL: sub.URL, Error: cause.Error(), Payload: p})
+	if err != nil {
+		return
+	}
+
+	if d.deadLetterPath == "" {
+		fmt.Printf("webhook dead letter: %s\n", line)
+		return
+	}
+
+	d.deadLetterMu.Lock()
+	defer d.deadLetterMu.Unlock()
+
+	f, err := os.OpenFile(d.deadLetterPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		fmt.Printf("webhook dead letter error: %v: %s\n", err, line)
+		return
+	}
+	defer f.Close()
+
+	f.Write(append(line, '\n'))
+}
+
+// payload решает, срабатывает ли подписка на событие.
+func (s compiledSubscription) payload(e pubsub.Event) (Payload, bool) {
+	if s.Type != "" && e.Metric.MType != s.Type {
+		return Payload{}, false
+	}
+
+	if !s.re.MatchString(e.Metric.ID) {
+		return Payload{}, false
+	}
+
+	p := Payload{
+		Subscription: s.ID,
+		Metric:       current(e),
+		Previous:     e.Previous,
+		Time:         e.Time,
+	}
+
+	if e.Created {
+		if !s.OnCreate {
+			return Payload{}, false
+		}
+
+		p.Kind = KindCreated
+
+		return p, true
+	}
+
+	// Без предыдущего состояния (его не удалось прочитать или у hub не было
+	// слушателей) нельзя сказать ни что серия новая, ни насколько она изменилась.
+	if e.Previous == nil || s.ChangePercent <= 0 {
+		return Payload{}, false
+	}
+
+	prev, ok := numeric(*e.Previous)
+	if !ok {
+		return Payload{}, false
+	}
+
+	cur, _ := numeric(p.Metric)
+	if cur == prev {
+		return Payload{}, false
+	}
+
+	p.Kind = KindChange
+
+	if prev != 0 {
+		pct := math.Abs(cur-prev) / math.Abs(prev) * 100
+		if pct < s.ChangePercent {
+			return Payload{}, false
+		}
+
+		p.ChangePercent = &pct
+	}
+
+	return p, true
+}
+
+// current возвращает значение серии после записи: для counter'а
+// к предыдущему значению прибавляется присланный прирост.
+func current(e pubsub.Event) models.Metrics {
+	m := e.Metric
+
+	if m.MType == models.Counter && m.Delta != nil && e.Previous != nil && e.Previous.Delta != nil {
+		sum := *e.Previous.Delta + *m.Delta
+		m.Delta = &sum
+	}
+
+	return m
+}
+
+func numeric(m models.Metrics) (float64, bool) {
+	switch {
+	case m.Value != nil:
+		return *m.Value, true
+	case m.Delta != nil:
+		return float64(*m.Delta), true
+	default:
+		return 0, false
+	}
+}
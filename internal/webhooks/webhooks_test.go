@@ -0,0 +1,145 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	config "github.com/BeInBloom/spanish-inquisition/internal/config/server-config"
+	"github.com/BeInBloom/spanish-inquisition/internal/models"
+	"github.com/BeInBloom/spanish-inquisition/internal/pubsub"
+)
+
+func gauge(id string, v float64) *models.Metrics {
+	return &models.Metrics{ID: id, MType: models.Gauge, Value: &v}
+}
+
+func TestSubscription_Payload(t *testing.T) {
+	s, err := compile(Subscription{ID: "heap", URL: "http://hook", Match: "Heap.*", ChangePercent: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		event pubsub.Event
+		want  bool
+	}{
+		{name: "created without on_create", event: pubsub.Event{Metric: *gauge("HeapAlloc", 1), Created: true}},
+		{name: "small change", event: pubsub.Event{Metric: *gauge("HeapAlloc", 120), Previous: gauge("HeapAlloc", 100)}},
+		{name: "big change", event: pubsub.Event{Metric: *gauge("HeapAlloc", 40), Previous: gauge("HeapAlloc", 100)}, want: true},
+		{name: "from zero", event: pubsub.Event{Metric: *gauge("HeapAlloc", 1), Previous: gauge("HeapAlloc", 0)}, want: true},
+		{name: "other metric", event: pubsub.Event{Metric: *gauge("Alloc", 40), Previous: gauge("Alloc", 100)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := s.payload(tt.event); ok != tt.want {
+				t.Errorf("got %v, want %v", ok, tt.want)
+			}
+		})
+	}
+
+	s, err = compile(Subscription{ID: "new", URL: "http://hook", OnCreate: true, ChangePercent: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p, ok := s.payload(pubsub.Event{Metric: *gauge("HeapAlloc", 1), Created: true}); !ok || p.Kind != KindCreated {
+		t.Errorf("created: got %+v, %v", p, ok)
+	}
+
+	if p, ok := s.payload(pubsub.Event{Metric: *gauge("HeapAlloc", 1), Previous: nil, Created: false}); ok {
+		t.Errorf("event without previous state must not fire, got %+v", p)
+	}
+}
+
+func TestDispatcher_Deliver(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := filepath.Join(t.TempDir(), "webhooks.yaml")
+
+	hub := pubsub.New()
+	d, err := New(ctx, config.WebhooksConfig{Path: path}, hub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hub.Subscribers() != 0 {
+		t.Fatal("dispatcher without subscriptions must not listen to the hub")
+	}
+
+	if err := d.Add(Subscription{ID: "new", URL: srv.URL, Secret: "s", Type: models.Counter, OnCreate: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if hub.Subscribers() != 1 {
+		t.Fatalf("got %d hub subscribers, want 1", hub.Subscribers())
+	}
+
+	var delta int64 = 3
+
+	// Событие без предыдущего состояния, но и не о создании, не доставляется.
+	hub.Publish(pubsub.Event{Metric: models.Metrics{ID: "Unknown", MType: models.Counter, Delta: &delta}, Time: time.Now()})
+	hub.Publish(pubsub.Event{Metric: models.Metrics{ID: "PollCount", MType: models.Counter, Delta: &delta}, Created: true, Time: time.Now()})
+
+	select {
+	case r := <-received:
+		body := <-bodies
+
+		h := hmac.New(sha256.New, []byte("s"))
+		h.Write(body)
+		if r.Header.Get(signatureHeader) != hex.EncodeToString(h.Sum(nil)) {
+			t.Error("bad signature")
+		}
+
+		var p Payload
+		if err := json.Unmarshal(body, &p); err != nil || p.Kind != KindCreated || p.Metric.ID != "PollCount" {
+			t.Errorf("unexpected payload %s", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+
+	select {
+	case <-bodies:
+		t.Fatal("event without previous state was delivered")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	reloaded, err := newRegistry(path)
+	if err != nil || len(reloaded.List()) != 1 {
+		t.Fatalf("subscription added via API must be saved to the file: %v", err)
+	}
+
+	if list := d.List(); list[0].Secret != "" {
+		t.Error("List must not expose secrets")
+	}
+
+	if err := d.Remove("new"); err != nil {
+		t.Fatal(err)
+	}
+
+	if hub.Subscribers() != 0 {
+		t.Fatal("dispatcher must stop listening when the last subscription is removed")
+	}
+}